@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build go1.18
+
+package apm
+
+import (
+	"runtime/debug"
+	"strings"
+
+	"go.elastic.co/apm/model"
+)
+
+// buildLabelPrefix is the prefix of the metadata labels in which
+// build settings are recorded.
+const buildLabelPrefix = "go_build_"
+
+// getBuildLabels returns metadata labels describing the settings with
+// which the program was built, as reported by debug.ReadBuildInfo:
+// whether cgo was enabled, the race detector, and architecture feature
+// levels such as GOAMD64.
+func getBuildLabels() model.StringMap {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	var labels model.StringMap
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "CGO_ENABLED", "GOEXPERIMENT", "-race",
+			"GO386", "GOAMD64", "GOARM", "GOARM64",
+			"GOMIPS", "GOMIPS64", "GOPPC64", "GORISCV64", "GOWASM":
+		default:
+			continue
+		}
+		key := buildLabelPrefix + strings.ToLower(strings.TrimPrefix(setting.Key, "-"))
+		labels = append(labels, model.StringMapItem{
+			Key:   cleanLabelKey(key),
+			Value: truncateString(setting.Value),
+		})
+	}
+	return labels
+}
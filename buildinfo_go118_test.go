@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build go1.18
+
+package apm_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.elastic.co/apm/model"
+)
+
+func TestTracerMetadataBuildLabels(t *testing.T) {
+	_, _, service, labels := getSubprocessMetadata(t)
+	assert.Equal(t, runtime.Version(), service.Language.Version)
+	assert.Equal(t, runtime.Version(), service.Runtime.Version)
+	assert.Contains(t, buildLabelKeys(labels), "go_build_cgo_enabled")
+	if runtime.GOARCH == "amd64" {
+		assert.Contains(t, buildLabelKeys(labels), "go_build_goamd64")
+	}
+}
+
+func TestTracerMetadataBuildLabelsGlobalLabelsPrecedence(t *testing.T) {
+	_, _, _, labels := getSubprocessMetadata(t, "ELASTIC_APM_GLOBAL_LABELS=go_build_cgo_enabled=overridden")
+	var values []string
+	for _, item := range labels {
+		if item.Key == "go_build_cgo_enabled" {
+			values = append(values, item.Value)
+		}
+	}
+	assert.Equal(t, []string{"overridden"}, values)
+}
+
+func buildLabelKeys(labels model.StringMap) []string {
+	var keys []string
+	for _, item := range labels {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"go.elastic.co/apm/internal/configutil"
+	"go.elastic.co/apm/internal/wildcard"
+)
+
+// CaptureHeadersMode holds a value indicating how a tracer should
+// capture HTTP request and response headers.
+type CaptureHeadersMode int
+
+const (
+	// CaptureHeadersOff disables capturing of HTTP headers.
+	CaptureHeadersOff CaptureHeadersMode = iota
+
+	// CaptureHeadersAll captures all HTTP headers, subject to
+	// sanitization of the values of headers whose names match the
+	// sanitized field names. This is the default mode.
+	CaptureHeadersAll
+
+	// CaptureHeadersAllowList captures only the HTTP headers whose
+	// names match the allow-list passed to SetCaptureHeadersMode,
+	// subject to sanitization as for CaptureHeadersAll.
+	CaptureHeadersAllowList
+)
+
+// captureHeadersConfig holds the configuration for capturing HTTP headers.
+type captureHeadersConfig struct {
+	mode      CaptureHeadersMode
+	allowList wildcard.Matchers
+}
+
+// capture reports whether the header with the given name should be captured.
+func (c captureHeadersConfig) capture(name string) bool {
+	switch c.mode {
+	case CaptureHeadersAll:
+		return true
+	case CaptureHeadersAllowList:
+		return c.allowList.MatchAny(name)
+	}
+	return false
+}
+
+// SetCaptureHeadersMode sets the HTTP header capture mode. If mode is
+// CaptureHeadersAllowList, only headers whose names match one of the
+// patterns in allowList will be captured; otherwise allowList is ignored.
+//
+// Allow-list patterns are matched case-insensitively, and may contain
+// the "*" wildcard, matching zero or more characters. For example, the
+// patterns "Content-Type" and "X-Request-*" capture only the Content-Type
+// header and headers with the prefix "X-Request-".
+//
+// The capture mode applies to both request and response headers. In
+// CaptureHeadersAllowList mode, request cookies are captured only if
+// the "Cookie" header is allowed.
+func (t *Tracer) SetCaptureHeadersMode(mode CaptureHeadersMode, allowList ...string) {
+	cfg := captureHeadersConfig{mode: mode}
+	if mode == CaptureHeadersAllowList {
+		cfg.allowList = make(wildcard.Matchers, len(allowList))
+		for i, pattern := range allowList {
+			cfg.allowList[i] = configutil.ParseWildcardPattern(pattern)
+		}
+	}
+	t.setLocalInstrumentationConfig(envCaptureHeaders, func(values *instrumentationConfigValues) {
+		values.captureHeaders = cfg
+	})
+}
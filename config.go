@@ -29,6 +29,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"go.elastic.co/apm/internal/apmlog"
 	"go.elastic.co/apm/internal/configutil"
 	"go.elastic.co/apm/internal/wildcard"
 	"go.elastic.co/apm/model"
@@ -57,6 +58,9 @@ const (
 	envCentralConfig               = "ELASTIC_APM_CENTRAL_CONFIG"
 	envBreakdownMetrics            = "ELASTIC_APM_BREAKDOWN_METRICS"
 	envUseElasticTraceparentHeader = "ELASTIC_APM_USE_ELASTIC_TRACEPARENT_HEADER"
+	envSpanCountLabels             = "ELASTIC_APM_SPAN_COUNT_LABELS"
+	envNormalizeTransactionNames   = "ELASTIC_APM_NORMALIZE_TRANSACTION_NAMES"
+	envLogLevel                    = "ELASTIC_APM_LOG_LEVEL"
 
 	// NOTE(axw) profiling environment variables are experimental.
 	// They may be removed in a future minor version without being
@@ -285,6 +289,14 @@ func initialUseElasticTraceparentHeader() (bool, error) {
 	return configutil.ParseBoolEnv(envUseElasticTraceparentHeader, true)
 }
 
+func initialSpanCountLabels() (bool, error) {
+	return configutil.ParseBoolEnv(envSpanCountLabels, false)
+}
+
+func initialNormalizeTransactionNames() (bool, error) {
+	return configutil.ParseBoolEnv(envNormalizeTransactionNames, false)
+}
+
 func initialCPUProfileIntervalDuration() (time.Duration, time.Duration, error) {
 	interval, err := configutil.ParseDurationEnv(envCPUProfileInterval, 0)
 	if err != nil || interval <= 0 {
@@ -319,6 +331,7 @@ func (t *Tracer) updateRemoteConfig(logger WarningLogger, old, attrs map[string]
 	}
 
 	var updates []func(cfg *instrumentationConfig)
+	var logLevelChanged bool
 	for k, v := range attrs {
 		if oldv, ok := old[k]; ok && oldv == v {
 			continue
@@ -379,6 +392,23 @@ func (t *Tracer) updateRemoteConfig(logger WarningLogger, old, attrs map[string]
 					cfg.stackTraceLimit = limit
 				})
 			}
+		case envLogLevel:
+			if _, ok := logLevelSetter(logger); !ok {
+				warningf("central config failure: %s is not supported by the configured logger", k)
+				delete(attrs, k)
+				continue
+			}
+			if err := apmlog.ValidateLevel(v); err != nil {
+				errorf("central config failure: failed to parse %s: %s", k, err)
+				delete(attrs, k)
+				continue
+			} else {
+				level := v
+				logLevelChanged = true
+				updates = append(updates, func(cfg *instrumentationConfig) {
+					cfg.logLevel = level
+				})
+			}
 		case envTransactionSampleRate:
 			sampler, err := parseSampleRate(k, v)
 			if err != nil {
@@ -401,6 +431,9 @@ func (t *Tracer) updateRemoteConfig(logger WarningLogger, old, attrs map[string]
 		if _, ok := attrs[k]; ok {
 			continue
 		}
+		if envName(k) == envLogLevel {
+			logLevelChanged = true
+		}
 		updates = append(updates, func(cfg *instrumentationConfig) {
 			if f, ok := cfg.local[envName(k)]; ok {
 				f(&cfg.instrumentationConfigValues)
@@ -420,6 +453,13 @@ func (t *Tracer) updateRemoteConfig(logger WarningLogger, old, attrs map[string]
 			}
 		})
 	}
+	if logLevelChanged {
+		if setter, ok := logLevelSetter(logger); ok {
+			// The level has already been validated, or is
+			// empty to restore the logger's initial level.
+			setter.SetLevel(t.instrumentationConfig().logLevel)
+		}
+	}
 }
 
 // instrumentationConfig returns the current instrumentationConfig.
@@ -478,10 +518,13 @@ type instrumentationConfig struct {
 type instrumentationConfigValues struct {
 	recording             bool
 	captureBody           CaptureBodyMode
-	captureHeaders        bool
+	captureHeaders        captureHeadersConfig
 	maxSpans              int
 	sampler               Sampler
 	spanFramesMinDuration time.Duration
 	stackTraceLimit       int
 	propagateLegacyHeader bool
+	spanCountLabels       bool
+	normalizeTxNames      bool
+	logLevel              string // empty means the logger's initial level
 }
@@ -26,6 +26,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -85,7 +86,46 @@ func TestTracerCentralConfigUpdate(t *testing.T) {
 	})
 }
 
+func TestTracerCentralConfigUpdateLogLevel(t *testing.T) {
+	// Run as a subtest, like TestTracerCentralConfigUpdate, so the
+	// parallel test is not paused for the remainder of the package's
+	// tests while the tracer is polling for config.
+	t.Run("log_level", func(t *testing.T) {
+		logger := &levelLogger{TestLogger: apmtest.NewTestLogger(t)}
+		testTracerCentralConfigUpdateLogger(t, logger, `{"log_level": "debug"}`, func(*apmtest.RecordingTracer) bool {
+			return logger.getLevel() == "debug"
+		})
+		assert.Equal(t, []string{"debug", ""}, logger.levels)
+	})
+}
+
+type levelLogger struct {
+	apmtest.TestLogger
+	mu     sync.Mutex
+	levels []string
+}
+
+func (l *levelLogger) SetLevel(level string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.levels = append(l.levels, level)
+	return nil
+}
+
+func (l *levelLogger) getLevel() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.levels) == 0 {
+		return ""
+	}
+	return l.levels[len(l.levels)-1]
+}
+
 func testTracerCentralConfigUpdate(t *testing.T, serverResponse string, isRemote func(*apmtest.RecordingTracer) bool) {
+	testTracerCentralConfigUpdateLogger(t, apmtest.NewTestLogger(t), serverResponse, isRemote)
+}
+
+func testTracerCentralConfigUpdateLogger(t *testing.T, logger apm.Logger, serverResponse string, isRemote func(*apmtest.RecordingTracer) bool) {
 	type response struct {
 		etag string
 		body string
@@ -125,7 +165,7 @@ func testTracerCentralConfigUpdate(t *testing.T, serverResponse string, isRemote
 	// configuration.
 	t.Parallel()
 
-	tracer.SetLogger(apmtest.NewTestLogger(t))
+	tracer.SetLogger(logger)
 	assert.False(t, isRemote(tracer))
 
 	timeout := time.After(10 * time.Second)
@@ -0,0 +1,180 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	consumeLoopMinBackoff = 100 * time.Millisecond
+	consumeLoopMaxBackoff = 10 * time.Second
+)
+
+// ErrNoMessage may be returned by a ConsumeFunc to indicate that there
+// was no message to process, e.g. because a long poll of the queue timed
+// out. The transaction tracing the call is discarded, and no error is
+// reported.
+var ErrNoMessage = errors.New("no message")
+
+// ConsumeFunc is the type of a function for use with Tracer.Consume
+// and Tracer.ConsumeLoop. The context passed to the function contains
+// the transaction tracing the call.
+type ConsumeFunc func(ctx context.Context) error
+
+// ConsumeOptions holds options for Tracer.ConsumeOptions and
+// Tracer.ConsumeLoopOptions.
+type ConsumeOptions struct {
+	// QueueDepth, if non-nil, is called when each transaction is
+	// started to obtain the number of messages waiting in the queue,
+	// which is recorded with Context.SetQueueDepth.
+	QueueDepth func() int
+
+	// WorkerPool, if non-nil, is called when each transaction is
+	// started to obtain the number of busy workers and the size of
+	// the worker pool processing messages, which are recorded with
+	// Context.SetWorkerPoolUtilization.
+	WorkerPool func() (busy, size int)
+}
+
+// Consume is equivalent to calling ConsumeOptions with a zero
+// ConsumeOptions struct.
+func (t *Tracer) Consume(ctx context.Context, name string, handler ConsumeFunc) error {
+	return t.ConsumeOptions(ctx, name, handler, ConsumeOptions{})
+}
+
+// ConsumeOptions calls handler, tracing the call as a transaction with the
+// given name and the type "messaging". This is intended for processing
+// a single message or batch of messages within a background consumer.
+//
+// If handler returns an error, the error will be reported and the
+// transaction's result and outcome will be set to "error" and "failure"
+// respectively; otherwise they will be set to "success". If handler
+// panics, the panic will be reported and the transaction ended before
+// the panic is propagated to the caller. The error returned by handler
+// is returned by ConsumeOptions.
+//
+// If handler returns ErrNoMessage, or the error returned by ctx.Err()
+// after ctx is canceled, the transaction is discarded and no error is
+// reported.
+//
+// If opts.QueueDepth or opts.WorkerPool are non-nil, they are called
+// before handler to record the queue depth and worker pool utilization
+// in the transaction context.
+func (t *Tracer) ConsumeOptions(ctx context.Context, name string, handler ConsumeFunc, opts ConsumeOptions) (err error) {
+	tx := t.StartTransaction(name, "messaging")
+	discard := false
+	defer func() {
+		if discard {
+			tx.Discard()
+			return
+		}
+		tx.End()
+	}()
+	if tx.Sampled() {
+		if opts.QueueDepth != nil {
+			tx.Context.SetQueueDepth(opts.QueueDepth())
+		}
+		if opts.WorkerPool != nil {
+			tx.Context.SetWorkerPoolUtilization(opts.WorkerPool())
+		}
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			e := t.Recovered(v)
+			e.SetTransaction(tx)
+			e.Send()
+			tx.Result = "error"
+			tx.Outcome = "failure"
+			panic(v)
+		}
+	}()
+
+	err = handler(ContextWithTransaction(ctx, tx))
+	if err == ErrNoMessage || (err != nil && err == ctx.Err()) {
+		discard = true
+	} else if err != nil {
+		e := t.NewError(err)
+		e.SetTransaction(tx)
+		e.Handled = true
+		e.Send()
+		tx.Result = "error"
+		tx.Outcome = "failure"
+	} else {
+		tx.Result = "success"
+		tx.Outcome = "success"
+	}
+	return err
+}
+
+// ConsumeLoop is equivalent to calling ConsumeLoopOptions with a zero
+// ConsumeOptions struct.
+func (t *Tracer) ConsumeLoop(ctx context.Context, name string, handler ConsumeFunc) error {
+	return t.ConsumeLoopOptions(ctx, name, handler, ConsumeOptions{})
+}
+
+// ConsumeLoopOptions repeatedly calls ConsumeOptions with the given
+// name, handler, and options, until ctx is canceled or its deadline is
+// exceeded, and then returns ctx.Err(). Errors returned by handler are
+// reported, and do not stop the loop. After an error, the loop waits
+// before calling handler again, starting at 100ms and doubling for each
+// consecutive error up to 10s, so a failing handler does not spin.
+//
+// Each call to handler is traced as a separate transaction, so handler
+// should process a single message or batch of messages. If handler
+// blocks waiting for messages to arrive, e.g. when long-polling a queue,
+// the time spent waiting will be included in the transaction; handler
+// should return promptly when ctx is canceled.
+func (t *Tracer) ConsumeLoopOptions(ctx context.Context, name string, handler ConsumeFunc, opts ConsumeOptions) error {
+	var consecutiveErrors int
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		err := t.ConsumeOptions(ctx, name, handler, opts)
+		if err == nil || err == ErrNoMessage || ctx.Err() != nil {
+			consecutiveErrors = 0
+			continue
+		}
+		consecutiveErrors++
+		timer := time.NewTimer(consumeLoopBackoff(consecutiveErrors))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// consumeLoopBackoff returns the duration to wait after
+// the given number of consecutive errors.
+func consumeLoopBackoff(consecutiveErrors int) time.Duration {
+	backoff := consumeLoopMinBackoff
+	for i := 1; i < consecutiveErrors && backoff < consumeLoopMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > consumeLoopMaxBackoff {
+		backoff = consumeLoopMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,209 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
+)
+
+func TestTracerConsume(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	err := tracer.Consume(context.Background(), "consume", func(ctx context.Context) error {
+		require.NotNil(t, apm.TransactionFromContext(ctx))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	consumeErr := errors.New("boom")
+	err = tracer.Consume(context.Background(), "consume", func(ctx context.Context) error {
+		return consumeErr
+	})
+	assert.Equal(t, consumeErr, err)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, "consume", payloads.Transactions[0].Name)
+	assert.Equal(t, "messaging", payloads.Transactions[0].Type)
+	assert.Equal(t, "success", payloads.Transactions[0].Result)
+	assert.Equal(t, "success", payloads.Transactions[0].Outcome)
+	assert.Equal(t, "error", payloads.Transactions[1].Result)
+	assert.Equal(t, "failure", payloads.Transactions[1].Outcome)
+	assert.Equal(t, payloads.Transactions[1].ID, payloads.Errors[0].TransactionID)
+	assert.Equal(t, "boom", payloads.Errors[0].Exception.Message)
+	assert.True(t, payloads.Errors[0].Exception.Handled)
+}
+
+func TestTracerConsumePanic(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	assert.PanicsWithValue(t, "boom", func() {
+		tracer.Consume(context.Background(), "consume", func(ctx context.Context) error {
+			panic("boom")
+		})
+	})
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, "failure", payloads.Transactions[0].Outcome)
+	assert.Equal(t, payloads.Transactions[0].ID, payloads.Errors[0].TransactionID)
+	assert.False(t, payloads.Errors[0].Exception.Handled)
+}
+
+func TestTracerConsumeLoop(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int
+	err := tracer.ConsumeLoop(ctx, "consume", func(ctx context.Context) error {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+		if calls == 2 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 3, calls)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 3)
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, "failure", payloads.Transactions[1].Outcome)
+}
+
+func TestTracerConsumeLoopOptions(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	depth := 10
+	err := tracer.ConsumeLoopOptions(ctx, "consume", func(ctx context.Context) error {
+		depth--
+		if depth == 8 {
+			cancel()
+		}
+		return nil
+	}, apm.ConsumeOptions{
+		QueueDepth: func() int { return depth },
+		WorkerPool: func() (busy, size int) { return 3, 4 },
+	})
+	assert.Equal(t, context.Canceled, err)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	for i, tx := range payloads.Transactions {
+		assert.Equal(t, model.IfaceMap{
+			{Key: "queue_depth", Value: float64(10 - i)},
+			{Key: "worker_pool_utilization", Value: 0.75},
+		}, tx.Context.Tags)
+	}
+}
+
+func TestTracerConsumeNoMessage(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	err := tracer.Consume(context.Background(), "consume", func(ctx context.Context) error {
+		return apm.ErrNoMessage
+	})
+	assert.Equal(t, apm.ErrNoMessage, err)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	assert.Empty(t, payloads.Transactions)
+	assert.Empty(t, payloads.Errors)
+}
+
+func TestTracerConsumeLoopCanceled(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A handler blocked waiting for messages when the loop is
+	// stopped returns ctx.Err(), which is not reported.
+	var calls int
+	err := tracer.ConsumeLoop(ctx, "consume", func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			return apm.ErrNoMessage
+		}
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 2, calls)
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	assert.Empty(t, payloads.Transactions)
+	assert.Empty(t, payloads.Errors)
+}
+
+func TestTracerConsumeLoopBackoff(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int
+	start := time.Now()
+	err := tracer.ConsumeLoop(ctx, "consume", func(ctx context.Context) error {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+		return errors.New("boom")
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 3, calls)
+
+	// The loop waits 100ms after the first error,
+	// and 200ms after the second.
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 300*time.Millisecond, "elapsed: %s", elapsed)
+}
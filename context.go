@@ -20,6 +20,8 @@ package apm
 import (
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"go.elastic.co/apm/internal/apmhttputil"
 	"go.elastic.co/apm/model"
@@ -35,9 +37,13 @@ type Context struct {
 	requestSocket    model.RequestSocket
 	response         model.Response
 	user             model.User
+	session          model.TransactionSession
 	service          model.Service
 	serviceFramework model.Framework
-	captureHeaders   bool
+	message          model.MessageContext
+	messageQueue     model.MessageQueueContext
+	messageAge       model.MessageAgeContext
+	captureHeaders   captureHeadersConfig
 	captureBodyMask  CaptureBodyMode
 }
 
@@ -47,6 +53,7 @@ func (c *Context) build() *model.Context {
 	case c.model.Response != nil:
 	case c.model.User != nil:
 	case c.model.Service != nil:
+	case c.model.Message != nil:
 	case len(c.model.Tags) != 0:
 	case len(c.model.Custom) != 0:
 	default:
@@ -97,18 +104,41 @@ func (c *Context) SetLabel(key string, value interface{}) {
 	})
 }
 
+// replaceLabel replaces the value of the last label with the given
+// key, returning false if there is no such label.
+func (c *Context) replaceLabel(key string, value interface{}) bool {
+	key = cleanLabelKey(key)
+	for i := len(c.model.Tags) - 1; i >= 0; i-- {
+		if c.model.Tags[i].Key == key {
+			c.model.Tags[i].Value = makeLabelValue(value)
+			return true
+		}
+	}
+	return false
+}
+
 // SetCustom sets custom context.
 //
 // Invalid characters ('.', '*', and '"') in the key will be
 // replaced with an underscore. The value may be any JSON-encodable
 // value.
+//
+// Custom context may be structured: if value is a map of type
+// map[string]interface{} or map[string]string, it will be recorded
+// as a nested object. Invalid characters in the keys of nested maps
+// will also be replaced with underscores; the map passed in is not
+// modified.
+//
+// Unlike labels, custom context is not indexed, and so cannot be
+// used for searching or aggregating; it is displayed alongside the
+// transaction or error in the APM UI.
 func (c *Context) SetCustom(key string, value interface{}) {
 	// Note that we do not attempt to de-duplicate the keys.
 	// This is OK, since json.Unmarshal will always take the
 	// final instance.
 	c.model.Custom = append(c.model.Custom, model.IfaceMapItem{
 		Key:   cleanLabelKey(key),
-		Value: value,
+		Value: makeCustomValue(value),
 	})
 }
 
@@ -165,20 +195,23 @@ func (c *Context) SetHTTPRequest(req *http.Request) {
 		URL:         apmhttputil.RequestURL(req),
 		Method:      truncateString(req.Method),
 		HTTPVersion: httpVersion,
-		Cookies:     req.Cookies(),
+	}
+	if c.captureHeaders.mode != CaptureHeadersAllowList || c.captureHeaders.capture("Cookie") {
+		c.request.Cookies = req.Cookies()
 	}
 	c.model.Request = &c.request
 
-	if c.captureHeaders {
-		for k, values := range req.Header {
-			if k == "Cookie" {
-				// We capture cookies in the request structure.
-				continue
-			}
-			c.request.Headers = append(c.request.Headers, model.Header{
-				Key: k, Values: values,
-			})
+	for k, values := range req.Header {
+		if k == "Cookie" {
+			// We capture cookies in the request structure.
+			continue
+		}
+		if !c.captureHeaders.capture(k) {
+			continue
 		}
+		c.request.Headers = append(c.request.Headers, model.Header{
+			Key: k, Values: values,
+		})
 	}
 
 	c.requestSocket = model.RequestSocket{
@@ -212,10 +245,13 @@ func (c *Context) SetHTTPRequestBody(bc *BodyCapturer) {
 
 // SetHTTPResponseHeaders sets the HTTP response headers in the context.
 func (c *Context) SetHTTPResponseHeaders(h http.Header) {
-	if !c.captureHeaders {
+	if c.captureHeaders.mode == CaptureHeadersOff {
 		return
 	}
 	for k, values := range h {
+		if !c.captureHeaders.capture(k) {
+			continue
+		}
 		c.response.Headers = append(c.response.Headers, model.Header{
 			Key: k, Values: values,
 		})
@@ -254,3 +290,74 @@ func (c *Context) SetUsername(username string) {
 		c.model.User = &c.user
 	}
 }
+
+// SetUserSession sets the ID of the user session or visitor to which the
+// transaction belongs, e.g. taken from a session cookie, so that a user's
+// transactions may be grouped together. Leading and trailing whitespace
+// is removed, and IDs longer than 1024 characters will be truncated.
+//
+// Session IDs are commonly credentials; avoid recording them verbatim
+// where they could be used to hijack a session, e.g. by hashing them
+// first, as done by module/apmhttp.
+//
+// The session ID is recorded only for transactions; it is ignored when
+// set in the context of an error.
+func (c *Context) SetUserSession(id string) {
+	c.session.ID = truncateString(strings.TrimSpace(id))
+}
+
+const (
+	// QueueDepthLabel is the name of the label recorded by
+	// Context.SetQueueDepth.
+	QueueDepthLabel = "queue_depth"
+
+	// WorkerPoolUtilizationLabel is the name of the label recorded
+	// by Context.SetWorkerPoolUtilization.
+	WorkerPoolUtilizationLabel = "worker_pool_utilization"
+)
+
+// SetQueueDepth records, as the label "queue_depth", the number of
+// messages waiting in the queue from which the message being processed
+// was received. This should be called when processing starts, so that
+// processing latency can be compared with the backlog at the time.
+func (c *Context) SetQueueDepth(depth int) {
+	c.SetLabel(QueueDepthLabel, depth)
+}
+
+// SetWorkerPoolUtilization records, as the label "worker_pool_utilization",
+// the fraction of a worker pool's workers that are busy, given the number
+// of busy workers and the size of the pool. This should be called when
+// processing starts. If size is not positive, SetWorkerPoolUtilization
+// does nothing.
+func (c *Context) SetWorkerPoolUtilization(busy, size int) {
+	if size <= 0 {
+		return
+	}
+	c.SetLabel(WorkerPoolUtilizationLabel, float64(busy)/float64(size))
+}
+
+// SetMessageQueueName sets the name of the message queue from which
+// the message being processed was received.
+func (c *Context) SetMessageQueueName(name string) {
+	c.messageQueue.Name = truncateString(name)
+	c.message.Queue = &c.messageQueue
+	c.model.Message = &c.message
+}
+
+// SetMessageAge sets the age of the message being processed, i.e. the
+// amount of time the message spent waiting in a queue before it was
+// received.
+//
+// If the messaging system provides the time at which the message was
+// enqueued, the age can be recorded by calling
+// SetMessageAge(time.Since(enqueued)) when the message is received.
+// Negative durations, e.g. due to clock skew between the sender and
+// receiver, are recorded as zero.
+func (c *Context) SetMessageAge(age time.Duration) {
+	if age < 0 {
+		age = 0
+	}
+	c.messageAge.Milliseconds = int64(age / time.Millisecond)
+	c.message.Age = &c.messageAge
+	c.model.Message = &c.message
+}
@@ -19,7 +19,9 @@ package apm_test
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -67,6 +69,20 @@ func TestContextUser(t *testing.T) {
 		})
 		assert.Equal(t, &model.User{ID: "123"}, tx.Context.User)
 	})
+	t.Run("session", func(t *testing.T) {
+		tx := testSendTransaction(t, func(tx *apm.Transaction) {
+			tx.Context.SetUserSession(" abc123 ")
+		})
+		assert.Equal(t, &model.TransactionSession{ID: "abc123"}, tx.Session)
+		assert.Nil(t, tx.Context)
+	})
+	t.Run("session_truncated", func(t *testing.T) {
+		tx := testSendTransaction(t, func(tx *apm.Transaction) {
+			tx.Context.SetUserSession(strings.Repeat("x", 2000))
+		})
+		require.NotNil(t, tx.Session)
+		assert.Len(t, tx.Session.ID, 1024)
+	})
 }
 
 func TestContextFramework(t *testing.T) {
@@ -119,6 +135,74 @@ func TestContextCustom(t *testing.T) {
 	}, tx.Context.Custom)
 }
 
+func TestContextCustomNested(t *testing.T) {
+	nested := map[string]interface{}{
+		"a.b": "c",
+		"list": []interface{}{
+			map[string]string{"d*e": "f"},
+		},
+		"map": map[string]interface{}{
+			`g"h`: 1.0,
+		},
+	}
+	tx := testSendTransaction(t, func(tx *apm.Transaction) {
+		tx.Context.SetCustom("ns", nested)
+	})
+	require.NotNil(t, tx.Context)
+	assert.Equal(t, model.IfaceMap{{
+		Key: "ns",
+		Value: map[string]interface{}{
+			"a_b": "c",
+			"list": []interface{}{
+				map[string]interface{}{"d_e": "f"},
+			},
+			"map": map[string]interface{}{
+				"g_h": 1.0,
+			},
+		},
+	}}, tx.Context.Custom)
+
+	// The original map should not be modified.
+	assert.Contains(t, nested, "a.b")
+}
+
+func TestContextMessage(t *testing.T) {
+	tx := testSendTransaction(t, func(tx *apm.Transaction) {
+		tx.Context.SetMessageQueueName("orders")
+		tx.Context.SetMessageAge(1500 * time.Millisecond)
+	})
+	require.NotNil(t, tx.Context)
+	assert.Equal(t, &model.MessageContext{
+		Queue: &model.MessageQueueContext{Name: "orders"},
+		Age:   &model.MessageAgeContext{Milliseconds: 1500},
+	}, tx.Context.Message)
+
+	tx = testSendTransaction(t, func(tx *apm.Transaction) {
+		tx.Context.SetMessageAge(-time.Second)
+	})
+	require.NotNil(t, tx.Context)
+	assert.Equal(t, &model.MessageContext{
+		Age: &model.MessageAgeContext{Milliseconds: 0},
+	}, tx.Context.Message)
+}
+
+func TestContextQueueDepth(t *testing.T) {
+	tx := testSendTransaction(t, func(tx *apm.Transaction) {
+		tx.Context.SetQueueDepth(42)
+		tx.Context.SetWorkerPoolUtilization(1, 4)
+	})
+	require.NotNil(t, tx.Context)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "queue_depth", Value: float64(42)},
+		{Key: "worker_pool_utilization", Value: 0.25},
+	}, tx.Context.Tags)
+
+	tx = testSendTransaction(t, func(tx *apm.Transaction) {
+		tx.Context.SetWorkerPoolUtilization(0, 0)
+	})
+	assert.Nil(t, tx.Context)
+}
+
 func testSendTransaction(t *testing.T, f func(tx *apm.Transaction)) model.Transaction {
 	transaction, _, _ := apmtest.WithTransaction(func(ctx context.Context) {
 		f(apm.TransactionFromContext(ctx))
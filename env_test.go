@@ -204,17 +204,29 @@ func TestTracerServiceNameEnvSanitizationExecutableName(t *testing.T) {
 
 func TestTracerGlobalLabelsUnspecified(t *testing.T) {
 	_, _, _, labels := getSubprocessMetadata(t)
-	assert.Equal(t, model.StringMap{}, labels)
+	assert.Equal(t, model.StringMap{}, withoutBuildLabels(labels))
 }
 
 func TestTracerGlobalLabelsSpecified(t *testing.T) {
 	_, _, _, labels := getSubprocessMetadata(t, "ELASTIC_APM_GLOBAL_LABELS=a=b,c = d")
-	assert.Equal(t, model.StringMap{{Key: "a", Value: "b"}, {Key: "c", Value: "d"}}, labels)
+	assert.Equal(t, model.StringMap{{Key: "a", Value: "b"}, {Key: "c", Value: "d"}}, withoutBuildLabels(labels))
 }
 
 func TestTracerGlobalLabelsIgnoreInvalid(t *testing.T) {
 	_, _, _, labels := getSubprocessMetadata(t, "ELASTIC_APM_GLOBAL_LABELS=a,=,b==c,d=")
-	assert.Equal(t, model.StringMap{{Key: "b", Value: "=c"}, {Key: "d", Value: ""}}, labels)
+	assert.Equal(t, model.StringMap{{Key: "b", Value: "=c"}, {Key: "d", Value: ""}}, withoutBuildLabels(labels))
+}
+
+// withoutBuildLabels returns labels without the "go_build_"
+// labels describing the test binary's build settings.
+func withoutBuildLabels(labels model.StringMap) model.StringMap {
+	out := model.StringMap{}
+	for _, item := range labels {
+		if !strings.HasPrefix(item.Key, "go_build_") {
+			out = append(out, item)
+		}
+	}
+	return out
 }
 
 func TestTracerCaptureBodyEnv(t *testing.T) {
@@ -411,3 +423,28 @@ func testUseElasticTraceparentHeader(t *testing.T, envValue string, expectPropag
 	tx.Discard()
 	assert.Equal(t, expectPropagate, propagate)
 }
+
+func TestTracerNormalizeTransactionNamesEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_NORMALIZE_TRANSACTION_NAMES", "true")
+	defer os.Unsetenv("ELASTIC_APM_NORMALIZE_TRANSACTION_NAMES")
+
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.StartTransaction("delete  /Users", "type").End()
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, "DELETE /Users", payloads.Transactions[0].Name)
+}
+
+func TestTracerSpanCountLabelsEnv(t *testing.T) {
+	os.Setenv("ELASTIC_APM_SPAN_COUNT_LABELS", "true")
+	defer os.Unsetenv("ELASTIC_APM_SPAN_COUNT_LABELS")
+
+	tx, _, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		span, _ := apm.StartSpan(ctx, "name", "db.mysql.query")
+		span.End()
+	})
+	assert.Equal(t, model.IfaceMap{{Key: "db_calls", Value: float64(1)}}, tx.Context.Tags)
+}
@@ -154,6 +154,22 @@ func (t *Tracer) newError() *Error {
 	return &Error{ErrorData: e}
 }
 
+// Error severity levels, for use with Error.SetLevel.
+const (
+	// ErrorLevelWarning is the level for errors which do not affect
+	// the correct functioning of the service, but may warrant attention.
+	ErrorLevelWarning = "warning"
+
+	// ErrorLevelError is the level for errors which affect an operation,
+	// such as a request, without affecting the service as a whole.
+	// This is the default level.
+	ErrorLevelError = "error"
+
+	// ErrorLevelCritical is the level for errors which affect the
+	// service as a whole, such as fatal errors and panics.
+	ErrorLevelCritical = "critical"
+)
+
 // Error describes an error occurring in the monitored service.
 type Error struct {
 	// ErrorData holds the error data. This field is set to nil when
@@ -522,6 +538,31 @@ func (e *Error) SetStacktrace(skip int) {
 	*out = stacktrace.AppendStacktrace((*out)[:0], skip+1, e.stackTraceLimit)
 }
 
+// SetLevel sets the severity level of the error, such as ErrorLevelWarning,
+// ErrorLevelError, or ErrorLevelCritical, so that errors of different
+// severities can be distinguished. The level is reported as the error's
+// log level.
+//
+// Errors created by NewErrorLog take their level from the ErrorLogRecord,
+// and SetLevel will replace it. If SetLevel is not called for other errors,
+// then no level will be reported, and Level will return ErrorLevelError.
+func (e *Error) SetLevel(level string) {
+	if e == nil || e.sent() || !e.recording {
+		return
+	}
+	e.log.Level = truncateString(level)
+}
+
+// Level returns the severity level of the error, as set by SetLevel or
+// taken from the ErrorLogRecord passed to NewErrorLog. If no level has
+// been set, Level returns ErrorLevelError.
+func (e *Error) Level() string {
+	if e == nil || e.sent() || e.log.Level == "" {
+		return ErrorLevelError
+	}
+	return e.log.Level
+}
+
 // ErrorLogRecord holds details of an error log record.
 type ErrorLogRecord struct {
 	// Message holds the message for the log record,
@@ -274,6 +274,43 @@ func TestErrorLogRecord(t *testing.T) {
 	assert.Equal(t, "makeError", err0.Culprit) // based on exception stacktrace
 }
 
+func TestErrorLevel(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := apm.ContextWithTransaction(context.Background(), tx)
+	captured := apm.CaptureError(ctx, errors.New("captured"))
+	assert.Equal(t, apm.ErrorLevelError, captured.Level())
+	captured.Send()
+
+	warning := tracer.NewError(errors.New("warning"))
+	warning.SetLevel(apm.ErrorLevelWarning)
+	assert.Equal(t, apm.ErrorLevelWarning, warning.Level())
+	warning.Send()
+
+	logged := tracer.NewErrorLog(apm.ErrorLogRecord{Message: "log-message", Level: "error"})
+	logged.SetLevel(apm.ErrorLevelCritical)
+	logged.Send()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := recorder.Payloads()
+	require.Len(t, payloads.Errors, 3)
+
+	// No level is reported unless it has been set explicitly.
+	assert.Equal(t, model.Log{}, payloads.Errors[0].Log)
+	assert.Equal(t, model.Log{Message: "warning", Level: "warning"}, payloads.Errors[1].Log)
+	assert.Equal(t, "warning", payloads.Errors[1].Exception.Message)
+	assert.Equal(t, "log-message", payloads.Errors[2].Log.Message)
+	assert.Equal(t, "critical", payloads.Errors[2].Log.Level)
+
+	// Level returns the default for an Error with nil ErrorData.
+	e := apm.CaptureError(context.Background(), errors.New("boom"))
+	e.SetLevel(apm.ErrorLevelWarning)
+	assert.Equal(t, apm.ErrorLevelError, e.Level())
+}
+
 func TestErrorCauserInterface(t *testing.T) {
 	type Causer interface {
 		Cause() error
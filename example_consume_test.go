@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"context"
+	"time"
+
+	"go.elastic.co/apm"
+)
+
+// queue is a stand-in for a message queue client, such as
+// a Kafka consumer or an SQS client.
+type queue interface {
+	// Receive waits up to the given duration for a message
+	// to arrive, returning nil if none arrives.
+	Receive(ctx context.Context, wait time.Duration) ([]byte, error)
+
+	// Ack acknowledges receipt of a message.
+	Ack(ctx context.Context, msg []byte) error
+}
+
+func ExampleTracer_ConsumeLoop() {
+	var ctx context.Context // canceled when the consumer should stop
+	var q queue
+
+	process := func(ctx context.Context, msg []byte) error {
+		// Process the message, starting spans from ctx.
+		span, _ := apm.StartSpan(ctx, "process", "app")
+		defer span.End()
+		return nil
+	}
+
+	// Each message is processed in its own transaction. Returning
+	// an error sets the transaction's outcome to "failure", and
+	// reports the error; the loop continues with the next message.
+	apm.DefaultTracer.ConsumeLoop(ctx, "orders", func(ctx context.Context) error {
+		msg, err := q.Receive(ctx, 20*time.Second)
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			// Nothing was received, so discard the transaction.
+			return apm.ErrNoMessage
+		}
+		if err := process(ctx, msg); err != nil {
+			return err
+		}
+		return q.Ack(ctx, msg)
+	})
+}
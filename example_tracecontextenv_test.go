@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"go.elastic.co/apm"
+)
+
+func ExampleInjectTraceContextEnv() {
+	// In the parent process, propagate the trace context
+	// to the child process through its environment.
+	tx := apm.DefaultTracer.StartTransactionOptions("build", "task", apm.TransactionOptions{
+		TraceContext: apm.TraceContext{
+			Trace:   apm.TraceID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+			Span:    apm.SpanID{0, 1, 2, 3, 4, 5, 6, 7},
+			Options: apm.TraceOptions(0).WithRecorded(true),
+		},
+	})
+	defer tx.Discard()
+	ctx := apm.ContextWithTransaction(context.Background(), tx)
+
+	cmd := exec.CommandContext(ctx, "go", "vet", "./...")
+	cmd.Env = apm.InjectTraceContextEnv(ctx, os.Environ())
+
+	// Simulate starting the child process with the command's environment.
+	for _, kv := range cmd.Env {
+		if strings.HasPrefix(kv, apm.TraceparentEnv+"=") {
+			os.Setenv(apm.TraceparentEnv, kv[len(apm.TraceparentEnv)+1:])
+			defer os.Unsetenv(apm.TraceparentEnv)
+		}
+	}
+
+	// In the child process, continue the parent's trace.
+	traceContext, ok := apm.ExtractTraceContextEnv()
+	if !ok {
+		panic("no trace context in environment")
+	}
+	childTx := apm.DefaultTracer.StartTransactionOptions("vet", "task", apm.TransactionOptions{
+		TraceContext: traceContext,
+	})
+	defer childTx.Discard()
+
+	fmt.Println(childTx.TraceContext().Trace)
+	fmt.Println(traceContext.Span == tx.TraceContext().Span)
+
+	// Output:
+	// 000102030405060708090a0b0c0d0e0f
+	// true
+}
@@ -38,6 +38,12 @@ func ContextWithTransaction(parent context.Context, t *Transaction) context.Cont
 // SpanFromContext returns the current Span in context, if any. The span must
 // have been added to the context previously using ContextWithSpan, or the
 // top-level StartSpan function.
+//
+// If spans have been nested, SpanFromContext returns the innermost span.
+// SpanFromContext does not return the context's transaction: if the context
+// contains a transaction but no span, SpanFromContext returns nil. Callers
+// wishing to annotate whichever of the two is active should fall back to
+// TransactionFromContext.
 func SpanFromContext(ctx context.Context) *Span {
 	value, _ := apmcontext.SpanFromContext(ctx).(*Span)
 	return value
@@ -57,6 +63,11 @@ func TransactionFromContext(ctx context.Context) *Transaction {
 // DetachedContext can be used to maintain the trace context required
 // to correlate events, but where the operation is "fire-and-forget",
 // and should not be affected by the deadline or cancellation of ctx.
+//
+// Work that may outlive the transaction in ctx, e.g. work continuing
+// after an HTTP handler has responded, should be reported as a separate
+// transaction, using the TraceContext of the transaction in ctx as its
+// parent, so that it joins the same trace.
 func DetachedContext(ctx context.Context) context.Context {
 	return &detachedContext{Context: context.Background(), orig: ctx}
 }
@@ -30,6 +30,7 @@ import (
 	"go.elastic.co/apm"
 	"go.elastic.co/apm/apmtest"
 	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/transport/transporttest"
 )
 
 func TestContextStartSpanTransactionEnded(t *testing.T) {
@@ -78,6 +79,29 @@ func TestContextStartSpanSpanEnded(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSpanFromContext(t *testing.T) {
+	tracer := apmtest.DiscardTracer
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.End()
+
+	ctx := context.Background()
+	assert.Nil(t, apm.SpanFromContext(ctx))
+
+	// The transaction is never returned by SpanFromContext.
+	ctx = apm.ContextWithTransaction(ctx, tx)
+	assert.Nil(t, apm.SpanFromContext(ctx))
+
+	outer, outerCtx := apm.StartSpan(ctx, "outer", "type")
+	defer outer.End()
+	assert.Equal(t, outer, apm.SpanFromContext(outerCtx))
+
+	inner, innerCtx := apm.StartSpan(outerCtx, "inner", "type")
+	defer inner.End()
+	assert.Equal(t, inner, apm.SpanFromContext(innerCtx))
+	assert.Equal(t, outer, apm.SpanFromContext(outerCtx))
+	assert.Nil(t, apm.SpanFromContext(ctx))
+}
+
 func TestContextStartSpanOptions(t *testing.T) {
 	txTimestamp := time.Now().Add(-time.Hour)
 	tx, spans, _ := apmtest.WithTransactionOptions(apm.TransactionOptions{
@@ -173,3 +197,60 @@ func TestDetachedContext(t *testing.T) {
 		assert.Equal(t, tx.TraceID, span.TraceID)
 	}
 }
+
+func TestDetachedContextBackgroundTransaction(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	handlerDone := make(chan struct{})
+	done := make(chan struct{})
+	func() {
+		// Simulate a request handler, which starts some background
+		// work and returns before the work completes.
+		tx := tracer.StartTransaction("request", "request")
+		defer tx.End()
+		ctx, cancel := context.WithCancel(apm.ContextWithTransaction(context.Background(), tx))
+		defer cancel()
+		span, ctx := apm.StartSpan(ctx, "handler", "app")
+		defer span.End()
+
+		ctx = apm.DetachedContext(ctx)
+		go func() {
+			defer close(done)
+			// Wait for the handler's transaction to end, and its
+			// context to be canceled, before continuing.
+			<-handlerDone
+			assert.NoError(t, ctx.Err())
+
+			// Report the background work as a separate transaction
+			// in the same trace, and clear the handler's span from
+			// the context so new spans are children of bgTx.
+			bgTx := tracer.StartTransactionOptions("background", "background", apm.TransactionOptions{
+				TraceContext: apm.TransactionFromContext(ctx).TraceContext(),
+			})
+			defer bgTx.End()
+			ctx := apm.ContextWithSpan(apm.ContextWithTransaction(ctx, bgTx), nil)
+			bgSpan, _ := apm.StartSpan(ctx, "send_email", "external")
+			bgSpan.End()
+		}()
+	}()
+	close(handlerDone)
+	<-done
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	require.Len(t, payloads.Spans, 2)
+	tx, bgTx := payloads.Transactions[0], payloads.Transactions[1]
+	handlerSpan, bgSpan := payloads.Spans[0], payloads.Spans[1]
+	assert.Equal(t, "request", tx.Name)
+	assert.Equal(t, "background", bgTx.Name)
+	assert.Equal(t, "handler", handlerSpan.Name)
+	assert.Equal(t, "send_email", bgSpan.Name)
+
+	assert.Equal(t, tx.TraceID, bgTx.TraceID)
+	assert.Equal(t, tx.ID, bgTx.ParentID)
+	assert.Equal(t, tx.TraceID, bgSpan.TraceID)
+	assert.Equal(t, bgTx.ID, bgSpan.ParentID)
+	assert.Equal(t, bgTx.ID, bgSpan.TransactionID)
+}
@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"math"
+	"time"
+
+	"go.elastic.co/apm/model"
+)
+
+// Transactions are reported to the APM Server only once they are ended,
+// and the intake API does not support partial transactions. Heartbeats
+// are therefore reported as metricsets, associated with the transaction
+// by its name and type, and by trace_id and transaction_id labels.
+
+const (
+	// HeartbeatElapsedMetric is the name of the heartbeat metric which
+	// holds the time elapsed since the transaction started, in microseconds.
+	HeartbeatElapsedMetric = "transaction.heartbeat.elapsed.us"
+
+	// HeartbeatSpansMetric is the name of the heartbeat metric which holds
+	// the number of spans started within the transaction so far.
+	HeartbeatSpansMetric = "transaction.heartbeat.span_count.started"
+)
+
+// Heartbeat reports the progress of the transaction, so that long-running
+// transactions, such as database migrations or other one-shot tasks, are
+// visible before they end, and are not lost entirely if the process exits
+// before they do.
+//
+// A heartbeat is reported as a metricset holding the transaction's name and
+// type, its trace and transaction IDs as the labels "trace_id" and
+// "transaction_id", and the metrics HeartbeatElapsedMetric and
+// HeartbeatSpansMetric. Heartbeats are sent to the APM Server promptly,
+// rather than waiting for the request buffer to fill up.
+//
+// Heartbeat has no effect if the transaction has ended, or is not being
+// recorded. To report heartbeats periodically, set
+// TransactionOptions.HeartbeatInterval when starting the transaction.
+func (tx *Transaction) Heartbeat() {
+	if tx == nil {
+		return
+	}
+	tx.mu.RLock()
+	defer tx.mu.RUnlock()
+	if tx.ended() {
+		return
+	}
+	tx.sendHeartbeat(tx.Name, tx.Type)
+}
+
+// startHeartbeatTimer starts a timer for reporting heartbeats
+// for tx at the given interval, if positive.
+//
+// This must be called before tx is returned to the caller.
+func (tx *Transaction) startHeartbeatTimer(interval time.Duration) {
+	if interval <= 0 || !tx.recording {
+		return
+	}
+	// Capture the transaction details now, as the transaction
+	// data may be modified concurrently when the timer fires.
+	name, transactionType := tx.Name, tx.Type
+	timer := time.AfterFunc(time.Duration(math.MaxInt64), func() {
+		tx.mu.RLock()
+		defer tx.mu.RUnlock()
+		if tx.ended() {
+			return
+		}
+		tx.sendHeartbeat(name, transactionType)
+		tx.heartbeatTimer.Reset(interval)
+	})
+	tx.heartbeatTimer = timer
+	timer.Reset(interval)
+}
+
+// sendHeartbeat enqueues a heartbeat metricset for tx.
+//
+// This must be called with tx.mu held, and tx not ended.
+func (tx *Transaction) sendHeartbeat(name, transactionType string) {
+	if !tx.recording {
+		return
+	}
+	now := time.Now()
+	tx.TransactionData.mu.Lock()
+	spansCreated := tx.spansCreated
+	tx.TransactionData.mu.Unlock()
+
+	event := tracerEvent{eventType: metricsetEvent}
+	event.metricset = &model.Metrics{
+		Timestamp: model.Time(now.UTC()),
+		Transaction: model.MetricsTransaction{
+			Name: truncateString(name),
+			Type: truncateString(transactionType),
+		},
+		Labels: model.StringMap{
+			{Key: "trace_id", Value: tx.traceContext.Trace.String()},
+			{Key: "transaction_id", Value: tx.traceContext.Span.String()},
+		},
+		Samples: map[string]model.Metric{
+			HeartbeatElapsedMetric: {Value: float64(now.Sub(tx.timestamp) / time.Microsecond)},
+			HeartbeatSpansMetric:   {Value: float64(spansCreated)},
+		},
+	}
+	select {
+	case tx.tracer.events <- event:
+	default:
+		// Enqueuing a heartbeat should never block.
+	}
+}
@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
+)
+
+func TestTransactionHeartbeat(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("migrate", "task")
+	tx.StartSpan("step 1", "db", nil).End()
+	tx.Heartbeat()
+	tx.StartSpan("step 2", "db", nil).End()
+	tx.Heartbeat()
+	tx.End()
+	tx.Heartbeat() // no effect after End
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	heartbeats := heartbeatMetrics(payloads.Metrics)
+	require.Len(t, heartbeats, 2)
+	for i, m := range heartbeats {
+		assert.Equal(t, model.MetricsTransaction{Name: "migrate", Type: "task"}, m.Transaction)
+		assert.Equal(t, model.StringMap{
+			{Key: "trace_id", Value: apm.TraceID(payloads.Transactions[0].TraceID).String()},
+			{Key: "transaction_id", Value: apm.SpanID(payloads.Transactions[0].ID).String()},
+		}, m.Labels)
+		assert.Equal(t, float64(i+1), m.Samples[apm.HeartbeatSpansMetric].Value)
+		assert.Contains(t, m.Samples, apm.HeartbeatElapsedMetric)
+	}
+}
+
+func TestTransactionHeartbeatInterval(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	// Simulate a long-running task, which reports
+	// heartbeats periodically until it is ended.
+	tx := tracer.StartTransactionOptions("migrate", "task", apm.TransactionOptions{
+		HeartbeatInterval: 10 * time.Millisecond,
+	})
+	for i := 0; i < 5; i++ {
+		tx.StartSpan("step", "db", nil).End()
+		time.Sleep(20 * time.Millisecond)
+	}
+	tx.End()
+	tracer.Flush(nil)
+	numHeartbeats := len(heartbeatMetrics(tracer.Payloads().Metrics))
+	assert.NotZero(t, numHeartbeats)
+
+	// No more heartbeats are reported after the transaction ends.
+	time.Sleep(50 * time.Millisecond)
+	tracer.Flush(nil)
+	assert.Len(t, heartbeatMetrics(tracer.Payloads().Metrics), numHeartbeats)
+
+	var elapsed []float64
+	for _, m := range heartbeatMetrics(tracer.Payloads().Metrics) {
+		elapsed = append(elapsed, m.Samples[apm.HeartbeatElapsedMetric].Value)
+	}
+	for i := 1; i < len(elapsed); i++ {
+		assert.True(t, elapsed[i] > elapsed[i-1], "%v", elapsed)
+	}
+}
+
+func TestTransactionHeartbeatNotRecording(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.SetRecording(false)
+
+	tx := tracer.StartTransactionOptions("migrate", "task", apm.TransactionOptions{
+		HeartbeatInterval: time.Millisecond,
+	})
+	tx.Heartbeat()
+	time.Sleep(10 * time.Millisecond)
+	tx.End()
+	tracer.Flush(nil)
+	assert.Empty(t, heartbeatMetrics(tracer.Payloads().Metrics))
+}
+
+func heartbeatMetrics(metrics []model.Metrics) []model.Metrics {
+	var heartbeats []model.Metrics
+	for _, m := range metrics {
+		if _, ok := m.Samples[apm.HeartbeatElapsedMetric]; ok {
+			heartbeats = append(heartbeats, m)
+		}
+	}
+	return heartbeats
+}
@@ -0,0 +1,133 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync/atomic"
+
+	"go.elastic.co/apm/model"
+)
+
+// Histogram records the distribution of observed values, such as
+// latencies or sizes, in a fixed set of buckets.
+//
+// Histogram implements MetricsGatherer. The values observed since
+// the previous gathering are reported as a histogram metric each
+// time metrics are gathered, so a Histogram must be registered with
+// a Tracer using Tracer.RegisterMetricsGatherer for its values to be
+// reported. Nothing is reported for an interval in which no values
+// were observed.
+//
+// Histogram methods are safe for concurrent use.
+type Histogram struct {
+	name   string
+	labels []MetricLabel
+	bounds []float64
+	values []float64
+
+	// counts holds the bucket counts, accessed atomically. There is
+	// one more count than bounds: the final count is for observations
+	// exceeding the greatest bound.
+	counts []uint64
+}
+
+// NewHistogram returns a new Histogram with the given metric name,
+// labels, and bucket upper bounds.
+//
+// Each value observed is counted in the first bucket whose upper bound
+// is greater than or equal to the value; values greater than all bounds
+// are counted in an additional, unbounded bucket. The buckets are
+// reported using a representative value for each: the midpoint between
+// the bucket's lower and upper bounds, or for the first bucket, half its
+// upper bound (if positive). Observations in the unbounded bucket are
+// reported with the greatest bound.
+//
+// NewHistogram will panic if bounds is empty, or is not in strictly
+// increasing order.
+func NewHistogram(name string, labels []MetricLabel, bounds []float64) *Histogram {
+	if len(bounds) == 0 {
+		panic("bounds is empty")
+	}
+	for i := 1; i < len(bounds); i++ {
+		if !(bounds[i] > bounds[i-1]) {
+			panic("bounds must be in strictly increasing order")
+		}
+	}
+	h := &Histogram{
+		name:   name,
+		labels: make([]MetricLabel, len(labels)),
+		bounds: make([]float64, len(bounds)),
+		values: make([]float64, len(bounds)+1),
+		counts: make([]uint64, len(bounds)+1),
+	}
+	copy(h.labels, labels)
+	sort.Slice(h.labels, func(i, j int) bool {
+		return h.labels[i].Name < h.labels[j].Name
+	})
+	copy(h.bounds, bounds)
+	for i := range h.values {
+		switch {
+		case i == 0:
+			h.values[i] = bounds[0]
+			if h.values[i] > 0 {
+				h.values[i] /= 2
+			}
+		case i == len(bounds):
+			h.values[i] = bounds[i-1]
+		default:
+			h.values[i] = bounds[i-1] + (bounds[i]-bounds[i-1])/2
+		}
+	}
+	return h
+}
+
+// Observe records an observation of value v. NaN values are ignored.
+func (h *Histogram) Observe(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	i := sort.SearchFloat64s(h.bounds, v)
+	atomic.AddUint64(&h.counts[i], 1)
+}
+
+// GatherMetrics adds a histogram metric to m, holding the values
+// observed since the last call to GatherMetrics, and resets the
+// bucket counts.
+func (h *Histogram) GatherMetrics(ctx context.Context, m *Metrics) error {
+	var values []float64
+	var counts []uint64
+	for i := range h.counts {
+		// Empty buckets are omitted.
+		if count := atomic.SwapUint64(&h.counts[i], 0); count > 0 {
+			values = append(values, h.values[i])
+			counts = append(counts, count)
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	m.addMetric(h.name, h.labels, model.Metric{
+		Type:   "histogram",
+		Values: values,
+		Counts: counts,
+	})
+	return nil
+}
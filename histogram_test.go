@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestHistogram(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	histogram := apm.NewHistogram("request.size", []apm.MetricLabel{
+		{Name: "b", Value: "2"},
+		{Name: "a", Value: "1"},
+	}, []float64{10, 20, 40})
+	unregister := tracer.RegisterMetricsGatherer(histogram)
+	defer unregister()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			histogram.Observe(5)   // first bucket
+			histogram.Observe(10)  // first bucket (inclusive upper bound)
+			histogram.Observe(100) // unbounded bucket
+			histogram.Observe(math.NaN())
+		}()
+	}
+	wg.Wait()
+	tracer.SendMetrics(nil)
+
+	// No values were observed in the second interval,
+	// so the histogram should not be reported again.
+	tracer.SendMetrics(nil)
+
+	histogram.Observe(25)
+	tracer.SendMetrics(nil)
+
+	payloads := transport.Payloads()
+	var samples []model.Metric
+	for _, m := range payloads.Metrics {
+		if sample, ok := m.Samples["request.size"]; ok {
+			assert.Equal(t, model.StringMap{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}, m.Labels)
+			samples = append(samples, sample)
+		}
+	}
+	require.Len(t, samples, 2)
+	assert.Equal(t, model.Metric{
+		Type:   "histogram",
+		Values: []float64{5, 40},
+		Counts: []uint64{20, 10},
+	}, samples[0])
+	assert.Equal(t, model.Metric{
+		Type:   "histogram",
+		Values: []float64{30},
+		Counts: []uint64{1},
+	}, samples[1])
+}
+
+func TestHistogramInvalidBounds(t *testing.T) {
+	assert.Panics(t, func() { apm.NewHistogram("name", nil, nil) })
+	assert.Panics(t, func() { apm.NewHistogram("name", nil, []float64{1, 1}) })
+	assert.Panics(t, func() { apm.NewHistogram("name", nil, []float64{2, 1}) })
+	assert.NotPanics(t, func() { apm.NewHistogram("name", nil, []float64{-1, 0, 1}) })
+}
@@ -32,7 +32,9 @@ import (
 // sanitized, but no further processing performed. For all other
 // requests (i.e. most server-side requests), we reconstruct the
 // URL based on various proxy forwarding headers and other request
-// attributes.
+// attributes. If the request has no Host header, which is permitted
+// for HTTP/1.0 requests, the server's local address is used instead;
+// if that is also unknown, the hostname is left empty.
 func RequestURL(req *http.Request) model.URL {
 	out := model.URL{
 		Path:   truncateString(req.URL.Path),
@@ -59,8 +61,15 @@ func RequestURL(req *http.Request) model.URL {
 		out.Protocol = truncateString(forwarded.Proto)
 	} else if xfh := req.Header.Get("X-Forwarded-Host"); xfh != "" {
 		fullHost = xfh
-	} else {
+	} else if req.Host != "" {
 		fullHost = req.Host
+	} else {
+		// HTTP/1.0 clients may not send a Host header. Fall back
+		// to the address on which the server received the request,
+		// if known, so the URL is still meaningful.
+		if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr != nil {
+			fullHost = addr.String()
+		}
 	}
 	hostname, port := splitHost(fullHost)
 	out.Hostname = truncateString(hostname)
@@ -18,8 +18,10 @@
 package apmhttputil_test
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"net"
 	"net/http"
 	"testing"
 
@@ -62,6 +64,27 @@ func TestRequestURLServerTLS(t *testing.T) {
 	assert.Equal(t, "https", apmhttputil.RequestURL(req).Protocol)
 }
 
+func TestRequestURLServerNoHost(t *testing.T) {
+	req := mustNewRequest("/path")
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/1.0", 1, 0
+	req.Host = ""
+	assert.Equal(t, model.URL{
+		Protocol: "http",
+		Path:     "/path",
+	}, apmhttputil.RequestURL(req))
+
+	// If the server's local address is known, it is used in place
+	// of the missing Host header.
+	localAddr := &net.TCPAddr{IP: net.IPv6loopback, Port: 8080}
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, localAddr))
+	assert.Equal(t, model.URL{
+		Protocol: "http",
+		Hostname: "::1",
+		Port:     "8080",
+		Path:     "/path",
+	}, apmhttputil.RequestURL(req))
+}
+
 func TestRequestURLHeaders(t *testing.T) {
 	type test struct {
 		name   string
@@ -24,6 +24,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.elastic.co/fastjson"
@@ -74,7 +75,7 @@ func initDefaultLogger() {
 			logLevel = level
 		}
 	}
-	DefaultLogger = levelLogger{w: logWriter, level: logLevel}
+	DefaultLogger = newLevelLogger(logWriter, logLevel)
 }
 
 const (
@@ -103,18 +104,30 @@ func (l logLevel) String() string {
 
 func parseLogLevel(s string) (logLevel, error) {
 	switch strings.ToLower(s) {
-	case "debug":
+	case "trace", "debug":
 		return debugLevel, nil
 	case "info":
 		return infoLevel, nil
-	case "warn":
+	case "warn", "warning":
 		return warnLevel, nil
-	case "error":
+	case "error", "critical":
 		return errorLevel, nil
+	case "off":
+		return noLevel, nil
 	}
 	return noLevel, fmt.Errorf("invalid log level string %q", s)
 }
 
+// ValidateLevel returns an error if level is not a valid log level.
+//
+// Valid log levels are "trace", "debug", "info", "warn", "warning",
+// "error", "critical", and "off", in any case. The "trace" and
+// "critical" levels are equivalent to "debug" and "error" respectively.
+func ValidateLevel(level string) error {
+	_, err := parseLogLevel(level)
+	return err
+}
+
 // Logger provides methods for logging.
 type Logger interface {
 	Debugf(format string, args ...interface{})
@@ -122,28 +135,55 @@ type Logger interface {
 	Warningf(format string, args ...interface{})
 }
 
+// LevelSetter is implemented by Loggers whose minimum log level can be
+// changed at runtime, such as DefaultLogger.
+type LevelSetter interface {
+	// SetLevel sets the minimum level of messages to log. If level is
+	// empty, the initial level is restored. See ValidateLevel for the
+	// valid log levels.
+	SetLevel(level string) error
+}
+
 type levelLogger struct {
-	w     io.Writer
-	level logLevel
+	w       io.Writer
+	level   uint32 // logLevel, accessed atomically
+	initial logLevel
+}
+
+func newLevelLogger(w io.Writer, level logLevel) *levelLogger {
+	return &levelLogger{w: w, level: uint32(level), initial: level}
+}
+
+// SetLevel sets the minimum level of messages to log.
+func (l *levelLogger) SetLevel(level string) error {
+	newLevel := l.initial
+	if level != "" {
+		var err error
+		if newLevel, err = parseLogLevel(level); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint32(&l.level, uint32(newLevel))
+	return nil
 }
 
 // Debugf logs a message with log.Printf, with a DEBUG prefix.
-func (l levelLogger) Debugf(format string, args ...interface{}) {
+func (l *levelLogger) Debugf(format string, args ...interface{}) {
 	l.logf(debugLevel, format, args...)
 }
 
 // Errorf logs a message with log.Printf, with an ERROR prefix.
-func (l levelLogger) Errorf(format string, args ...interface{}) {
+func (l *levelLogger) Errorf(format string, args ...interface{}) {
 	l.logf(errorLevel, format, args...)
 }
 
 // Warningf logs a message with log.Printf, with a WARNING prefix.
-func (l levelLogger) Warningf(format string, args ...interface{}) {
+func (l *levelLogger) Warningf(format string, args ...interface{}) {
 	l.logf(warnLevel, format, args...)
 }
 
-func (l levelLogger) logf(level logLevel, format string, args ...interface{}) {
-	if level < l.level {
+func (l *levelLogger) logf(level logLevel, format string, args ...interface{}) {
+	if level < logLevel(atomic.LoadUint32(&l.level)) {
 		return
 	}
 	jw := fastjsonPool.Get().(*fastjson.Writer)
@@ -161,6 +161,30 @@ func TestInitDefaultLoggerLevel(t *testing.T) {
 		string(data))
 }
 
+func TestLevelLoggerSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLevelLogger(&buf, errorLevel)
+	var _ LevelSetter = logger
+
+	logger.Debugf("hidden")
+	require.NoError(t, logger.SetLevel("TRACE"))
+	logger.Debugf("debug message")
+	require.NoError(t, logger.SetLevel("off"))
+	logger.Errorf("hidden")
+	require.NoError(t, logger.SetLevel(""))
+	logger.Warningf("hidden")
+	logger.Errorf("error message")
+
+	assert.EqualError(t, logger.SetLevel("panic"), `invalid log level string "panic"`)
+	logger.Errorf("still error")
+
+	assert.Regexp(t, `
+{"level":"debug","time":".*","message":"debug message"}
+{"level":"error","time":".*","message":"error message"}
+{"level":"error","time":".*","message":"still error"}
+$`[1:], buf.String())
+}
+
 func BenchmarkDefaultLogger(b *testing.B) {
 	dir, err := ioutil.TempDir("", "")
 	require.NoError(b, err)
@@ -17,6 +17,8 @@
 
 package apm
 
+import "go.elastic.co/apm/internal/apmlog"
+
 // Logger is an interface for logging, used by the tracer
 // to log tracer errors and other interesting events.
 type Logger interface {
@@ -52,3 +54,14 @@ type debugWarningLogger struct {
 func (l debugWarningLogger) Warningf(format string, args ...interface{}) {
 	l.Debugf(format, args...)
 }
+
+// logLevelSetter returns the apmlog.LevelSetter implemented by l,
+// or by the Logger wrapped by makeWarningLogger, if any.
+func logLevelSetter(l WarningLogger) (apmlog.LevelSetter, bool) {
+	if dl, ok := l.(debugWarningLogger); ok {
+		ls, ok := dl.Logger.(apmlog.LevelSetter)
+		return ls, ok
+	}
+	ls, ok := l.(apmlog.LevelSetter)
+	return ls, ok
+}
@@ -132,6 +132,46 @@ func TestTracerMetricsInterval(t *testing.T) {
 	assert.WithinDuration(t, before.Add(interval), after, 200*time.Millisecond)
 }
 
+func TestTracerMetricsIntervalUpdate(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	numMetricsets := func() int {
+		return len(transport.Payloads().Metrics)
+	}
+	waitMetricsets := func(n int, timeout time.Duration) {
+		deadline := time.Now().Add(timeout)
+		for numMetricsets() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %d metricsets", n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Start off with a long interval, and then reduce it.
+	// The new interval should take effect without waiting
+	// for the old interval to elapse.
+	tracer.SetMetricsInterval(time.Hour)
+	const interval = 100 * time.Millisecond
+	tracer.SetMetricsInterval(interval)
+	before := time.Now()
+	waitMetricsets(3, 5*time.Second)
+	assert.WithinDuration(t, before.Add(3*interval), time.Now(), 2*interval)
+
+	// Disabling the interval should stop periodic gathering.
+	// Allow time for any in-progress gathering to complete.
+	tracer.SetMetricsInterval(0)
+	time.Sleep(2 * interval)
+	n := numMetricsets()
+	time.Sleep(5 * interval)
+	assert.Equal(t, n, numMetricsets())
+
+	// Re-enabling should resume periodic gathering.
+	tracer.SetMetricsInterval(interval)
+	waitMetricsets(n+1, 5*time.Second)
+}
+
 func TestTracerMetricsGatherer(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
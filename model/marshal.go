@@ -586,6 +586,46 @@ func (id *TraceID) isZero() bool {
 	return *id == TraceID{}
 }
 
+// MarshalFastJSON writes the JSON representation of v to w.
+//
+// Histogram metrics, with non-nil Values, are encoded without
+// the "value" field.
+func (v *Metric) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	if v.Values == nil {
+		if v.Type != "" {
+			w.RawString("\"type\":")
+			w.String(v.Type)
+			w.RawByte(',')
+		}
+		w.RawString("\"value\":")
+		w.Float64(v.Value)
+		w.RawByte('}')
+		return nil
+	}
+	w.RawString("\"counts\":[")
+	for i, count := range v.Counts {
+		if i > 0 {
+			w.RawByte(',')
+		}
+		w.Uint64(count)
+	}
+	w.RawByte(']')
+	if v.Type != "" {
+		w.RawString(",\"type\":")
+		w.String(v.Type)
+	}
+	w.RawString(",\"values\":[")
+	for i, value := range v.Values {
+		if i > 0 {
+			w.RawByte(',')
+		}
+		w.Float64(value)
+	}
+	w.RawString("]}")
+	return nil
+}
+
 // MarshalFastJSON writes the JSON representation of id to w.
 func (id *TraceID) MarshalFastJSON(w *fastjson.Writer) error {
 	w.RawByte('"')
@@ -177,6 +177,11 @@ func TestMarshalMetrics(t *testing.T) {
 			"metric_two": map[string]interface{}{
 				"value": float64(-66.6),
 			},
+			"metric_three": map[string]interface{}{
+				"type":   "histogram",
+				"values": []interface{}{float64(0.5), float64(1.5)},
+				"counts": []interface{}{float64(3), float64(4)},
+			},
 		},
 	}
 	assert.Equal(t, expect, decoded)
@@ -566,6 +571,11 @@ func fakeMetrics() *model.Metrics {
 		Samples: map[string]model.Metric{
 			"metric_one": {Value: 1024},
 			"metric_two": {Value: -66.6},
+			"metric_three": {
+				Type:   "histogram",
+				Values: []float64{0.5, 1.5},
+				Counts: []uint64{3, 4},
+			},
 		},
 	}
 }
@@ -194,6 +194,10 @@ type Transaction struct {
 	// for HTTP requests.
 	Result string `json:"result,omitempty"`
 
+	// Outcome holds the outcome of the transaction: "success",
+	// "failure", or "unknown".
+	Outcome string `json:"outcome,omitempty"`
+
 	// Context holds contextual information relating to the transaction.
 	Context *Context `json:"context,omitempty"`
 
@@ -205,8 +209,28 @@ type Transaction struct {
 	// it to true.
 	Sampled *bool `json:"sampled,omitempty"`
 
+	// SampleRate holds the sample rate in effect when the trace was
+	// started, if known. This is used for extrapolating the number
+	// of transactions from the sampled transactions.
+	SampleRate *float64 `json:"sample_rate,omitempty"`
+
 	// SpanCount holds statistics on spans within a transaction.
 	SpanCount SpanCount `json:"span_count"`
+
+	// Session holds details of the user session to which the
+	// transaction belongs.
+	Session *TransactionSession `json:"session,omitempty"`
+}
+
+// TransactionSession holds details of a user session.
+type TransactionSession struct {
+	// ID holds the session ID, used to group transactions
+	// made by the same user session or visitor.
+	ID string `json:"id"`
+
+	// Sequence holds the optional sequence number of the
+	// transaction within the session.
+	Sequence int `json:"sequence,omitempty"`
 }
 
 // SpanCount holds statistics on spans within a transaction.
@@ -242,6 +266,10 @@ type Span struct {
 	// Action identifies the action that is being undertaken, e.g. "query".
 	Action string `json:"action,omitempty"`
 
+	// Outcome holds the outcome of the span: "success",
+	// "failure", or "unknown".
+	Outcome string `json:"outcome,omitempty"`
+
 	// ID holds the ID of the span.
 	ID SpanID `json:"id"`
 
@@ -273,8 +301,31 @@ type SpanContext struct {
 	// HTTP holds contextual information for HTTP client request spans.
 	HTTP *HTTPSpanContext `json:"http,omitempty"`
 
+	// Service holds contextual information about the service targeted
+	// by an exit span.
+	Service *ServiceSpanContext `json:"service,omitempty"`
+
 	// Tags holds user-defined key/value pairs.
 	Tags IfaceMap `json:"tags,omitempty"`
+
+	// Custom holds custom, non-indexed context relating to the span.
+	Custom IfaceMap `json:"custom,omitempty"`
+}
+
+// ServiceSpanContext holds contextual information about the service
+// targeted by a span.
+type ServiceSpanContext struct {
+	// Target holds the target service's type and name.
+	Target *ServiceTargetSpanContext `json:"target,omitempty"`
+}
+
+// ServiceTargetSpanContext identifies the service targeted by a span.
+type ServiceTargetSpanContext struct {
+	// Type holds the target service type, e.g. "mysql".
+	Type string `json:"type,omitempty"`
+
+	// Name holds the target service instance name, e.g. a database name.
+	Name string `json:"name,omitempty"`
 }
 
 // DestinationSpanContext holds contextual information about the destination
@@ -358,6 +409,10 @@ type Context struct {
 
 	// Service holds values to overrides service-level metadata.
 	Service *Service `json:"service,omitempty"`
+
+	// Message holds details related to message receiving or publishing,
+	// if the transaction or error relates to a messaging system.
+	Message *MessageContext `json:"message,omitempty"`
 }
 
 // User holds information about an authenticated user.
@@ -373,6 +428,30 @@ type User struct {
 	Email string `json:"email,omitempty"`
 }
 
+// MessageContext holds details related to message receiving
+// and publishing.
+type MessageContext struct {
+	// Queue holds information about the message queue.
+	Queue *MessageQueueContext `json:"queue,omitempty"`
+
+	// Age holds information about the age of the message.
+	Age *MessageAgeContext `json:"age,omitempty"`
+}
+
+// MessageQueueContext holds information about a message queue.
+type MessageQueueContext struct {
+	// Name holds the name of the message queue.
+	Name string `json:"name,omitempty"`
+}
+
+// MessageAgeContext holds information about the age of a message.
+type MessageAgeContext struct {
+	// Milliseconds holds the age of the message in milliseconds,
+	// i.e. the time elapsed between the message being enqueued
+	// and received.
+	Milliseconds int64 `json:"ms"`
+}
+
 // Error represents an error occurring in the service.
 type Error struct {
 	// Timestamp holds the time at which the error occurred.
@@ -666,6 +745,20 @@ type MetricsSpan struct {
 
 // Metric holds metric values.
 type Metric struct {
-	// Value holds the metric value.
+	// Type holds an optional metric type, e.g. "histogram".
+	Type string `json:"type,omitempty"`
+
+	// Value holds the metric value. Value is ignored if Values
+	// is non-nil.
 	Value float64 `json:"value"`
+
+	// Values holds the bucket values for histogram metrics.
+	//
+	// Values must be provided in ascending order, and each
+	// value must have a corresponding count in Counts.
+	Values []float64 `json:"values,omitempty"`
+
+	// Counts holds the bucket counts for histogram metrics,
+	// corresponding to the values in Values.
+	Counts []uint64 `json:"counts,omitempty"`
 }
@@ -18,6 +18,9 @@
 package apm
 
 import (
+	"sort"
+	"unicode/utf8"
+
 	"go.elastic.co/apm/internal/ringbuffer"
 	"go.elastic.co/apm/model"
 	"go.elastic.co/apm/stacktrace"
@@ -31,6 +34,10 @@ const (
 	metricsBlockTag
 )
 
+// truncatedLabel is the name of the label added to events whose fields
+// have been truncated to bring them within the maximum event size.
+const truncatedLabel = "event_truncated"
+
 // notSampled is used as the pointee for the model.Transaction.Sampled field
 // of non-sampled transactions.
 var notSampled = false
@@ -42,16 +49,40 @@ type modelWriter struct {
 	stats           *TracerStats
 	json            fastjson.Writer
 	modelStacktrace []model.StacktraceFrame
+
+	// maxEventSize returns the maximum size of an encoded event,
+	// or zero or less if event sizes are not limited.
+	maxEventSize func() int
+
+	// invalidOutcomeLogged records whether a warning has
+	// been logged for an invalid event outcome.
+	invalidOutcomeLogged bool
 }
 
 // writeTransaction encodes tx as JSON to the buffer, and then resets tx.
 func (w *modelWriter) writeTransaction(tx *Transaction, td *TransactionData) {
 	var modelTx model.Transaction
 	w.buildModelTransaction(&modelTx, tx, td)
-	w.json.RawString(`{"transaction":`)
-	modelTx.MarshalFastJSON(&w.json)
-	w.json.RawByte('}')
-	w.buffer.WriteBlock(w.json.Bytes(), transactionBlockTag)
+	if w.encodeEvent(`{"transaction":`, &modelTx,
+		func(excess int) bool {
+			return modelTx.Context != nil && truncateRequestBody(modelTx.Context.Request, excess)
+		},
+		func(excess int) bool {
+			return modelTx.Context != nil && dropLargestLabels(&modelTx.Context.Tags, excess)
+		},
+		func(excess int) bool {
+			if ctx := modelTx.Context; ctx != nil && len(ctx.Custom) != 0 {
+				ctx.Custom = nil
+				return true
+			}
+			return false
+		},
+	) {
+		w.buffer.WriteBlock(w.json.Bytes(), transactionBlockTag)
+	} else {
+		w.stats.TransactionsDropped++
+		w.logEventDropped("transaction")
+	}
 	w.json.Reset()
 	td.reset(tx.tracer)
 }
@@ -60,10 +91,30 @@ func (w *modelWriter) writeTransaction(tx *Transaction, td *TransactionData) {
 func (w *modelWriter) writeSpan(s *Span, sd *SpanData) {
 	var modelSpan model.Span
 	w.buildModelSpan(&modelSpan, s, sd)
-	w.json.RawString(`{"span":`)
-	modelSpan.MarshalFastJSON(&w.json)
-	w.json.RawByte('}')
-	w.buffer.WriteBlock(w.json.Bytes(), spanBlockTag)
+	if w.encodeEvent(`{"span":`, &modelSpan,
+		func(excess int) bool {
+			if ctx := modelSpan.Context; ctx != nil && ctx.Database != nil && ctx.Database.Statement != "" {
+				ctx.Database.Statement = truncateUTF8(ctx.Database.Statement, len(ctx.Database.Statement)-excess)
+				return true
+			}
+			return false
+		},
+		func(excess int) bool {
+			return modelSpan.Context != nil && dropLargestLabels(&modelSpan.Context.Tags, excess)
+		},
+		func(excess int) bool {
+			if len(modelSpan.Stacktrace) != 0 {
+				modelSpan.Stacktrace = nil
+				return true
+			}
+			return false
+		},
+	) {
+		w.buffer.WriteBlock(w.json.Bytes(), spanBlockTag)
+	} else {
+		w.stats.SpansDropped++
+		w.logEventDropped("span")
+	}
 	w.json.Reset()
 	sd.reset(s.tracer)
 }
@@ -72,14 +123,202 @@ func (w *modelWriter) writeSpan(s *Span, sd *SpanData) {
 func (w *modelWriter) writeError(e *ErrorData) {
 	var modelError model.Error
 	w.buildModelError(&modelError, e)
-	w.json.RawString(`{"error":`)
-	modelError.MarshalFastJSON(&w.json)
-	w.json.RawByte('}')
-	w.buffer.WriteBlock(w.json.Bytes(), errorBlockTag)
+	if w.encodeEvent(`{"error":`, &modelError,
+		func(excess int) bool {
+			return modelError.Context != nil && truncateRequestBody(modelError.Context.Request, excess)
+		},
+		func(excess int) bool {
+			return modelError.Context != nil && dropLargestLabels(&modelError.Context.Tags, excess)
+		},
+		func(excess int) bool {
+			if ctx := modelError.Context; ctx != nil && len(ctx.Custom) != 0 {
+				ctx.Custom = nil
+				return true
+			}
+			return false
+		},
+		func(excess int) bool {
+			if len(modelError.Exception.Stacktrace) != 0 || len(modelError.Log.Stacktrace) != 0 {
+				modelError.Exception.Stacktrace = nil
+				modelError.Log.Stacktrace = nil
+				return true
+			}
+			return false
+		},
+	) {
+		w.buffer.WriteBlock(w.json.Bytes(), errorBlockTag)
+	} else {
+		w.stats.ErrorsDropped++
+		w.logEventDropped("error")
+	}
 	w.json.Reset()
 	e.reset()
 }
 
+// encodeEvent encodes event as JSON to w.json, enclosed by prefix and a
+// closing brace.
+//
+// If the encoded event exceeds the maximum event size, the truncate
+// functions are called in order with the number of bytes by which the
+// event exceeds the limit, re-encoding the event after each call that
+// reports it has truncated something, until the event is within the
+// limit. Each truncate function is called repeatedly until it reports
+// that there is nothing left for it to truncate, before moving on to
+// the next. encodeEvent returns false if the event cannot be brought
+// within the limit, in which case the event should be dropped.
+func (w *modelWriter) encodeEvent(prefix string, event fastjson.Marshaler, truncate ...func(excess int) bool) bool {
+	maxEventSize := 0
+	if w.maxEventSize != nil {
+		maxEventSize = w.maxEventSize()
+	}
+	for {
+		w.json.RawString(prefix)
+		event.MarshalFastJSON(&w.json)
+		w.json.RawByte('}')
+		if maxEventSize <= 0 || w.json.Size() <= maxEventSize {
+			return true
+		}
+		excess := w.json.Size() - maxEventSize
+		w.json.Reset()
+		for len(truncate) > 0 && !truncate[0](excess) {
+			truncate = truncate[1:]
+		}
+		if len(truncate) == 0 {
+			return false
+		}
+		markTruncated(event)
+	}
+}
+
+// truncateRequestBody shortens the raw body of req by excess bytes,
+// or removes the body if it cannot be shortened any further. It
+// returns false if req has no body.
+func truncateRequestBody(req *model.Request, excess int) bool {
+	if req == nil || req.Body == nil {
+		return false
+	}
+	if req.Body.Form == nil && len(req.Body.Raw) > excess {
+		req.Body.Raw = truncateUTF8(req.Body.Raw, len(req.Body.Raw)-excess)
+		if req.Body.Raw != "" {
+			return true
+		}
+	}
+	req.Body = nil
+	return true
+}
+
+// truncateUTF8 returns the longest prefix of s of at most n bytes which
+// does not end with a partial UTF-8 sequence.
+func truncateUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// dropLargestLabels removes the labels with the largest encoded size
+// from tags, other than truncatedLabel, until the removed labels account
+// for at least excess bytes or there are no more labels to remove. The
+// relative order of the remaining labels is preserved. It returns false
+// if there are no labels to remove.
+func dropLargestLabels(tags *model.IfaceMap, excess int) bool {
+	type labelSize struct {
+		index int
+		size  int
+	}
+	var w fastjson.Writer
+	sizes := make([]labelSize, 0, len(*tags))
+	for i, item := range *tags {
+		if item.Key == truncatedLabel {
+			continue
+		}
+		w.Reset()
+		w.String(item.Key)
+		fastjson.Marshal(&w, item.Value)
+		// Include the separating ':' and ','.
+		sizes = append(sizes, labelSize{index: i, size: w.Size() + 2})
+	}
+	if len(sizes) == 0 {
+		return false
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		return sizes[i].size > sizes[j].size
+	})
+	drop := make(map[int]bool)
+	for _, label := range sizes {
+		drop[label.index] = true
+		if excess -= label.size; excess <= 0 {
+			break
+		}
+	}
+	kept := (*tags)[:0]
+	for i, item := range *tags {
+		if !drop[i] {
+			kept = append(kept, item)
+		}
+	}
+	*tags = kept
+	return true
+}
+
+// markTruncated adds the truncatedLabel label to event.
+func markTruncated(event fastjson.Marshaler) {
+	var tags *model.IfaceMap
+	switch event := event.(type) {
+	case *model.Transaction:
+		if event.Context == nil {
+			event.Context = &model.Context{}
+		}
+		tags = &event.Context.Tags
+	case *model.Span:
+		if event.Context == nil {
+			event.Context = &model.SpanContext{}
+		}
+		tags = &event.Context.Tags
+	case *model.Error:
+		if event.Context == nil {
+			event.Context = &model.Context{}
+		}
+		tags = &event.Context.Tags
+	default:
+		return
+	}
+	for _, item := range *tags {
+		if item.Key == truncatedLabel {
+			return
+		}
+	}
+	*tags = append(*tags, model.IfaceMapItem{Key: truncatedLabel, Value: true})
+}
+
+// normalizeOutcome returns outcome if it is empty or one of the values
+// accepted by APM Server: "success", "failure", or "unknown". Any other
+// value is reported as "unknown", logging a warning the first time, as
+// the server would otherwise reject the event.
+func (w *modelWriter) normalizeOutcome(outcome string) string {
+	switch outcome {
+	case "", "success", "failure", "unknown":
+		return outcome
+	}
+	if !w.invalidOutcomeLogged && w.cfg.logger != nil {
+		w.cfg.logger.Warningf("invalid outcome %q reported as \"unknown\"", outcome)
+		w.invalidOutcomeLogged = true
+	}
+	return "unknown"
+}
+
+func (w *modelWriter) logEventDropped(eventType string) {
+	if w.cfg.logger != nil {
+		w.cfg.logger.Warningf("dropped %s exceeding the maximum event size", eventType)
+	}
+}
+
 // writeMetrics encodes m as JSON to the w.metricsBuffer, and then resets m.
 //
 // Note that we do not write metrics to the main ring buffer (w.buffer), as
@@ -102,6 +341,15 @@ func (w *modelWriter) writeMetrics(m *Metrics) {
 	m.reset()
 }
 
+// writeMetricset encodes m as JSON to the w.metricsBuffer.
+func (w *modelWriter) writeMetricset(m *model.Metrics) {
+	w.json.RawString(`{"metricset":`)
+	m.MarshalFastJSON(&w.json)
+	w.json.RawString("}")
+	w.metricsBuffer.WriteBlock(w.json.Bytes(), metricsBlockTag)
+	w.json.Reset()
+}
+
 func (w *modelWriter) buildModelTransaction(out *model.Transaction, tx *Transaction, td *TransactionData) {
 	out.ID = model.SpanID(tx.traceContext.Span)
 	out.TraceID = model.TraceID(tx.traceContext.Trace)
@@ -109,17 +357,30 @@ func (w *modelWriter) buildModelTransaction(out *model.Transaction, tx *Transact
 	if !sampled {
 		out.Sampled = &notSampled
 	}
+	if td.hasSampleRate {
+		// Non-sampled transactions are recorded with
+		// a sample rate of zero, as they are not used
+		// for extrapolation.
+		if !sampled {
+			td.sampleRate = 0
+		}
+		out.SampleRate = &td.sampleRate
+	}
 
 	out.ParentID = model.SpanID(td.parentSpan)
 	out.Name = truncateString(td.Name)
 	out.Type = truncateString(td.Type)
 	out.Result = truncateString(td.Result)
+	out.Outcome = w.normalizeOutcome(td.Outcome)
 	out.Timestamp = model.Time(td.timestamp.UTC())
 	out.Duration = td.Duration.Seconds() * 1000
 	out.SpanCount.Started = td.spansCreated
 	out.SpanCount.Dropped = td.spansDropped
 	if sampled {
 		out.Context = td.Context.build()
+		if td.Context.session.ID != "" {
+			out.Session = &td.Context.session
+		}
 	}
 
 	if len(w.cfg.sanitizedFieldNames) != 0 && out.Context != nil {
@@ -143,8 +404,10 @@ func (w *modelWriter) buildModelSpan(out *model.Span, span *Span, sd *SpanData)
 	out.Type = truncateString(sd.Type)
 	out.Subtype = truncateString(sd.Subtype)
 	out.Action = truncateString(sd.Action)
+	out.Outcome = w.normalizeOutcome(sd.Outcome)
 	out.Timestamp = model.Time(sd.timestamp.UTC())
 	out.Duration = sd.Duration.Seconds() * 1000
+	sd.Context.setDefaultServiceTarget(sd.Type, sd.Subtype)
 	out.Context = sd.Context.build()
 
 	// Copy the span type to context.destination.service.type.
@@ -240,6 +503,15 @@ func (w *modelWriter) buildModelError(out *model.Error, e *ErrorData) {
 				out.Culprit = stacktraceCulprit(out.Log.Stacktrace)
 			}
 		}
+	} else if e.log.Level != "" && e.exception.message != "" {
+		// The error's level was set explicitly with Error.SetLevel,
+		// and there is no log record; the model records the level
+		// in the log, so we use the exception message as the log
+		// message.
+		out.Log = model.Log{
+			Message: e.exception.message,
+			Level:   e.log.Level,
+		}
 	}
 	out.Culprit = truncateString(out.Culprit)
 }
@@ -83,7 +83,7 @@ func (m *middleware) handle(c echo.Context) error {
 			}
 			c.Error(err)
 
-			e := m.tracer.Recovered(v)
+			e := apmhttp.RecoveredError(m.tracer, v)
 			e.SetTransaction(tx)
 			setContext(&e.Context, req, resp, body)
 			e.Send()
@@ -53,6 +53,7 @@ func Middleware(o ...Option) echo.MiddlewareFunc {
 			tracer:         opts.tracer,
 			handler:        h,
 			requestIgnorer: opts.requestIgnorer,
+			middlewareSpan: opts.middlewareSpan,
 		}
 		return m.handle
 	}
@@ -62,6 +63,7 @@ type middleware struct {
 	handler        echo.HandlerFunc
 	tracer         *apm.Tracer
 	requestIgnorer apmhttp.RequestIgnorerFunc
+	middlewareSpan bool
 }
 
 func (m *middleware) handle(c echo.Context) error {
@@ -73,6 +75,14 @@ func (m *middleware) handle(c echo.Context) error {
 	tx, req := apmhttp.StartTransaction(m.tracer, name, req)
 	defer tx.End()
 	c.SetRequest(req)
+
+	if m.middlewareSpan {
+		ms := apmhttp.StartMiddlewareSpan(tx)
+		c.Set(middlewareSpanKey, ms)
+		// If the request did not reach HandlerEntry, the
+		// time was spent entirely in middleware.
+		defer ms.End()
+	}
 	body := m.tracer.CaptureHTTPRequestBody(req)
 
 	resp := c.Response()
@@ -85,7 +95,7 @@ func (m *middleware) handle(c echo.Context) error {
 			}
 			c.Error(err)
 
-			e := m.tracer.Recovered(v)
+			e := apmhttp.RecoveredError(m.tracer, v)
 			e.SetTransaction(tx)
 			setContext(&e.Context, req, resp, body)
 			e.Send()
@@ -149,9 +159,31 @@ func setContext(ctx *apm.Context, req *http.Request, resp *echo.Response, body *
 	ctx.SetHTTPResponseHeaders(resp.Header())
 }
 
+// HandlerEntry returns an Echo middleware which marks the boundary
+// between middleware and the request handler, for use with
+// WithMiddlewareSpan. HandlerEntry should be added after all other
+// middleware, e.g.
+//
+//	e.Use(apmechov4.Middleware(apmechov4.WithMiddlewareSpan()))
+//	e.Use(auth, cors, rateLimit)
+//	e.Use(apmechov4.HandlerEntry())
+func HandlerEntry() echo.MiddlewareFunc {
+	return func(h echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if ms, ok := c.Get(middlewareSpanKey).(*apmhttp.MiddlewareSpan); ok {
+				ms.End()
+			}
+			return h(c)
+		}
+	}
+}
+
+const middlewareSpanKey = "go.elastic.co/apm/module/apmechov4.middlewareSpan"
+
 type options struct {
 	tracer         *apm.Tracer
 	requestIgnorer apmhttp.RequestIgnorerFunc
+	middlewareSpan bool
 }
 
 // Option sets options for tracing.
@@ -180,6 +212,23 @@ func WithRequestIgnorer(r apmhttp.RequestIgnorerFunc) Option {
 	}
 }
 
+// WithMiddlewareSpan returns an Option which enables reporting
+// the time spent in middleware, from the start of the transaction
+// until the request handler is entered, as a span named "middleware"
+// of type "app.middleware".
+//
+// The boundary between middleware and the request handler must be
+// marked by adding HandlerEntry after all other middleware. Exactly
+// one additional span is reported for each request: if a middleware
+// returns before the request reaches HandlerEntry, e.g. to reject
+// an unauthorized request, then the span covers all of the middleware
+// that ran.
+func WithMiddlewareSpan() Option {
+	return func(o *options) {
+		o.middlewareSpan = true
+	}
+}
+
 func isNotFoundHandler(h echo.HandlerFunc) bool {
 	return isHandler(h, notFoundHandlerIdentity, &echo.NotFoundHandler)
 }
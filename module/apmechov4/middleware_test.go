@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
@@ -224,3 +225,45 @@ func doRequest(e *echo.Echo, method, url string) *httptest.ResponseRecorder {
 	e.ServeHTTP(w, req)
 	return w
 }
+
+func TestEchoMiddlewareSpan(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	e := echo.New()
+	e.Use(apmecho.Middleware(apmecho.WithTracer(tracer), apmecho.WithMiddlewareSpan()))
+	e.Use(func(h echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			if c.Request().Header.Get("Authorization") == "" {
+				return echo.ErrUnauthorized
+			}
+			return h(c)
+		}
+	})
+	e.Use(apmecho.HandlerEntry())
+	e.GET("/hello/:name", handleHello)
+
+	for _, auth := range []string{"secret", ""} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://server.testing/hello/foo", nil)
+		req.Header.Set("Authorization", auth)
+		e.ServeHTTP(w, req)
+	}
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	require.Len(t, payloads.Spans, 2)
+	for i, span := range payloads.Spans {
+		tx := payloads.Transactions[i]
+		assert.Equal(t, "middleware", span.Name)
+		assert.Equal(t, "app", span.Type)
+		assert.Equal(t, "middleware", span.Subtype)
+		assert.Equal(t, tx.ID, span.ParentID)
+		assert.True(t, span.Duration >= 10)
+		assert.True(t, span.Duration <= tx.Duration)
+	}
+	assert.Equal(t, http.StatusTeapot, payloads.Transactions[0].Context.Response.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, payloads.Transactions[1].Context.Response.StatusCode)
+}
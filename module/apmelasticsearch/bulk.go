@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmelasticsearch
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+	"sync/atomic"
+)
+
+// maxActionLineLength is the maximum number of bytes of a bulk
+// action line that will be buffered. Only the first object key
+// is required for identifying the action, so we needn't keep
+// the full action metadata.
+const maxActionLineLength = 64
+
+// countBulkActions wraps the body of a bulk request such that the
+// number of actions it contains are counted as it is read by the
+// underlying http.RoundTripper. The count is complete once the body
+// has been read to EOF or closed, at which point done is called.
+//
+// If req is not a bulk request, or its body cannot be inspected
+// (e.g. because it is compressed), countBulkActions returns nil
+// and req. Otherwise countBulkActions returns a new *http.Request
+// to be passed to the underlying http.RoundTripper.
+func countBulkActions(req *http.Request, done func()) (*bulkBody, *http.Request) {
+	if !isBulkURL(req.URL.Path) {
+		return nil, req
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req
+	}
+	if req.Header.Get("Content-Encoding") != "" {
+		return nil, req
+	}
+	body := &bulkBody{ReadCloser: req.Body, done: done}
+	reqCopy := *req
+	reqCopy.Body = body
+	return body, &reqCopy
+}
+
+func isBulkURL(urlPath string) bool {
+	return path.Base(urlPath) == "_bulk"
+}
+
+// bulkBody is an io.ReadCloser which counts the actions in a
+// newline-delimited bulk request body as it is read.
+//
+// Each action is described by a metadata line, followed by a
+// source document line for all actions other than "delete".
+type bulkBody struct {
+	actions int64 // accessed atomically; first for 64-bit alignment
+
+	io.ReadCloser
+	line     []byte
+	source   bool // the current line is a source document
+	done     func()
+	doneOnce sync.Once
+}
+
+// count returns the number of bulk actions read so far.
+func (b *bulkBody) count() int64 {
+	return atomic.LoadInt64(&b.actions)
+}
+
+// Read reads from the request body, counting actions as they are read.
+func (b *bulkBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	data := p[:n]
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			b.appendLine(data)
+			break
+		}
+		b.appendLine(data[:i])
+		b.endLine()
+		data = data[i+1:]
+	}
+	if err == io.EOF {
+		b.endLine()
+		b.doneOnce.Do(b.done)
+	}
+	return n, err
+}
+
+// Close closes the request body. The underlying http.RoundTripper
+// must close the body, possibly after RoundTrip has returned, so
+// the count is always complete by the time Close is called.
+func (b *bulkBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.doneOnce.Do(b.done)
+	return err
+}
+
+func (b *bulkBody) appendLine(data []byte) {
+	if b.source {
+		return
+	}
+	if room := maxActionLineLength - len(b.line); room > 0 {
+		if len(data) > room {
+			data = data[:room]
+		}
+		b.line = append(b.line, data...)
+	}
+}
+
+func (b *bulkBody) endLine() {
+	line := bytes.TrimSpace(b.line)
+	b.line = b.line[:0]
+	if b.source {
+		b.source = false
+		return
+	}
+	if len(line) == 0 {
+		return
+	}
+	atomic.AddInt64(&b.actions, 1)
+	b.source = bulkActionName(line) != "delete"
+}
+
+// bulkActionName returns the name of the action described by
+// the given bulk action metadata line, e.g. "index" for the line
+// `{"index":{"_index":"twitter"}}`.
+func bulkActionName(line []byte) string {
+	line = bytes.TrimLeft(line, "{ \t")
+	if len(line) == 0 || line[0] != '"' {
+		return ""
+	}
+	line = line[1:]
+	end := bytes.IndexByte(line, '"')
+	if end == -1 {
+		return ""
+	}
+	return string(line[:end])
+}
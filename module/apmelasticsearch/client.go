@@ -25,8 +25,9 @@ import (
 	"net/http"
 	"net/url"
 	"path"
-	"sync/atomic"
-	"unsafe"
+	"strings"
+	"sync"
+	"time"
 
 	"go.elastic.co/apm"
 	"go.elastic.co/apm/module/apmhttp"
@@ -54,6 +55,17 @@ type roundTripper struct {
 
 // RoundTrip delegates to r.r, emitting a span if req's context contains a transaction.
 //
+// The span's action is set to the Elasticsearch operation, such as "search" or "bulk",
+// derived from the request URL path. Each call to RoundTrip is reported as a separate
+// span, so requests retried by the client against other nodes in the cluster will be
+// recorded with their own destination address and port.
+//
+// If req.URL.Path corresponds to a bulk request, then the number of actions in the
+// request body is counted as the body is sent, and recorded in the span label
+// "elasticsearch_bulk_actions". The underlying RoundTripper may finish sending the
+// body after RoundTrip returns, so the span is ended once both the response and the
+// request body have been consumed.
+//
 // If req.URL.Path corresponds to a search request, then RoundTrip will attempt to extract
 // the search query to use as the span context's "database statement". If the query is
 // passed in as a query parameter (i.e. "/_search?q=foo:bar"), then that will be used;
@@ -68,13 +80,24 @@ func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 
 	name := requestName(req)
-	span := tx.StartSpan(name, "db.elasticsearch", apm.SpanFromContext(ctx))
+	spanType := "db.elasticsearch"
+	if action := requestAction(req); action != "" {
+		spanType += "." + action
+	}
+	start := time.Now()
+	span := tx.StartSpan(name, spanType, apm.SpanFromContext(ctx))
 	if span.Dropped() {
 		span.End()
 		return r.r.RoundTrip(req)
 	}
 
+	ender := &spanEnder{span: span, start: start, pending: 1}
 	statement, req := captureSearchStatement(req)
+	bulk, req := countBulkActions(req, func() { ender.done(false) })
+	if bulk != nil {
+		ender.bulk = bulk
+		ender.pending++
+	}
 	username, _, _ := req.BasicAuth()
 	ctx = apm.ContextWithSpan(ctx, span)
 	req = apmhttp.RequestWithContext(ctx, req)
@@ -91,14 +114,49 @@ func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	resp, err := r.r.RoundTrip(req)
 	if err != nil {
-		span.End()
+		ender.done(true)
 	} else {
 		span.Context.SetHTTPStatusCode(resp.StatusCode)
-		resp.Body = &responseBody{span: span, body: resp.Body}
+		resp.Body = &responseBody{ender: ender, body: resp.Body}
 	}
 	return resp, err
 }
 
+// spanEnder ends a span once the response has been consumed and, for
+// bulk requests, the request body has been sent, recording the number
+// of bulk actions.
+type spanEnder struct {
+	span  *apm.Span
+	start time.Time
+	bulk  *bulkBody
+
+	mu          sync.Mutex
+	pending     int
+	responseEnd time.Time
+}
+
+// done records that either the response or the request body is done,
+// ending the span if both are.
+func (e *spanEnder) done(response bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if response {
+		e.responseEnd = time.Now()
+	}
+	if e.pending--; e.pending > 0 {
+		return
+	}
+	if e.bulk != nil {
+		e.span.Context.SetLabel("elasticsearch_bulk_actions", e.bulk.count())
+	}
+	if !response {
+		// The request body was closed after the response was consumed;
+		// the operation itself ended with the response.
+		e.span.Duration = e.responseEnd.Sub(e.start)
+	}
+	e.span.End()
+}
+
 // CloseIdleConnections calls r.r.CloseIdleConnections if the method exists.
 func (r *roundTripper) CloseIdleConnections() {
 	type closeIdler interface {
@@ -110,8 +168,9 @@ func (r *roundTripper) CloseIdleConnections() {
 }
 
 type responseBody struct {
-	span *apm.Span
-	body io.ReadCloser
+	ender *spanEnder
+	body  io.ReadCloser
+	once  sync.Once
 }
 
 // Close closes the response body, and ends the span if it hasn't already been ended.
@@ -131,10 +190,7 @@ func (b *responseBody) Read(p []byte) (n int, err error) {
 }
 
 func (b *responseBody) endSpan() {
-	addr := (*unsafe.Pointer)(unsafe.Pointer(&b.span))
-	if old := atomic.SwapPointer(addr, nil); old != nil {
-		(*apm.Span)(old).End()
-	}
+	b.once.Do(func() { b.ender.done(true) })
 }
 
 // ClientOption sets options for tracing client requests.
@@ -209,6 +265,35 @@ func captureSearchStatement(req *http.Request) (string, *http.Request) {
 	return statement, req
 }
 
+// requestAction returns the Elasticsearch operation for req, derived from the
+// first API endpoint path segment (beginning with an underscore), e.g. "search"
+// for "/twitter/_search". Single document requests ("/twitter/_doc/1") are
+// mapped to "index", "get", or "delete" based on the request method.
+//
+// If the operation cannot be determined, requestAction returns "".
+func requestAction(req *http.Request) string {
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		if len(segment) < 2 || segment[0] != '_' {
+			continue
+		}
+		switch segment {
+		case "_all":
+			// "_all" is an index pattern, not an endpoint.
+			continue
+		case "_doc":
+			switch req.Method {
+			case http.MethodGet, http.MethodHead:
+				return "get"
+			case http.MethodDelete:
+				return "delete"
+			}
+			return "index"
+		}
+		return segment[1:]
+	}
+	return ""
+}
+
 func isSearchURL(url *url.URL) bool {
 	switch dir, file := path.Split(url.Path); file {
 	case "_search", "_msearch", "_rollup_search":
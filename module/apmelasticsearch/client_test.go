@@ -303,6 +303,141 @@ func TestDestination(t *testing.T) {
 	test("http://[2001:db8::1]:80/_search", "2001:db8::1", 80)
 }
 
+func TestSpanAction(t *testing.T) {
+	var rt roundTripperFunc = func(req *http.Request) (*http.Response, error) {
+		return httptest.NewRecorder().Result(), nil
+	}
+	client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(rt)}
+
+	test := func(method, path, expectedAction string) {
+		req, err := http.NewRequest(method, "http://host:9200"+path, nil)
+		require.NoError(t, err)
+		_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+			resp, err := client.Do(req.WithContext(ctx))
+			assert.NoError(t, err)
+			resp.Body.Close()
+		})
+		require.Len(t, spans, 1)
+		assert.Equal(t, "db", spans[0].Type)
+		assert.Equal(t, "elasticsearch", spans[0].Subtype)
+		assert.Equal(t, expectedAction, spans[0].Action, "%s %s", method, path)
+	}
+	test("GET", "/twitter/_search", "search")
+	test("GET", "/_all/_search", "search")
+	test("POST", "/_msearch", "msearch")
+	test("POST", "/_bulk", "bulk")
+	test("POST", "/twitter/_bulk", "bulk")
+	test("PUT", "/twitter/_doc/1", "index")
+	test("POST", "/twitter/_doc", "index")
+	test("GET", "/twitter/_doc/1", "get")
+	test("DELETE", "/twitter/_doc/1", "delete")
+	test("POST", "/twitter/_update/1", "update")
+	test("GET", "/_cluster/health", "cluster")
+	test("PUT", "/twitter", "")
+}
+
+func TestBulkActions(t *testing.T) {
+	var received []byte
+	var rt roundTripperFunc = func(req *http.Request) (*http.Response, error) {
+		var err error
+		received, err = ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		req.Body.Close()
+		return httptest.NewRecorder().Result(), nil
+	}
+	client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(rt)}
+
+	body := strings.Join([]string{
+		`{"index":{"_index":"twitter","_id":"1"}}`,
+		`{"delete":{}}`,
+		`{"user":"kimchy"}`,
+		`{"delete":{"_index":"twitter","_id":"2"}}`,
+		`{"create":{"_index":"twitter","_id":"3"}}`,
+		`{"user":"kimchy"}`,
+		`{"update":{"_id":"1","_index":"twitter"}}`,
+		`{"doc":{"user":"elastic"}}`,
+		"",
+	}, "\n")
+	req, err := http.NewRequest("POST", "http://host:9200/_bulk", readerOnly{strings.NewReader(body)})
+	require.NoError(t, err)
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		resp, err := client.Do(req.WithContext(ctx))
+		assert.NoError(t, err)
+		resp.Body.Close()
+	})
+	assert.Equal(t, body, string(received))
+	require.Len(t, spans, 1)
+	assert.Equal(t, model.IfaceMap{{
+		Key:   "elasticsearch_bulk_actions",
+		Value: float64(4),
+	}}, spans[0].Context.Tags)
+}
+
+func TestBulkActionsBodySentAfterResponse(t *testing.T) {
+	// Transports may continue sending the request body after RoundTrip
+	// has returned, e.g. when the server responds early.
+	sent := make(chan struct{})
+	var rt roundTripperFunc = func(req *http.Request) (*http.Response, error) {
+		go func() {
+			defer close(sent)
+			ioutil.ReadAll(req.Body)
+			req.Body.Close()
+		}()
+		return httptest.NewRecorder().Result(), nil
+	}
+	client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(rt)}
+
+	body := `{"delete":{"_index":"twitter","_id":"1"}}` + "\n" + `{"delete":{"_index":"twitter","_id":"2"}}` + "\n"
+	req, err := http.NewRequest("POST", "http://host:9200/_bulk", readerOnly{strings.NewReader(body)})
+	require.NoError(t, err)
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		resp, err := client.Do(req.WithContext(ctx))
+		assert.NoError(t, err)
+		resp.Body.Close()
+		<-sent
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, model.IfaceMap{{
+		Key:   "elasticsearch_bulk_actions",
+		Value: float64(2),
+	}}, spans[0].Context.Tags)
+}
+
+func TestRetriedRequests(t *testing.T) {
+	// Simulate a client retrying a request against another node in the
+	// cluster, after failing to connect to the first.
+	var rt roundTripperFunc = func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "node1:9200" {
+			return nil, errors.New("connection refused")
+		}
+		return httptest.NewRecorder().Result(), nil
+	}
+	client := &http.Client{Transport: apmelasticsearch.WrapRoundTripper(rt)}
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		for _, host := range []string{"node1", "node2"} {
+			req, err := http.NewRequest("GET", "http://"+host+":9200/_search", nil)
+			require.NoError(t, err)
+			if resp, err := client.Do(req.WithContext(ctx)); err == nil {
+				resp.Body.Close()
+			}
+		}
+	})
+	require.Len(t, spans, 2)
+	assert.Equal(t, "node1", spans[0].Context.Destination.Address)
+	assert.Equal(t, 0, spans[0].Context.HTTP.StatusCode)
+	assert.Equal(t, "node2", spans[1].Context.Destination.Address)
+	assert.Equal(t, http.StatusOK, spans[1].Context.HTTP.StatusCode)
+}
+
+// readerOnly hides any methods other than Read, preventing
+// http.NewRequest from setting Content-Length and GetBody.
+type readerOnly struct {
+	io.Reader
+}
+
 type readCloser struct {
 	io.Reader
 	closed bool
@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"go.elastic.co/apm"
+)
+
+const (
+	// TraceparentEnv is the environment variable through which the
+	// W3C Trace-Context traceparent is propagated to subprocesses.
+	TraceparentEnv = apm.TraceparentEnv
+
+	// TracestateEnv is the environment variable through which the
+	// W3C Trace-Context tracestate is propagated to subprocesses.
+	TracestateEnv = apm.TracestateEnv
+)
+
+// Cmd wraps an *exec.Cmd, tracing its execution as a span.
+//
+// The Start, Wait, Run, Output, and CombinedOutput methods of Cmd
+// must be used in place of those of the embedded *exec.Cmd for the
+// command to be traced.
+type Cmd struct {
+	*exec.Cmd
+
+	ctx  context.Context
+	span *apm.Span
+}
+
+// CommandContext returns a Cmd for executing the named program with the
+// given arguments, as with exec.CommandContext. The command's execution
+// will be traced as a span of type "process", named by the command, if
+// ctx contains a transaction.
+//
+// When the command is started, the trace context is propagated to the
+// subprocess through the TRACEPARENT and TRACESTATE environment variables,
+// so that trace-aware subprocesses can continue the trace.
+func CommandContext(ctx context.Context, name string, arg ...string) *Cmd {
+	return &Cmd{Cmd: exec.CommandContext(ctx, name, arg...), ctx: ctx}
+}
+
+// Start starts the command, as with exec.Cmd.Start, starting a span
+// which will be ended when the command completes. Wait must be called
+// to end the span.
+func (c *Cmd) Start() error {
+	tx := apm.TransactionFromContext(c.ctx)
+	if tx != nil {
+		ctx := c.ctx
+		if tx.TraceContext().Options.Recorded() {
+			span, spanCtx := apm.StartSpan(c.ctx, spanName(c.Cmd), "process")
+			if !span.Dropped() {
+				span.Action = "execute"
+				c.span = span
+				ctx = spanCtx
+			} else {
+				span.End()
+			}
+		}
+		env := c.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		c.Env = apm.InjectTraceContextEnv(ctx, env)
+	}
+	if err := c.Cmd.Start(); err != nil {
+		c.endSpan(err)
+		return err
+	}
+	return nil
+}
+
+// Wait waits for the command to exit, as with exec.Cmd.Wait, and then
+// ends the span started by Start. The span's outcome will be "failure"
+// if the command exits with a non-zero exit code, or otherwise fails.
+func (c *Cmd) Wait() error {
+	err := c.Cmd.Wait()
+	c.endSpan(err)
+	return err
+}
+
+// Run starts the command and waits for it to complete,
+// as with exec.Cmd.Run.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the command and returns its standard output,
+// as with exec.Cmd.Output.
+func (c *Cmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	captureErr := c.Stderr == nil
+	if captureErr {
+		c.Stderr = &stderr
+	}
+	err := c.Run()
+	if err != nil && captureErr {
+		if ee, ok := err.(*exec.ExitError); ok {
+			ee.Stderr = stderr.Bytes()
+		}
+	}
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its combined standard
+// output and standard error, as with exec.Cmd.CombinedOutput.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	if c.Stderr != nil {
+		return nil, errors.New("exec: Stderr already set")
+	}
+	var b bytes.Buffer
+	c.Stdout = &b
+	c.Stderr = &b
+	err := c.Run()
+	return b.Bytes(), err
+}
+
+func (c *Cmd) endSpan(err error) {
+	span := c.span
+	if span == nil {
+		return
+	}
+	c.span = nil
+	if c.ProcessState != nil {
+		span.Context.SetLabel("exit_code", c.ProcessState.ExitCode())
+	}
+	if err != nil {
+		span.Outcome = "failure"
+		if _, ok := err.(*exec.ExitError); !ok {
+			// Non-exit errors, such as failing to find the
+			// program, are unexpected and should be reported.
+			if e := apm.CaptureError(apm.ContextWithSpan(c.ctx, span), err); e != nil {
+				e.Send()
+			}
+		}
+	} else {
+		span.Outcome = "success"
+	}
+	span.End()
+}
+
+// spanName returns the span name for cmd: the base name of the program.
+// Arguments are omitted, as they may contain sensitive information.
+func spanName(cmd *exec.Cmd) string {
+	return filepath.Base(cmd.Path)
+}
@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !windows
+
+package apmexec_test
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmexec"
+	"go.elastic.co/apm/module/apmhttp"
+)
+
+func TestCommandContext(t *testing.T) {
+	var output []byte
+	tx, spans, errors := apmtest.WithTransaction(func(ctx context.Context) {
+		cmd := apmexec.CommandContext(ctx, "sh", "-c", "echo $TRACEPARENT")
+		var err error
+		output, err = cmd.Output()
+		require.NoError(t, err)
+	})
+	require.Len(t, spans, 1)
+	assert.Empty(t, errors)
+
+	span := spans[0]
+	assert.Equal(t, "sh", span.Name)
+	assert.Equal(t, "process", span.Type)
+	assert.Equal(t, "execute", span.Action)
+	assert.Equal(t, "success", span.Outcome)
+	assert.Equal(t, tx.ID, span.ParentID)
+	assert.Equal(t, &model.SpanContext{
+		Tags: model.IfaceMap{{Key: "exit_code", Value: float64(0)}},
+	}, span.Context)
+
+	// The subprocess receives the span's trace context.
+	traceContext, err := apmhttp.ParseTraceparentHeader(strings.TrimSpace(string(output)))
+	require.NoError(t, err)
+	assert.Equal(t, model.TraceID(traceContext.Trace), span.TraceID)
+	assert.Equal(t, model.SpanID(traceContext.Span), span.ID)
+	assert.True(t, traceContext.Options.Recorded())
+}
+
+func TestCommandContextExitCode(t *testing.T) {
+	_, spans, errors := apmtest.WithTransaction(func(ctx context.Context) {
+		err := apmexec.CommandContext(ctx, "sh", "-c", "exit 3").Run()
+		require.Error(t, err)
+		assert.IsType(t, &exec.ExitError{}, err)
+	})
+	require.Len(t, spans, 1)
+	assert.Empty(t, errors) // non-zero exit codes are not reported as errors
+
+	assert.Equal(t, "failure", spans[0].Outcome)
+	assert.Equal(t, &model.SpanContext{
+		Tags: model.IfaceMap{{Key: "exit_code", Value: float64(3)}},
+	}, spans[0].Context)
+}
+
+func TestCommandContextStartError(t *testing.T) {
+	_, spans, errors := apmtest.WithTransaction(func(ctx context.Context) {
+		err := apmexec.CommandContext(ctx, "/nonexistent/command").Run()
+		require.Error(t, err)
+	})
+	require.Len(t, spans, 1)
+	require.Len(t, errors, 1)
+	assert.Equal(t, "command", spans[0].Name)
+	assert.Equal(t, "failure", spans[0].Outcome)
+	assert.Nil(t, spans[0].Context)
+	assert.Equal(t, spans[0].ID, errors[0].ParentID)
+}
+
+func TestCommandContextEnv(t *testing.T) {
+	var output []byte
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		cmd := apmexec.CommandContext(ctx, "sh", "-c", "env")
+		cmd.Env = []string{"FOO=bar", "TRACEPARENT=stale"}
+		var err error
+		output, err = cmd.CombinedOutput()
+		require.NoError(t, err)
+	})
+	require.Len(t, spans, 1)
+
+	env := strings.Split(strings.TrimSpace(string(output)), "\n")
+	assert.Contains(t, env, "FOO=bar")
+	assert.NotContains(t, env, "TRACEPARENT=stale")
+	assert.Contains(t, env, fmt.Sprintf("TRACEPARENT=00-%x-%x-01", spans[0].TraceID[:], spans[0].ID[:]))
+}
+
+func TestCommandContextNoTransaction(t *testing.T) {
+	output, err := apmexec.CommandContext(context.Background(), "sh", "-c", `printf "%s" "$TRACEPARENT"`).Output()
+	require.NoError(t, err)
+	assert.Empty(t, output)
+}
@@ -0,0 +1,13 @@
+module go.elastic.co/apm/module/apmexec
+
+require (
+	github.com/stretchr/testify v1.4.0
+	go.elastic.co/apm v1.7.2
+	go.elastic.co/apm/module/apmhttp v1.7.2
+)
+
+replace go.elastic.co/apm => ../..
+
+replace go.elastic.co/apm/module/apmhttp => ../apmhttp
+
+go 1.13
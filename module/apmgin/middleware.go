@@ -20,6 +20,7 @@ package apmgin
 import (
 	"net/http"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 
@@ -45,9 +46,11 @@ func init() {
 // Use WithTracer to specify an alternative tracer.
 func Middleware(engine *gin.Engine, o ...Option) gin.HandlerFunc {
 	m := &middleware{
-		engine:         engine,
-		tracer:         apm.DefaultTracer,
-		requestIgnorer: apmhttp.DefaultServerRequestIgnorer(),
+		engine:               engine,
+		tracer:               apm.DefaultTracer,
+		requestIgnorer:       apmhttp.DefaultServerRequestIgnorer(),
+		maxPathParams:        DefaultMaxPathParams,
+		maxPathParamValueLen: DefaultMaxPathParamValueLength,
 	}
 	for _, o := range o {
 		o(m)
@@ -59,6 +62,11 @@ type middleware struct {
 	engine         *gin.Engine
 	tracer         *apm.Tracer
 	requestIgnorer apmhttp.RequestIgnorerFunc
+	middlewareSpan bool
+
+	pathParamsAsLabels   bool
+	maxPathParams        int
+	maxPathParamValueLen int
 
 	setRouteMapOnce sync.Once
 	routeMap        map[string]map[string]routeInfo
@@ -91,7 +99,8 @@ func (m *middleware) handle(c *gin.Context) {
 
 	var requestName string
 	handlerName := c.HandlerName()
-	if routeInfo, ok := m.routeMap[c.Request.Method][handlerName]; ok {
+	routeInfo, routeMatched := m.routeMap[c.Request.Method][handlerName]
+	if routeMatched {
 		requestName = routeInfo.transactionName
 	} else {
 		requestName = apmhttp.UnknownRouteRequestName(c.Request)
@@ -100,6 +109,19 @@ func (m *middleware) handle(c *gin.Context) {
 	c.Request = req
 	defer tx.End()
 
+	if m.middlewareSpan {
+		ms := apmhttp.StartMiddlewareSpan(tx)
+		c.Set(middlewareSpanKey, ms)
+		defer func() {
+			// If the request was aborted before reaching
+			// HandlerEntry, the time was spent entirely
+			// in middleware.
+			if c.IsAborted() {
+				ms.End()
+			}
+		}()
+	}
+
 	body := m.tracer.CaptureHTTPRequestBody(c.Request)
 	defer func() {
 		if v := recover(); v != nil {
@@ -108,7 +130,7 @@ func (m *middleware) handle(c *gin.Context) {
 			} else {
 				c.Abort()
 			}
-			e := m.tracer.Recovered(v)
+			e := apmhttp.RecoveredError(m.tracer, v)
 			e.SetTransaction(tx)
 			setContext(&e.Context, c, body)
 			e.Send()
@@ -118,6 +140,9 @@ func (m *middleware) handle(c *gin.Context) {
 
 		if tx.Sampled() {
 			setContext(&tx.Context, c, body)
+			if m.pathParamsAsLabels && routeMatched {
+				m.setPathParamLabels(&tx.Context, c.Params)
+			}
 		}
 
 		for _, err := range c.Errors {
@@ -132,6 +157,30 @@ func (m *middleware) handle(c *gin.Context) {
 	c.Next()
 }
 
+// setPathParamLabels records the route's path parameters as labels,
+// subject to the configured limits.
+func (m *middleware) setPathParamLabels(ctx *apm.Context, params gin.Params) {
+	for i, param := range params {
+		if m.maxPathParams >= 0 && i >= m.maxPathParams {
+			break
+		}
+		ctx.SetLabel(PathParamLabelPrefix+param.Key, truncatePathParam(param.Value, m.maxPathParamValueLen))
+	}
+}
+
+// truncatePathParam truncates value to at most n bytes, without
+// splitting multi-byte characters. If n is negative, value is
+// returned unmodified.
+func truncatePathParam(value string, n int) string {
+	if n < 0 || len(value) <= n {
+		return value
+	}
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n]
+}
+
 func setContext(ctx *apm.Context, c *gin.Context, body *apm.BodyCapturer) {
 	ctx.SetFramework("gin", gin.Version)
 	ctx.SetHTTPRequest(c.Request)
@@ -140,6 +189,41 @@ func setContext(ctx *apm.Context, c *gin.Context, body *apm.BodyCapturer) {
 	ctx.SetHTTPResponseHeaders(c.Writer.Header())
 }
 
+// HandlerEntry returns a Gin handler which marks the boundary
+// between middleware and the request handler, for use with
+// WithMiddlewareSpan. HandlerEntry should be added after all
+// other middleware, e.g.
+//
+//	engine.Use(apmgin.Middleware(engine, apmgin.WithMiddlewareSpan()))
+//	engine.Use(auth, cors, rateLimit)
+//	engine.Use(apmgin.HandlerEntry())
+func HandlerEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, ok := c.Get(middlewareSpanKey); ok {
+			v.(*apmhttp.MiddlewareSpan).End()
+		}
+		c.Next()
+	}
+}
+
+const middlewareSpanKey = "go.elastic.co/apm/module/apmgin.middlewareSpan"
+
+const (
+	// PathParamLabelPrefix is the prefix of the labels recorded for
+	// path parameters when WithPathParamsAsLabels is used, e.g. the
+	// parameter "id" is recorded as the label "path_param_id".
+	PathParamLabelPrefix = "path_param_"
+
+	// DefaultMaxPathParams is the default maximum number of path
+	// parameters recorded as labels by WithPathParamsAsLabels.
+	DefaultMaxPathParams = 10
+
+	// DefaultMaxPathParamValueLength is the default maximum length,
+	// in bytes, of path parameter values recorded as labels by
+	// WithPathParamsAsLabels.
+	DefaultMaxPathParamValueLength = 128
+)
+
 // Option sets options for tracing.
 type Option func(*middleware)
 
@@ -165,3 +249,51 @@ func WithRequestIgnorer(r apmhttp.RequestIgnorerFunc) Option {
 		m.requestIgnorer = r
 	}
 }
+
+// WithMiddlewareSpan returns an Option which enables reporting
+// the time spent in middleware, from the start of the transaction
+// until the request handler is entered, as a span named "middleware"
+// of type "app.middleware".
+//
+// The boundary between middleware and the request handler must be
+// marked by adding HandlerEntry after all other middleware. At most
+// one additional span is reported for each request: if the request
+// is aborted by middleware before reaching HandlerEntry, then the
+// span covers all of the middleware that ran; if the request is
+// neither aborted nor reaches HandlerEntry, no span is reported.
+func WithMiddlewareSpan() Option {
+	return func(m *middleware) {
+		m.middlewareSpan = true
+	}
+}
+
+// WithPathParamsAsLabels returns an Option which enables recording the
+// request's path parameters (gin.Context.Params) as transaction labels,
+// e.g. for the route "/users/:id", the request "/users/123" will have
+// the label "path_param_id" with the value "123". This allows filtering
+// traces to those concerning a specific entity.
+//
+// Path parameters are only recorded for sampled transactions, and only
+// when the request matched a route. At most DefaultMaxPathParams labels
+// are recorded, and values are truncated to DefaultMaxPathParamValueLength
+// bytes; use WithPathParamsLimits to change these limits.
+//
+// Path parameters may contain personally identifiable information, and
+// each distinct value adds to the cardinality of labels stored by the APM
+// Server, so this option should be used with care.
+func WithPathParamsAsLabels() Option {
+	return func(m *middleware) {
+		m.pathParamsAsLabels = true
+	}
+}
+
+// WithPathParamsLimits returns an Option which sets the maximum number of
+// path parameters, and the maximum length in bytes of their values, that
+// are recorded as labels when WithPathParamsAsLabels is used. A negative
+// value for either limit means no limit.
+func WithPathParamsLimits(maxParams, maxValueLength int) Option {
+	return func(m *middleware) {
+		m.maxPathParams = maxParams
+		m.maxPathParamValueLen = maxValueLength
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
@@ -30,6 +31,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"go.elastic.co/apm"
 	"go.elastic.co/apm/apmtest"
 	"go.elastic.co/apm/model"
 	"go.elastic.co/apm/module/apmgin"
@@ -215,3 +217,110 @@ func doRequest(e *gin.Engine, method, url string) *httptest.ResponseRecorder {
 	e.ServeHTTP(w, req)
 	return w
 }
+
+func TestMiddlewareSpan(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	e := gin.New()
+	e.Use(apmgin.Middleware(e, apmgin.WithTracer(tracer), apmgin.WithMiddlewareSpan()))
+	e.Use(func(c *gin.Context) {
+		time.Sleep(10 * time.Millisecond)
+		if c.GetHeader("Authorization") == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	})
+	e.Use(apmgin.HandlerEntry())
+	e.GET("/hello/:name", handleHello)
+
+	for _, auth := range []string{"secret", ""} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://server.testing/hello/isbel", nil)
+		req.Header.Set("Authorization", auth)
+		e.ServeHTTP(w, req)
+	}
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	require.Len(t, payloads.Spans, 2)
+	for i, span := range payloads.Spans {
+		tx := payloads.Transactions[i]
+		assert.Equal(t, "middleware", span.Name)
+		assert.Equal(t, "app", span.Type)
+		assert.Equal(t, "middleware", span.Subtype)
+		assert.Equal(t, tx.ID, span.ParentID)
+		assert.True(t, span.Duration >= 10)
+		assert.True(t, span.Duration <= tx.Duration)
+	}
+	assert.Equal(t, "HTTP 2xx", payloads.Transactions[0].Result)
+	assert.Equal(t, "HTTP 4xx", payloads.Transactions[1].Result)
+}
+
+func TestMiddlewareSpanNoHandlerEntry(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	e := gin.New()
+	e.Use(apmgin.Middleware(e, apmgin.WithTracer(tracer), apmgin.WithMiddlewareSpan()))
+	e.GET("/hello/:name", handleHello)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://server.testing/hello/isbel", nil)
+	e.ServeHTTP(w, req)
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Len(t, payloads.Spans, 0)
+}
+
+func TestMiddlewarePathParamsAsLabels(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	e := gin.New()
+	e.Use(apmgin.Middleware(e,
+		apmgin.WithTracer(tracer),
+		apmgin.WithPathParamsAsLabels(),
+		apmgin.WithPathParamsLimits(2, 2),
+	))
+	e.GET("/orgs/:org/users/:user/items/:item", func(c *gin.Context) {})
+
+	for _, url := range []string{
+		"http://server.testing/orgs/acme/users/aŝb/items/3",
+		"http://server.testing/unknown",
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "path_param_org", Value: "ac"},
+		{Key: "path_param_user", Value: "a"}, // not split mid-character
+	}, payloads.Transactions[0].Context.Tags)
+
+	// No labels are recorded when the request does not match a route.
+	assert.Nil(t, payloads.Transactions[1].Context.Tags)
+}
+
+func TestMiddlewarePathParamsAsLabelsUnsampled(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(apm.NewRatioSampler(0))
+
+	e := gin.New()
+	e.Use(apmgin.Middleware(e, apmgin.WithTracer(tracer), apmgin.WithPathParamsAsLabels()))
+	e.GET("/users/:user", func(c *gin.Context) {})
+
+	req, _ := http.NewRequest("GET", "http://server.testing/users/123", nil)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Nil(t, payloads.Transactions[0].Context)
+}
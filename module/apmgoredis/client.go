@@ -150,7 +150,7 @@ func process(ctx context.Context) func(oldProcess func(cmd redis.Cmder) error) f
 	return func(oldProcess func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
 		return func(cmd redis.Cmder) error {
 			spanName := strings.ToUpper(cmd.Name())
-			span, _ := apm.StartSpan(ctx, spanName, "db.redis")
+			span, _ := startSpan(ctx, spanName, strings.ToLower(cmd.Name()))
 			defer span.End()
 
 			return oldProcess(cmd)
@@ -161,7 +161,7 @@ func process(ctx context.Context) func(oldProcess func(cmd redis.Cmder) error) f
 func processPipeline(ctx context.Context) func(oldProcess func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
 	return func(oldProcess func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
 		return func(cmds []redis.Cmder) error {
-			pipelineSpan, ctx := apm.StartSpan(ctx, "(pipeline)", "db.redis")
+			pipelineSpan, ctx := startSpan(ctx, "(pipeline)", "pipeline")
 
 			for i := len(cmds); i > 0; i-- {
 				cmdName := strings.ToUpper(cmds[i-1].Name())
@@ -169,7 +169,7 @@ func processPipeline(ctx context.Context) func(oldProcess func(cmds []redis.Cmde
 					cmdName = "(empty command)"
 				}
 
-				span, _ := apm.StartSpan(ctx, cmdName, "db.redis")
+				span, _ := startSpan(ctx, cmdName, strings.ToLower(cmds[i-1].Name()))
 				defer span.End()
 			}
 
@@ -179,3 +179,17 @@ func processPipeline(ctx context.Context) func(oldProcess func(cmds []redis.Cmde
 		}
 	}
 }
+
+// startSpan starts a span for a redis command, or pipeline of commands,
+// with the given action. If action is empty, "unknown" is used.
+func startSpan(ctx context.Context, name, action string) (*apm.Span, context.Context) {
+	span, ctx := apm.StartSpan(ctx, name, "db.redis")
+	if !span.Dropped() {
+		if action == "" {
+			action = "unknown"
+		}
+		span.SetTypeSubtypeAction("db", "redis", action)
+		span.Context.SetServiceTarget(apm.ServiceTargetSpanContext{Type: "redis"})
+	}
+	return span, ctx
+}
@@ -31,6 +31,7 @@ import (
 
 	"go.elastic.co/apm"
 	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
 	"go.elastic.co/apm/module/apmgoredis"
 )
 
@@ -97,6 +98,11 @@ func TestWrap(t *testing.T) {
 			assert.Equal(t, "PING", spans[0].Name)
 			assert.Equal(t, "db", spans[0].Type)
 			assert.Equal(t, "redis", spans[0].Subtype)
+			assert.Equal(t, "ping", spans[0].Action)
+			require.NotNil(t, spans[0].Context)
+			assert.Equal(t, &model.ServiceSpanContext{
+				Target: &model.ServiceTargetSpanContext{Type: "redis"},
+			}, spans[0].Context.Service)
 		})
 	}
 }
@@ -143,7 +149,9 @@ func TestWrapPipeline(t *testing.T) {
 
 			require.Len(t, spans, 3)
 			assert.Equal(t, "(pipeline)", spans[0].Name)
+			assert.Equal(t, "pipeline", spans[0].Action)
 			assert.Equal(t, "(empty command)", spans[1].Name)
+			assert.Equal(t, "unknown", spans[1].Action)
 			assert.Equal(t, "(empty command)", spans[2].Name)
 		})
 	}
@@ -0,0 +1,280 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgorillaws
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+
+	"go.elastic.co/apm"
+)
+
+const (
+	// TransactionType is the type of transactions representing
+	// WebSocket connections.
+	TransactionType = "websocket"
+
+	// MessagesReadLabel is the name of the transaction label in which
+	// the number of messages read from the connection is recorded.
+	MessagesReadLabel = "websocket_messages_read"
+
+	// MessagesWrittenLabel is the name of the transaction label in which
+	// the number of messages written to the connection is recorded.
+	MessagesWrittenLabel = "websocket_messages_written"
+
+	// BytesReadLabel is the name of the transaction label in which
+	// the number of message bytes read from the connection is recorded.
+	BytesReadLabel = "websocket_bytes_read"
+
+	// BytesWrittenLabel is the name of the transaction label in which
+	// the number of message bytes written to the connection is recorded.
+	BytesWrittenLabel = "websocket_bytes_written"
+)
+
+// Conn wraps a *websocket.Conn, recording the number of messages and
+// bytes read and written over the lifetime of the connection in a
+// transaction representing the connection.
+//
+// Messages are only recorded when using the ReadMessage, WriteMessage,
+// ReadJSON, and WriteJSON methods. Like websocket.Conn, Conn supports
+// one concurrent reader and one concurrent writer.
+type Conn struct {
+	// These fields are accessed atomically, and must come
+	// first for 64-bit alignment.
+	messagesRead    int64
+	messagesWritten int64
+	bytesRead       int64
+	bytesWritten    int64
+	messageSpans    int64
+
+	*websocket.Conn
+	tx              *apm.Transaction
+	maxMessageSpans int64
+	closeOnce       sync.Once
+}
+
+// Wrap returns a Conn wrapping conn, which must have been created by
+// upgrading req. A transaction representing the connection is started,
+// and ended by Conn.Close, which must be called when the connection is
+// no longer needed.
+//
+// If req's context contains a transaction, e.g. because the upgrade
+// handler is wrapped with apmhttp.Wrap, the connection's transaction
+// will be its child.
+func Wrap(req *http.Request, conn *websocket.Conn, o ...Option) *Conn {
+	opts := options{tracer: apm.DefaultTracer}
+	for _, o := range o {
+		o(&opts)
+	}
+	var txOpts apm.TransactionOptions
+	if tx := apm.TransactionFromContext(req.Context()); tx != nil {
+		txOpts.TraceContext = tx.TraceContext()
+	}
+	tx := opts.tracer.StartTransactionOptions("WebSocket "+req.URL.Path, TransactionType, txOpts)
+	return &Conn{
+		Conn:            conn,
+		tx:              tx,
+		maxMessageSpans: int64(opts.maxMessageSpans),
+	}
+}
+
+// Transaction returns the transaction representing the connection.
+func (c *Conn) Transaction() *apm.Transaction {
+	return c.tx
+}
+
+// ReadMessage reads a message from the connection, as with
+// websocket.Conn.ReadMessage, recording the message.
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	messageType, r, err := c.Conn.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+	if span := c.startMessageSpan("WebSocket read", "read"); span != nil {
+		defer span.End()
+	}
+	p, err = ioutil.ReadAll(r)
+	c.recordRead(len(p))
+	return messageType, p, err
+}
+
+// ReadJSON reads a JSON-encoded message from the connection and stores
+// it in the value pointed to by v, as with websocket.Conn.ReadJSON,
+// recording the message.
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, r, err := c.Conn.NextReader()
+	if err != nil {
+		return err
+	}
+	if span := c.startMessageSpan("WebSocket read", "read"); span != nil {
+		defer span.End()
+	}
+	cr := &countingReader{r: r}
+	defer func() { c.recordRead(int(cr.n)) }()
+	err = json.NewDecoder(cr).Decode(v)
+	if err == io.EOF {
+		// One value is expected in the message.
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// WriteMessage writes a message to the connection, as with
+// websocket.Conn.WriteMessage, recording the message.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		// Control messages are not recorded.
+		return c.Conn.WriteMessage(messageType, data)
+	}
+	if span := c.startMessageSpan("WebSocket write", "write"); span != nil {
+		defer span.End()
+	}
+	if err := c.Conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	c.recordWrite(len(data))
+	return nil
+}
+
+// WriteJSON writes the JSON encoding of v as a message to the connection,
+// as with websocket.Conn.WriteJSON, recording the message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	if span := c.startMessageSpan("WebSocket write", "write"); span != nil {
+		defer span.End()
+	}
+	w, err := c.Conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	cw := &countingWriter{w: w}
+	err1 := json.NewEncoder(cw).Encode(v)
+	err2 := w.Close()
+	if err1 != nil {
+		return err1
+	}
+	if err2 == nil {
+		c.recordWrite(int(cw.n))
+	}
+	return err2
+}
+
+// Close closes the underlying connection, and ends the connection's
+// transaction, recording the message counts as transaction labels.
+// The transaction is ended only by the first call to Close.
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		if c.tx.Sampled() {
+			c.tx.Context.SetLabel(MessagesReadLabel, atomic.LoadInt64(&c.messagesRead))
+			c.tx.Context.SetLabel(MessagesWrittenLabel, atomic.LoadInt64(&c.messagesWritten))
+			c.tx.Context.SetLabel(BytesReadLabel, atomic.LoadInt64(&c.bytesRead))
+			c.tx.Context.SetLabel(BytesWrittenLabel, atomic.LoadInt64(&c.bytesWritten))
+		}
+		c.tx.End()
+	})
+	return err
+}
+
+// startMessageSpan starts a span for a message, if per-message spans
+// are enabled and the limit has not been reached. Otherwise it returns
+// nil.
+func (c *Conn) startMessageSpan(name, action string) *apm.Span {
+	if c.maxMessageSpans <= 0 {
+		return nil
+	}
+	if atomic.AddInt64(&c.messageSpans, 1) > c.maxMessageSpans {
+		return nil
+	}
+	span := c.tx.StartSpan(name, "websocket", nil)
+	span.Action = action
+	return span
+}
+
+func (c *Conn) recordRead(n int) {
+	atomic.AddInt64(&c.messagesRead, 1)
+	atomic.AddInt64(&c.bytesRead, int64(n))
+}
+
+func (c *Conn) recordWrite(n int) {
+	atomic.AddInt64(&c.messagesWritten, 1)
+	atomic.AddInt64(&c.bytesWritten, int64(n))
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+type options struct {
+	tracer          *apm.Tracer
+	maxMessageSpans int
+}
+
+// Option sets options for tracing WebSocket connections.
+type Option func(*options)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing WebSocket connections.
+func WithTracer(t *apm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
+// WithMessageSpans returns an Option which enables reporting a span
+// for each message read or written, up to max spans per connection.
+// Messages beyond the limit are still counted. Per-message spans are
+// disabled by default, as connections may be long-lived and exchange
+// many messages.
+//
+// Read spans measure the time taken to read a message once it starts
+// arriving, excluding the time spent waiting for the message.
+func WithMessageSpans(max int) Option {
+	if max <= 0 {
+		panic("max <= 0")
+	}
+	return func(o *options) {
+		o.maxMessageSpans = max
+	}
+}
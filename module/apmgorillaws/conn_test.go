@@ -0,0 +1,203 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgorillaws_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmgorillaws"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestConn(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := newEchoServer(t, apmgorillaws.WithTracer(tracer))
+	defer server.Close()
+	conn := dial(t, server.URL+"/echo")
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+	require.NoError(t, conn.WriteJSON(map[string]string{"a": "b"}))
+	_, p, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(p))
+	_, p, err = conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "{\"a\":\"b\"}\n", string(p))
+	closeConn(t, conn)
+	<-server.done
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Empty(t, payloads.Spans)
+	tx := payloads.Transactions[0]
+	assert.Equal(t, "WebSocket /echo", tx.Name)
+	assert.Equal(t, "websocket", tx.Type)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "websocket_bytes_read", Value: float64(15)},
+		{Key: "websocket_bytes_written", Value: float64(15)},
+		{Key: "websocket_messages_read", Value: float64(2)},
+		{Key: "websocket_messages_written", Value: float64(2)},
+	}, tx.Context.Tags)
+}
+
+func TestConnMessageSpans(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := newEchoServer(t, apmgorillaws.WithTracer(tracer), apmgorillaws.WithMessageSpans(3))
+	defer server.Close()
+	conn := dial(t, server.URL)
+	defer conn.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte("x")))
+		_, _, err := conn.ReadMessage()
+		require.NoError(t, err)
+	}
+	closeConn(t, conn)
+	<-server.done
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Spans, 3)
+	assert.Equal(t, "WebSocket read", payloads.Spans[0].Name)
+	assert.Equal(t, "websocket", payloads.Spans[0].Type)
+	assert.Equal(t, "read", payloads.Spans[0].Action)
+	assert.Equal(t, "WebSocket write", payloads.Spans[1].Name)
+	assert.Equal(t, "write", payloads.Spans[1].Action)
+	for _, span := range payloads.Spans {
+		assert.Equal(t, payloads.Transactions[0].ID, span.ParentID)
+	}
+	assert.Contains(t, payloads.Transactions[0].Context.Tags, model.IfaceMapItem{
+		Key: "websocket_messages_read", Value: float64(3),
+	})
+}
+
+func TestConnJSON(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	server := newServer(t, func(conn *apmgorillaws.Conn) {
+		var v map[string]int
+		if assert.NoError(t, conn.ReadJSON(&v)) {
+			v["n"]++
+			assert.NoError(t, conn.WriteJSON(v))
+		}
+	}, apmgorillaws.WithTracer(tracer), apmgorillaws.WithMessageSpans(10))
+	defer server.Close()
+	conn := dial(t, server.URL)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"n":1}`)))
+	var v map[string]int
+	require.NoError(t, conn.ReadJSON(&v))
+	assert.Equal(t, map[string]int{"n": 2}, v)
+	<-server.done
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Len(t, payloads.Spans, 2)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "websocket_bytes_read", Value: float64(7)},
+		{Key: "websocket_bytes_written", Value: float64(8)},
+		{Key: "websocket_messages_read", Value: float64(1)},
+		{Key: "websocket_messages_written", Value: float64(1)},
+	}, payloads.Transactions[0].Context.Tags)
+}
+
+func TestWrapParentTransaction(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	parent := tracer.StartTransaction("GET /ws", "request")
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req = req.WithContext(apm.ContextWithTransaction(req.Context(), parent))
+	conn := apmgorillaws.Wrap(req, nil, apmgorillaws.WithTracer(tracer))
+	conn.Transaction().End()
+	parent.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	assert.Equal(t, payloads.Transactions[1].ID, payloads.Transactions[0].ParentID)
+	assert.Equal(t, payloads.Transactions[1].TraceID, payloads.Transactions[0].TraceID)
+}
+
+type echoServer struct {
+	*httptest.Server
+	done chan struct{}
+}
+
+// newEchoServer returns a server which echoes messages received on
+// WebSocket connections, tracing connections with the given options.
+// The server handles a single connection, closing done when it ends.
+func newEchoServer(t *testing.T, o ...apmgorillaws.Option) *echoServer {
+	return newServer(t, func(conn *apmgorillaws.Conn) {
+		for {
+			messageType, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, p); err != nil {
+				return
+			}
+		}
+	}, o...)
+}
+
+func newServer(t *testing.T, handle func(*apmgorillaws.Conn), o ...apmgorillaws.Option) *echoServer {
+	done := make(chan struct{})
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer close(done)
+		wsconn, err := upgrader.Upgrade(w, req, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		conn := apmgorillaws.Wrap(req, wsconn, o...)
+		defer conn.Close()
+		handle(conn)
+	}))
+	return &echoServer{Server: server, done: done}
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	require.NoError(t, err)
+	return conn
+}
+
+func closeConn(t *testing.T, conn *websocket.Conn) {
+	err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	require.NoError(t, err)
+}
@@ -0,0 +1,11 @@
+module go.elastic.co/apm/module/apmgorillaws
+
+require (
+	github.com/gorilla/websocket v1.5.0
+	github.com/stretchr/testify v1.4.0
+	go.elastic.co/apm v1.7.2
+)
+
+replace go.elastic.co/apm => ../..
+
+go 1.13
@@ -0,0 +1,243 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgqlgen
+
+import (
+	"context"
+	"strings"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/module/apmhttp"
+)
+
+const (
+	// TransactionType is the type of transactions created
+	// for GraphQL operations.
+	TransactionType = "graphql"
+
+	// ResolverSpanType is the type of spans created for
+	// GraphQL field resolvers.
+	ResolverSpanType = "app.graphql.resolve"
+
+	extensionName = "ElasticAPM"
+)
+
+// Tracer is a gqlgen extension for tracing GraphQL operations.
+//
+// Tracer implements graphql.HandlerExtension, and should be added
+// to a gqlgen server with its Use method. A Tracer should be used
+// with at most one server.
+type Tracer struct {
+	tracer *apm.Tracer
+	schema graphql.ExecutableSchema
+}
+
+// NewTracer returns a new Tracer, for tracing GraphQL operations.
+//
+// Each operation is traced as a transaction of type "graphql",
+// named by the operation type and name, e.g. "query GetUser".
+// Anonymous operations are named by their type alone. The
+// operation's complexity is recorded as the transaction label
+// "graphql_complexity", and the errors included in the response
+// are reported as errors associated with the transaction.
+//
+// Operations sent as automatic persisted queries have the query
+// hash recorded as the label "graphql_persisted_query_hash".
+//
+// If the context contains a transaction or span, e.g. because the
+// HTTP handler is wrapped with apmhttp.Wrap, then the operation
+// transaction will be a child of it. Otherwise, any trace context
+// in the request headers is used as the parent. When multiple
+// operations are batched in a single request, each operation is
+// traced as a separate transaction.
+//
+// Field resolvers are traced as spans of type "app.graphql.resolve",
+// named by the object type and field name, e.g. "Query.user". Fields
+// without user-specified resolvers are not traced.
+//
+// By default, the tracer will trace with apm.DefaultTracer.
+// Use WithTracer to specify an alternative tracer.
+func NewTracer(o ...Option) *Tracer {
+	opts := options{tracer: apm.DefaultTracer}
+	for _, o := range o {
+		o(&opts)
+	}
+	return &Tracer{tracer: opts.tracer}
+}
+
+// ExtensionName returns the name of the extension.
+func (t *Tracer) ExtensionName() string {
+	return extensionName
+}
+
+// Validate records the executable schema, for use in
+// calculating operation complexity.
+func (t *Tracer) Validate(schema graphql.ExecutableSchema) error {
+	t.schema = schema
+	return nil
+}
+
+// InterceptOperation traces the operation as a transaction.
+func (t *Tracer) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	if !t.tracer.Active() || !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+	oc := graphql.GetOperationContext(ctx)
+	tx := t.tracer.StartTransactionOptions(operationName(oc), TransactionType, apm.TransactionOptions{
+		TraceContext: parentTraceContext(ctx, oc),
+	})
+	if tx.Sampled() {
+		if complexity := t.operationComplexity(ctx, oc); complexity > 0 {
+			tx.Context.SetLabel("graphql_complexity", complexity)
+		}
+		if stats := extension.GetApqStats(ctx); stats != nil {
+			tx.Context.SetLabel("graphql_persisted_query_hash", stats.Hash)
+		}
+	}
+	ctx = apm.ContextWithTransaction(ctx, tx)
+
+	subscription := oc.Operation != nil && oc.Operation.Operation == ast.Subscription
+	responses := next(ctx)
+	var ended bool
+	return func(ctx context.Context) *graphql.Response {
+		response := responses(ctx)
+		if ended {
+			return response
+		}
+		if response != nil {
+			t.reportErrors(tx, response.Errors)
+			if len(response.Errors) > 0 {
+				tx.Result = "error"
+				tx.Outcome = "failure"
+			} else if tx.Result == "" {
+				tx.Result = "success"
+				tx.Outcome = "success"
+			}
+		}
+		if response == nil || !subscription {
+			// Queries and mutations have a single response,
+			// while subscriptions produce responses until
+			// the response handler returns nil.
+			ended = true
+			tx.End()
+		}
+		return response
+	}
+}
+
+// InterceptField traces resolvers as spans.
+func (t *Tracer) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+	span, ctx := apm.StartSpan(ctx, fc.Object+"."+fc.Field.Name, ResolverSpanType)
+	defer span.End()
+	if !span.Dropped() {
+		span.Context.SetLabel("graphql_field_path", fc.Path().String())
+	}
+	return next(ctx)
+}
+
+func (t *Tracer) operationComplexity(ctx context.Context, oc *graphql.OperationContext) int {
+	if stats := extension.GetComplexityStats(ctx); stats != nil {
+		return stats.Complexity
+	}
+	if t.schema == nil || oc.Operation == nil {
+		return 0
+	}
+	return complexity.Calculate(t.schema, oc.Operation, oc.Variables)
+}
+
+func (t *Tracer) reportErrors(tx *apm.Transaction, errs gqlerror.List) {
+	for _, err := range errs {
+		e := t.tracer.NewError(err)
+		e.Handled = true
+		e.SetTransaction(tx)
+		if len(err.Path) > 0 {
+			e.Context.SetLabel("graphql_error_path", err.Path.String())
+		}
+		e.Send()
+	}
+}
+
+// operationName returns the transaction name for the operation,
+// e.g. "query GetUser".
+func operationName(oc *graphql.OperationContext) string {
+	if oc.Operation == nil {
+		return "GraphQL"
+	}
+	var name strings.Builder
+	name.WriteString(string(oc.Operation.Operation))
+	if oc.Operation.Name != "" {
+		name.WriteRune(' ')
+		name.WriteString(oc.Operation.Name)
+	}
+	return name.String()
+}
+
+// parentTraceContext returns the trace context of the transaction
+// or span in ctx, if any, or otherwise the trace context encoded
+// in the request headers.
+func parentTraceContext(ctx context.Context, oc *graphql.OperationContext) apm.TraceContext {
+	if span := apm.SpanFromContext(ctx); span != nil {
+		return span.TraceContext()
+	}
+	if tx := apm.TransactionFromContext(ctx); tx != nil {
+		return tx.TraceContext()
+	}
+	if oc.Headers == nil {
+		return apm.TraceContext{}
+	}
+	header := oc.Headers.Get(apmhttp.W3CTraceparentHeader)
+	if header == "" {
+		header = oc.Headers.Get(apmhttp.ElasticTraceparentHeader)
+	}
+	traceContext, err := apmhttp.ParseTraceparentHeader(header)
+	if err != nil {
+		return apm.TraceContext{}
+	}
+	if tracestate := oc.Headers[apmhttp.TracestateHeader]; len(tracestate) > 0 {
+		traceContext.State, _ = apmhttp.ParseTracestateHeader(tracestate...)
+	}
+	return traceContext
+}
+
+type options struct {
+	tracer *apm.Tracer
+}
+
+// Option sets options for tracing GraphQL operations.
+type Option func(*options)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing GraphQL operations.
+func WithTracer(t *apm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(o *options) {
+		o.tracer = t
+	}
+}
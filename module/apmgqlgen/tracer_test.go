@@ -0,0 +1,277 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmgqlgen_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmgqlgen"
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestQuery(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	srv := newServer(tracer)
+	w := doRequest(srv, `{"query":"query GetUser { user }"}`)
+	assert.Equal(t, `{"data":{"user":"alice"}}`, w.Body.String())
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Spans, 1)
+	tx := payloads.Transactions[0]
+	span := payloads.Spans[0]
+
+	assert.Equal(t, "query GetUser", tx.Name)
+	assert.Equal(t, "graphql", tx.Type)
+	assert.Equal(t, "success", tx.Result)
+	assert.Equal(t, "success", tx.Outcome)
+	assert.Equal(t, model.IfaceMap{{Key: "graphql_complexity", Value: 1.0}}, tx.Context.Tags)
+	assert.Equal(t, model.SpanID{}, tx.ParentID)
+
+	assert.Equal(t, "Query.user", span.Name)
+	assert.Equal(t, "app", span.Type)
+	assert.Equal(t, "graphql", span.Subtype)
+	assert.Equal(t, "resolve", span.Action)
+	assert.Equal(t, tx.ID, span.ParentID)
+	assert.Equal(t, model.IfaceMap{{Key: "graphql_field_path", Value: "user"}}, span.Context.Tags)
+}
+
+func TestAnonymousOperation(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	srv := newServer(tracer)
+	doRequest(srv, `{"query":"{ user }"}`)
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, "query", payloads.Transactions[0].Name)
+}
+
+func TestErrors(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	srv := newServer(tracer)
+	w := doRequest(srv, `{"query":"query GetMissingUser { user }"}`)
+	assert.Contains(t, w.Body.String(), "no such user")
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Errors, 1)
+	tx := payloads.Transactions[0]
+	e := payloads.Errors[0]
+
+	assert.Equal(t, "error", tx.Result)
+	assert.Equal(t, "failure", tx.Outcome)
+	assert.Equal(t, "input: user no such user", e.Exception.Message)
+	assert.Equal(t, tx.ID, e.ParentID)
+	assert.Equal(t, model.IfaceMap{{Key: "graphql_error_path", Value: "user"}}, e.Context.Tags)
+}
+
+func TestParentTransaction(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	srv := newServer(tracer)
+	h := apmhttp.Wrap(srv, apmhttp.WithTracer(tracer))
+	doRequest(h, `{"query":"query GetUser { user }"}`)
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	graphqlTx := payloads.Transactions[0]
+	httpTx := payloads.Transactions[1]
+	assert.Equal(t, "graphql", graphqlTx.Type)
+	assert.Equal(t, "request", httpTx.Type)
+	assert.Equal(t, httpTx.TraceID, graphqlTx.TraceID)
+	assert.Equal(t, httpTx.ID, graphqlTx.ParentID)
+}
+
+func TestTraceparentHeader(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	srv := newServer(tracer)
+	req := newRequest(`{"query":"query GetUser { user }"}`)
+	req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	tx := payloads.Transactions[0]
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", hex.EncodeToString(tx.TraceID[:]))
+	assert.Equal(t, "b7ad6b7169203331", hex.EncodeToString(tx.ParentID[:]))
+}
+
+func TestPersistedQuery(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	srv := newServer(tracer)
+	srv.Use(extension.AutomaticPersistedQuery{Cache: graphql.MapCache{}})
+
+	query := "query GetUser { user }"
+	hash := sha256.Sum256([]byte(query))
+	hashHex := hex.EncodeToString(hash[:])
+	extensions := `"extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + hashHex + `"}}`
+
+	// Register the query, and then send only its hash.
+	doRequest(srv, `{"query":"`+query+`",`+extensions+`}`)
+	w := doRequest(srv, `{`+extensions+`}`)
+	assert.Equal(t, `{"data":{"user":"alice"}}`, w.Body.String())
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	for _, tx := range payloads.Transactions {
+		assert.Equal(t, "query GetUser", tx.Name)
+		assert.Contains(t, tx.Context.Tags, model.IfaceMapItem{
+			Key: "graphql_persisted_query_hash", Value: hashHex,
+		})
+	}
+}
+
+func TestBatchedOperations(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	srv := newServer(tracer)
+	h := apmhttp.Wrap(srv, apmhttp.WithTracer(tracer))
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader("query A { user }\nquery B { user }"))
+	req.Header.Set("Content-Type", "text/plain")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 3)
+	assert.Equal(t, "query A", payloads.Transactions[0].Name)
+	assert.Equal(t, "query B", payloads.Transactions[1].Name)
+	httpTx := payloads.Transactions[2]
+	assert.Equal(t, httpTx.ID, payloads.Transactions[0].ParentID)
+	assert.Equal(t, httpTx.ID, payloads.Transactions[1].ParentID)
+}
+
+// batchTransport is a graphql.Transport which executes each
+// line of the request body as a separate GraphQL operation.
+type batchTransport struct{}
+
+func (batchTransport) Supports(req *http.Request) bool {
+	return req.Header.Get("Content-Type") == "text/plain"
+}
+
+func (batchTransport) Do(w http.ResponseWriter, req *http.Request, exec graphql.GraphExecutor) {
+	body, _ := ioutil.ReadAll(req.Body)
+	for _, query := range strings.Split(string(body), "\n") {
+		params := &graphql.RawParams{Query: query, Headers: req.Header}
+		oc, errs := exec.CreateOperationContext(req.Context(), params)
+		if errs != nil {
+			http.Error(w, errs.Error(), http.StatusBadRequest)
+			return
+		}
+		responses, ctx := exec.DispatchOperation(req.Context(), oc)
+		responses(ctx)
+	}
+}
+
+func newServer(tracer *apm.Tracer) *handler.Server {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		type Query {
+			user: String!
+		}
+	`})
+	srv := handler.New(&graphql.ExecutableSchemaMock{
+		ExecFunc: func(ctx context.Context) graphql.ResponseHandler {
+			oc := graphql.GetOperationContext(ctx)
+			return graphql.OneShot(func() *graphql.Response {
+				// Field execution happens inside generated code;
+				// simulate the execution of a single resolver.
+				ctx := graphql.WithFieldContext(ctx, &graphql.FieldContext{
+					Object:     "Query",
+					IsResolver: true,
+					Field: graphql.CollectedField{
+						Field: &ast.Field{
+							Name:       "user",
+							Alias:      "user",
+							Definition: schema.Types["Query"].Fields.ForName("user"),
+						},
+					},
+				})
+				_, err := oc.ResolverMiddleware(ctx, func(ctx context.Context) (interface{}, error) {
+					if oc.Operation.Name == "GetMissingUser" {
+						return nil, errors.New("no such user")
+					}
+					return "alice", nil
+				})
+				if err != nil {
+					graphql.AddError(ctx, err)
+					return &graphql.Response{Data: []byte(`null`), Errors: graphql.GetErrors(ctx)}
+				}
+				return &graphql.Response{Data: []byte(`{"user":"alice"}`)}
+			}())
+		},
+		SchemaFunc: func() *ast.Schema {
+			return schema
+		},
+		ComplexityFunc: func(typeName, fieldName string, childComplexity int, args map[string]interface{}) (int, bool) {
+			return 0, false
+		},
+	})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(batchTransport{})
+	srv.Use(apmgqlgen.NewTracer(apmgqlgen.WithTracer(tracer)))
+	return srv
+}
+
+func newRequest(body string) *http.Request {
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func doRequest(h http.Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newRequest(body))
+	return w
+}
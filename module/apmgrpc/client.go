@@ -48,9 +48,15 @@ func NewUnaryClientInterceptor(o ...ClientOption) grpc.UnaryClientInterceptor {
 		opts ...grpc.CallOption,
 	) error {
 		span, ctx := startSpan(ctx, method)
-		if span != nil {
-			defer span.End()
+		if span == nil {
+			return invoker(ctx, method, req, resp, cc, opts...)
 		}
+		defer span.End()
+		if span.Dropped() {
+			return invoker(ctx, method, req, resp, cc, opts...)
+		}
+		ctx, retries := contextWithRetryCounter(ctx)
+		defer setRetriesLabel(span, retries)
 		return invoker(ctx, method, req, resp, cc, opts...)
 	}
 }
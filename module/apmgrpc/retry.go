@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build go1.9
+
+package apmgrpc
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"go.elastic.co/apm"
+)
+
+// RetriesLabel is the name of the span label in which the number of
+// retries of an outgoing request is recorded, if it was retried.
+const RetriesLabel = "retries"
+
+type retryCounterKey struct{}
+
+// retryCounter records the attempts and retries of an outgoing request.
+type retryCounter struct {
+	attempts int32 // accessed atomically
+	retries  int32 // accessed atomically
+}
+
+// RecordRetry records a retry of the outgoing request with the given
+// context, if the request is being traced by an interceptor returned
+// by NewUnaryClientInterceptor. The number of retries is recorded in
+// the span's RetriesLabel label.
+//
+// Retries performed by interceptors chained after the tracing
+// interceptor, or by gRPC itself, are not otherwise visible to the
+// agent. Retrying interceptors may call RecordRetry with the context
+// passed to them for each retry, or may be followed in the chain by
+// the interceptor returned by NewUnaryClientAttemptInterceptor.
+func RecordRetry(ctx context.Context) {
+	if c, ok := ctx.Value(retryCounterKey{}).(*retryCounter); ok {
+		atomic.AddInt32(&c.retries, 1)
+	}
+}
+
+// NewUnaryClientAttemptInterceptor returns a grpc.UnaryClientInterceptor
+// which counts each invocation as an attempt, recording all attempts
+// after the first with RecordRetry.
+//
+// The interceptor should be chained after a retrying interceptor, which
+// is itself chained after the interceptor returned by NewUnaryClientInterceptor.
+// For example:
+//
+//	grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(
+//		apmgrpc.NewUnaryClientInterceptor(),
+//		grpc_retry.UnaryClientInterceptor(),
+//		apmgrpc.NewUnaryClientAttemptInterceptor(),
+//	))
+func NewUnaryClientAttemptInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, resp interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if c, ok := ctx.Value(retryCounterKey{}).(*retryCounter); ok {
+			if atomic.AddInt32(&c.attempts, 1) > 1 {
+				atomic.AddInt32(&c.retries, 1)
+			}
+		}
+		return invoker(ctx, method, req, resp, cc, opts...)
+	}
+}
+
+// contextWithRetryCounter returns a copy of ctx with a new retryCounter.
+func contextWithRetryCounter(ctx context.Context) (context.Context, *retryCounter) {
+	c := &retryCounter{}
+	return context.WithValue(ctx, retryCounterKey{}, c), c
+}
+
+// setRetriesLabel records the number of retries counted by c
+// in span's RetriesLabel label, if there were any.
+func setRetriesLabel(span *apm.Span, c *retryCounter) {
+	if n := atomic.LoadInt32(&c.retries); n > 0 {
+		span.Context.SetLabel(RetriesLabel, int(n))
+	}
+}
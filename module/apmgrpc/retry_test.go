@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build go1.9
+
+package apmgrpc_test
+
+import (
+	"testing"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	pb "google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/status"
+
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmgrpc"
+)
+
+func TestClientRetriesAttemptInterceptor(t *testing.T) {
+	failures := 2
+	spans := testClientRetries(t,
+		apmgrpc.NewUnaryClientInterceptor(),
+		retryingInterceptor(5),
+		apmgrpc.NewUnaryClientAttemptInterceptor(),
+		failingInterceptor(&failures),
+	)
+	assert.Equal(t, model.IfaceMap{{Key: apmgrpc.RetriesLabel, Value: float64(2)}}, spans[0].Context.Tags)
+}
+
+func TestClientRetriesRecordRetry(t *testing.T) {
+	spans := testClientRetries(t,
+		apmgrpc.NewUnaryClientInterceptor(),
+		func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			apmgrpc.RecordRetry(ctx)
+			return invoker(ctx, method, req, resp, cc, opts...)
+		},
+	)
+	assert.Equal(t, model.IfaceMap{{Key: apmgrpc.RetriesLabel, Value: float64(1)}}, spans[0].Context.Tags)
+}
+
+func TestClientNoRetries(t *testing.T) {
+	spans := testClientRetries(t,
+		apmgrpc.NewUnaryClientInterceptor(),
+		retryingInterceptor(5),
+		apmgrpc.NewUnaryClientAttemptInterceptor(),
+	)
+	assert.Nil(t, spans[0].Context)
+}
+
+func testClientRetries(t *testing.T, interceptors ...grpc.UnaryClientInterceptor) []model.Span {
+	serverTracer := apmtest.NewDiscardTracer()
+	defer serverTracer.Close()
+	s, _, addr := newServer(t, serverTracer)
+	defer s.GracefulStop()
+
+	conn, err := grpc.Dial(
+		addr.String(), grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(interceptors...)),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewGreeterClient(conn)
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "birita"})
+		require.NoError(t, err)
+	})
+	require.Len(t, spans, 1)
+	return spans
+}
+
+// retryingInterceptor returns an interceptor which retries
+// requests failing with codes.Unavailable.
+func retryingInterceptor(maxAttempts int) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, resp, cc, opts...)
+			if status.Code(err) != codes.Unavailable || attempt == maxAttempts {
+				return err
+			}
+		}
+	}
+}
+
+// failingInterceptor returns an interceptor which fails the first
+// *n requests with codes.Unavailable.
+func failingInterceptor(n *int) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, resp interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if *n > 0 {
+			*n--
+			return status.Error(codes.Unavailable, "try again")
+		}
+		return invoker(ctx, method, req, resp, cc, opts...)
+	}
+}
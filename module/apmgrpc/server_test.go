@@ -75,6 +75,7 @@ func TestServerTransaction(t *testing.T) {
 		}
 	}
 	t.Run("happy", adaptTest(testServerTransactionHappy))
+	t.Run("unsampled_parent", adaptTest(testServerTransactionUnsampledParent))
 	t.Run("unknown_error", adaptTest(testServerTransactionUnknownError))
 	t.Run("status_error", adaptTest(testServerTransactionStatusError))
 	t.Run("panic", adaptTest(testServerTransactionPanic))
@@ -126,6 +127,26 @@ func testServerTransactionHappy(t *testing.T, p testParams) {
 	}
 }
 
+func testServerTransactionUnsampledParent(t *testing.T, p testParams) {
+	traceID := apm.TraceID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c}
+	clientSpanID := apm.SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31}
+	traceparentValue := fmt.Sprintf("00-%s-%s-00", traceID, clientSpanID)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), apmhttp.W3CTraceparentHeader, traceparentValue)
+	_, err := p.client.SayHello(ctx, &pb.HelloRequest{Name: "birita"})
+	require.NoError(t, err)
+	p.tracer.Flush(nil)
+
+	// The parent ID is recorded even if the remote parent was not sampled.
+	payloads := p.transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	tx := payloads.Transactions[0]
+	assert.Equal(t, model.TraceID(traceID), tx.TraceID)
+	assert.Equal(t, model.SpanID(clientSpanID), tx.ParentID)
+	require.NotNil(t, tx.Sampled)
+	assert.False(t, *tx.Sampled)
+}
+
 func testServerTransactionUnknownError(t *testing.T, p testParams) {
 	p.server.err = errors.New("boom")
 	_, err := p.client.SayHello(context.Background(), &pb.HelloRequest{Name: "birita"})
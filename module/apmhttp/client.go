@@ -26,6 +26,11 @@ import (
 	"go.elastic.co/apm"
 )
 
+// ClientTransactionType is the type of transactions started for client
+// requests whose context contains no transaction, when enabled with
+// WithClientRootTransactions.
+const ClientTransactionType = "external"
+
 // WrapClient returns a new *http.Client with all fields copied
 // across, and the Transport field wrapped with WrapRoundTripper
 // such that client requests are reported as spans to Elastic APM
@@ -67,46 +72,66 @@ func WrapRoundTripper(r http.RoundTripper, o ...ClientOption) http.RoundTripper
 }
 
 type roundTripper struct {
-	r              http.RoundTripper
-	requestName    RequestNameFunc
-	requestIgnorer RequestIgnorerFunc
+	r               http.RoundTripper
+	requestName     RequestNameFunc
+	requestIgnorer  RequestIgnorerFunc
+	requestIDHeader string
+	rootTracer      *apm.Tracer
+
+	compressionStats bool
 }
 
 // RoundTrip delegates to r.r, emitting a span if req's context
-// contains a transaction.
+// contains a transaction, or if root transactions are enabled.
 func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The request ID is propagated even if the request is not traced.
+	req = r.setRequestID(req)
 	if r.requestIgnorer(req) {
 		return r.r.RoundTrip(req)
 	}
 	ctx := req.Context()
 	tx := apm.TransactionFromContext(ctx)
+	var rootTx *apm.Transaction
 	if tx == nil {
-		return r.r.RoundTrip(req)
+		if r.rootTracer == nil {
+			return r.r.RoundTrip(req)
+		}
+		rootTx = r.rootTracer.StartTransaction(r.requestName(req), ClientTransactionType)
+		tx = rootTx
+		ctx = apm.ContextWithTransaction(ctx, tx)
 	}
 
 	// RoundTrip is not supposed to mutate req, so copy req
 	// and set the trace-context headers only in the copy.
-	reqCopy := *req
-	reqCopy.Header = make(http.Header, len(req.Header))
-	for k, v := range req.Header {
-		reqCopy.Header[k] = v
-	}
-	req = &reqCopy
+	req = copyRequestHeader(req)
 
 	propagateLegacyHeader := tx.ShouldPropagateLegacyHeader()
 	traceContext := tx.TraceContext()
 	if !traceContext.Options.Recorded() {
 		r.setHeaders(req, traceContext, propagateLegacyHeader)
+		if rootTx != nil {
+			defer rootTx.End()
+		}
 		return r.r.RoundTrip(req)
 	}
 
 	name := r.requestName(req)
 	span := tx.StartSpan(name, "external.http", apm.SpanFromContext(ctx))
+	var retries *retryCounter
 	if !span.Dropped() {
+		method := req.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		span.SetTypeSubtypeAction("external", "http", method)
 		traceContext = span.TraceContext()
 		ctx = apm.ContextWithSpan(ctx, span)
+		ctx, retries = contextWithRetryCounter(ctx)
 		req = RequestWithContext(ctx, req)
 		span.Context.SetHTTPRequest(req)
+		if r.compressionStats {
+			setRequestCompressionLabels(span, req)
+		}
 	} else {
 		span.End()
 		span = nil
@@ -114,17 +139,55 @@ func (r *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	r.setHeaders(req, traceContext, propagateLegacyHeader)
 	resp, err := r.r.RoundTrip(req)
+	if rootTx != nil && err == nil {
+		rootTx.Result = StatusCodeResult(resp.StatusCode)
+	}
 	if span != nil {
+		setRetriesLabel(span, retries)
 		if err != nil {
 			span.End()
 		} else {
 			span.Context.SetHTTPStatusCode(resp.StatusCode)
-			resp.Body = &responseBody{span: span, body: resp.Body}
+			body := &responseBody{span: span, tx: rootTx, body: resp.Body}
+			if r.compressionStats {
+				body.stats = newCompressionStats(resp)
+			}
+			resp.Body = body
+			rootTx = nil // ended along with the span
 		}
 	}
+	if rootTx != nil {
+		rootTx.End()
+	}
 	return resp, err
 }
 
+// setRequestID returns req, or a copy of req with the request ID stored in
+// its context set in r.requestIDHeader, if the header is not already set.
+func (r *roundTripper) setRequestID(req *http.Request) *http.Request {
+	if r.requestIDHeader == "" || req.Header.Get(r.requestIDHeader) != "" {
+		return req
+	}
+	id := RequestIDFromContext(req.Context())
+	if id == "" {
+		return req
+	}
+	req = copyRequestHeader(req)
+	req.Header.Set(r.requestIDHeader, id)
+	return req
+}
+
+// copyRequestHeader returns a shallow copy of req with a copy of its
+// header, which may be modified without affecting req.
+func copyRequestHeader(req *http.Request) *http.Request {
+	reqCopy := *req
+	reqCopy.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		reqCopy.Header[k] = v
+	}
+	return &reqCopy
+}
+
 func (r *roundTripper) setHeaders(req *http.Request, traceContext apm.TraceContext, propagateLegacyHeader bool) {
 	headerValue := FormatTraceparentHeader(traceContext)
 	if propagateLegacyHeader {
@@ -157,13 +220,15 @@ func (r *roundTripper) CancelRequest(req *http.Request) {
 }
 
 type responseBody struct {
-	span *apm.Span
-	body io.ReadCloser
+	span  *apm.Span
+	tx    *apm.Transaction // root transaction, ended after span
+	body  io.ReadCloser
+	stats *compressionStats
 }
 
 // Close closes the response body, and ends the span if it hasn't already been ended.
 func (b *responseBody) Close() error {
-	b.endSpan()
+	b.endSpan(false)
 	return b.body.Close()
 }
 
@@ -171,22 +236,54 @@ func (b *responseBody) Close() error {
 // the span hasn't already been ended.
 func (b *responseBody) Read(p []byte) (n int, err error) {
 	n, err = b.body.Read(p)
+	if b.stats != nil {
+		b.stats.read(n)
+	}
 	if err == io.EOF {
-		b.endSpan()
+		b.endSpan(true)
 	}
 	return n, err
 }
 
-func (b *responseBody) endSpan() {
+// endSpan ends the span, and the root transaction if any, if it hasn't
+// already been ended. If eof is true, the response body has been read
+// to completion.
+func (b *responseBody) endSpan(eof bool) {
 	addr := (*unsafe.Pointer)(unsafe.Pointer(&b.span))
 	if old := atomic.SwapPointer(addr, nil); old != nil {
-		(*apm.Span)(old).End()
+		span := (*apm.Span)(old)
+		if b.stats != nil {
+			b.stats.setLabels(span, eof)
+		}
+		span.End()
+		if b.tx != nil {
+			b.tx.End()
+		}
 	}
 }
 
 // ClientOption sets options for tracing client requests.
 type ClientOption func(*roundTripper)
 
+// WithClientRootTransactions returns a ClientOption which enables tracing
+// of requests whose context does not contain a transaction, such as those
+// made by libraries which do not propagate contexts. For each such request,
+// a transaction of type ClientTransactionType is started with tracer,
+// and the request is reported as a span within it. The new trace context
+// is propagated to the server, so that the server's transaction does not
+// begin a disconnected trace.
+//
+// By default, requests whose context does not contain a transaction are
+// neither traced nor propagate trace context.
+func WithClientRootTransactions(tracer *apm.Tracer) ClientOption {
+	if tracer == nil {
+		panic("tracer == nil")
+	}
+	return ClientOption(func(rt *roundTripper) {
+		rt.rootTracer = tracer
+	})
+}
+
 // WithClientRequestName returns a ClientOption which sets r as the function
 // to use to obtain the span name for the given http request.
 func WithClientRequestName(r RequestNameFunc) ClientOption {
@@ -80,6 +80,7 @@ func TestClient(t *testing.T) {
 	assert.Equal(t, "GET "+serverAddr.String(), span.Name)
 	assert.Equal(t, "external", span.Type)
 	assert.Equal(t, "http", span.Subtype)
+	assert.Equal(t, "GET", span.Action)
 	assert.Equal(t, &model.SpanContext{
 		Destination: &model.DestinationSpanContext{
 			Address: serverAddr.IP.String(),
@@ -95,6 +96,12 @@ func TestClient(t *testing.T) {
 			URL:        serverURL,
 			StatusCode: statusCode,
 		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{
+				Type: "http",
+				Name: serverAddr.String(),
+			},
+		},
 	}, span.Context)
 }
 
@@ -222,6 +229,61 @@ func TestClientTransactionUnsampled(t *testing.T) {
 	assert.Equal(t, transaction.ID, model.SpanID(clientTraceContext.Span))
 }
 
+func TestClientNoTransaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Header.Get("Traceparent")))
+	}))
+	defer server.Close()
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	// By default, requests without a transaction in context are not
+	// traced, and trace context is not propagated.
+	_, responseBody := mustGET(context.Background(), server.URL)
+	assert.Empty(t, responseBody)
+
+	_, responseBody = mustGET(context.Background(), server.URL, apmhttp.WithClientRootTransactions(tracer))
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Spans, 1)
+	transaction := payloads.Transactions[0]
+	span := payloads.Spans[0]
+	assert.Equal(t, apmhttp.ClientTransactionType, transaction.Type)
+	assert.Equal(t, span.Name, transaction.Name)
+	assert.Equal(t, "HTTP 2xx", transaction.Result)
+	assert.Equal(t, transaction.ID, span.ParentID)
+
+	clientTraceContext, err := apmhttp.ParseTraceparentHeader(responseBody)
+	require.NoError(t, err)
+	assert.Equal(t, transaction.TraceID, model.TraceID(clientTraceContext.Trace))
+	assert.Equal(t, span.ID, model.SpanID(clientTraceContext.Span))
+}
+
+func TestClientNoTransactionUnsampled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Header.Get("Traceparent")))
+	}))
+	defer server.Close()
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(apm.NewRatioSampler(0))
+
+	_, responseBody := mustGET(context.Background(), server.URL, apmhttp.WithClientRootTransactions(tracer))
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Spans, 0)
+	clientTraceContext, err := apmhttp.ParseTraceparentHeader(responseBody)
+	require.NoError(t, err)
+	assert.Equal(t, payloads.Transactions[0].ID, model.SpanID(clientTraceContext.Span))
+	assert.False(t, clientTraceContext.Options.Recorded())
+}
+
 func TestClientError(t *testing.T) {
 	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
 		client := apmhttp.WrapClient(http.DefaultClient)
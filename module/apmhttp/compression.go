@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"go.elastic.co/apm"
+)
+
+// WithClientCompressionStats returns a ClientOption which enables
+// recording of HTTP request and response body encodings and sizes
+// as span labels, for observing the effect of compression.
+//
+// The following labels are recorded, where known:
+//
+//   - http_request_content_encoding: the request Content-Encoding
+//   - http_request_content_length: the request Content-Length
+//   - http_response_content_encoding: the response Content-Encoding
+//   - http_response_compressed_size: the encoded response body size
+//   - http_response_uncompressed_size: the decoded response body size
+//
+// Response sizes are taken from the Content-Length header if present.
+// For responses without a Content-Length, such as chunked responses,
+// sizes are recorded only if the response body is read to completion.
+// When a gzip-encoded response is transparently decompressed by the
+// http.Transport, only the uncompressed size is known.
+func WithClientCompressionStats() ClientOption {
+	return func(rt *roundTripper) {
+		rt.compressionStats = true
+	}
+}
+
+// setRequestCompressionLabels records the request body's content
+// encoding and length as span labels.
+func setRequestCompressionLabels(span *apm.Span, req *http.Request) {
+	if encoding := req.Header.Get("Content-Encoding"); encoding != "" {
+		span.Context.SetLabel("http_request_content_encoding", encoding)
+	}
+	if req.ContentLength > 0 {
+		span.Context.SetLabel("http_request_content_length", req.ContentLength)
+	}
+}
+
+// compressionStats records information about a response body,
+// for reporting its encoding and sizes as span labels.
+type compressionStats struct {
+	bytesRead int64 // accessed atomically; first for 64-bit alignment
+
+	encoding      string
+	contentLength int64 // -1 if unknown
+	decompressed  bool  // decompressed by the http.Transport
+}
+
+func newCompressionStats(resp *http.Response) *compressionStats {
+	stats := &compressionStats{
+		encoding:      resp.Header.Get("Content-Encoding"),
+		contentLength: resp.ContentLength,
+		decompressed:  resp.Uncompressed,
+	}
+	if stats.decompressed {
+		// http.Transport removes the Content-Encoding header,
+		// and only transparently decompresses gzip.
+		stats.encoding = "gzip"
+		stats.contentLength = -1
+	}
+	return stats
+}
+
+// read records n bytes read from the response body.
+func (s *compressionStats) read(n int) {
+	atomic.AddInt64(&s.bytesRead, int64(n))
+}
+
+// setLabels records the response body's encoding and sizes as span
+// labels. If eof is true, the response body has been read to
+// completion, and its size is known even without a Content-Length.
+func (s *compressionStats) setLabels(span *apm.Span, eof bool) {
+	size := s.contentLength
+	if size < 0 && eof {
+		size = atomic.LoadInt64(&s.bytesRead)
+	}
+	if s.encoding != "" {
+		span.Context.SetLabel("http_response_content_encoding", s.encoding)
+	}
+	if size < 0 {
+		return
+	}
+	if s.decompressed || s.encoding == "" || s.encoding == "identity" {
+		span.Context.SetLabel("http_response_uncompressed_size", size)
+	} else {
+		span.Context.SetLabel("http_response_compressed_size", size)
+	}
+}
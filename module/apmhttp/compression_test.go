@@ -0,0 +1,149 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context/ctxhttp"
+
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmhttp"
+)
+
+func TestClientCompressionStats(t *testing.T) {
+	body := strings.Repeat("hello, world! ", 100)
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(body))
+	zw.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		switch req.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipped.Bytes())
+		case "/chunked":
+			w.Write([]byte(body[:10]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(body[10:]))
+		default:
+			w.Write([]byte(body))
+		}
+	}))
+	defer server.Close()
+
+	type test struct {
+		path           string
+		acceptEncoding string
+		labels         map[string]interface{}
+	}
+	for _, test := range []test{{
+		// Transparently decompressed by http.Transport.
+		path: "/gzip",
+		labels: map[string]interface{}{
+			"http_response_content_encoding":  "gzip",
+			"http_response_uncompressed_size": float64(len(body)),
+		},
+	}, {
+		path:           "/gzip",
+		acceptEncoding: "gzip",
+		labels: map[string]interface{}{
+			"http_response_content_encoding": "gzip",
+			"http_response_compressed_size":  float64(gzipped.Len()),
+		},
+	}, {
+		path: "/chunked",
+		labels: map[string]interface{}{
+			"http_response_uncompressed_size": float64(len(body)),
+		},
+	}, {
+		path: "/",
+		labels: map[string]interface{}{
+			"http_response_uncompressed_size": float64(len(body)),
+		},
+	}} {
+		_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+			client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientCompressionStats())
+			req, _ := http.NewRequest("GET", server.URL+test.path, nil)
+			if test.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			resp, err := ctxhttp.Do(ctx, client, req)
+			require.NoError(t, err)
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		})
+		require.Len(t, spans, 1)
+		assert.Equal(t, test.labels, spanLabels(spans[0]), test.path)
+	}
+}
+
+func TestClientCompressionStatsRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+	}))
+	defer server.Close()
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientCompressionStats())
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader("compressed"))
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := ctxhttp.Do(ctx, client, req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	})
+	require.Len(t, spans, 1)
+	labels := spanLabels(spans[0])
+	assert.Equal(t, "gzip", labels["http_request_content_encoding"])
+	assert.Equal(t, float64(len("compressed")), labels["http_request_content_length"])
+}
+
+func TestClientCompressionStatsDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		mustGET(ctx, server.URL)
+	})
+	require.Len(t, spans, 1)
+	assert.Nil(t, spans[0].Context.Tags)
+}
+
+func spanLabels(span model.Span) map[string]interface{} {
+	labels := make(map[string]interface{})
+	if span.Context != nil {
+		for _, label := range span.Context.Tags {
+			labels[label.Key] = label.Value
+		}
+	}
+	return labels
+}
@@ -0,0 +1,69 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// ForceSampleHeader is the conventional HTTP header for forcing
+// requests to be sampled, which may be passed to WithForceSampleHeader.
+const ForceSampleHeader = "X-Apm-Force-Sample"
+
+// WithForceSampleHeader returns a ServerOption which enables forcing
+// individual requests to be sampled, regardless of the tracer's sampler
+// or any sampling decision propagated by the client. This is intended
+// for capturing traces of specific requests on demand, e.g. for debugging.
+//
+// A request is force-sampled if it contains the specified header with
+// a value exactly matching secret. The header is removed from the
+// request before it is passed to the wrapped handler, so the secret is
+// never captured in the transaction context.
+//
+// Anyone knowing the secret can cause requests to be sampled, which
+// increases the cost of tracing those requests and may be used to
+// overload the APM Server. The secret should therefore be long and
+// randomly generated, only shared with those who need it, and only
+// sent over secure connections.
+func WithForceSampleHeader(header, secret string) ServerOption {
+	if header == "" {
+		panic("header == \"\"")
+	}
+	if secret == "" {
+		panic("secret == \"\"")
+	}
+	return func(h *handler) {
+		h.forceSampleHeader = http.CanonicalHeaderKey(header)
+		h.forceSampleSecret = []byte(secret)
+	}
+}
+
+// forceSample reports whether req should be force-sampled, removing
+// the force-sample header from req if it is present.
+func (h *handler) forceSample(req *http.Request) bool {
+	if h.forceSampleHeader == "" {
+		return false
+	}
+	values, ok := req.Header[h.forceSampleHeader]
+	if !ok {
+		return false
+	}
+	delete(req.Header, h.forceSampleHeader)
+	return len(values) == 1 && subtle.ConstantTimeCompare([]byte(values[0]), h.forceSampleSecret) == 1
+}
@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestHandlerForceSampleHeader(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetSampler(apm.NewRatioSampler(0))
+
+	var handlerHeaders []string
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			handlerHeaders = append(handlerHeaders, req.Header.Get(apmhttp.ForceSampleHeader))
+		}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithForceSampleHeader(apmhttp.ForceSampleHeader, "s3cr3t"),
+	)
+
+	for _, value := range []string{"", "s3cr3t", "wrong"} {
+		req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+		req.Header.Set("User-Agent", "test")
+		if value != "" {
+			req.Header.Set("x-apm-force-sample", value)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	tracer.Flush(nil)
+
+	// The header is never passed through to the handler.
+	assert.Equal(t, []string{"", "", ""}, handlerHeaders)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 3)
+	assert.False(t, payloads.Transactions[0].Sampled == nil || *payloads.Transactions[0].Sampled)
+	assert.Nil(t, payloads.Transactions[1].Sampled) // sampled
+	require.NotNil(t, payloads.Transactions[1].Context)
+	require.NotNil(t, payloads.Transactions[1].Context.Request)
+	for _, header := range payloads.Transactions[1].Context.Request.Headers {
+		assert.NotEqual(t, apmhttp.ForceSampleHeader, header.Key)
+	}
+	assert.False(t, payloads.Transactions[2].Sampled == nil || *payloads.Transactions[2].Sampled)
+}
+
+func TestHandlerForceSampleHeaderOverridesTraceparent(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(
+		http.NotFoundHandler(),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithForceSampleHeader("X-Debug", "s3cr3t"),
+	)
+	req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+	req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+	req.Header.Set("X-Debug", "s3cr3t")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Nil(t, payloads.Transactions[0].Sampled)
+}
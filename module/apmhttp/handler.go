@@ -19,11 +19,45 @@ package apmhttp
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
 	"go.elastic.co/apm"
 )
 
+const (
+	// StreamingTransactionType is the transaction type used for
+	// requests whose responses are streamed to the client, such
+	// as Server-Sent Events, when enabled with
+	// WithStreamingTransactionType.
+	StreamingTransactionType = "request.streaming"
+
+	// ResponseFlushesLabel is the name of the transaction label in
+	// which the number of response flushes is recorded for streaming
+	// responses.
+	ResponseFlushesLabel = "http_response_flushes"
+
+	// StreamingDurationLabel is the name of the transaction label in
+	// which the duration in milliseconds between the first response
+	// flush and the end of the request is recorded for streaming
+	// responses.
+	StreamingDurationLabel = "http_response_streaming_duration_ms"
+
+	// ResponseContentTypeLabel is the name of the transaction label in
+	// which the response media type is recorded, when enabled with
+	// WithResponseContentTypeLabel.
+	ResponseContentTypeLabel = "http_response_content_type"
+)
+
+// maxErrorBodyLength is the maximum number of bytes of an error
+// response body captured for use as an error message.
+const maxErrorBodyLength = 1024
+
 // Wrap returns an http.Handler wrapping h, reporting each request as
 // a transaction to Elastic APM.
 //
@@ -56,28 +90,51 @@ func Wrap(h http.Handler, o ...ServerOption) http.Handler {
 //
 // The http.Request's context will be updated with the transaction.
 type handler struct {
-	handler          http.Handler
-	tracer           *apm.Tracer
-	recovery         RecoveryFunc
-	panicPropagation bool
-	requestName      RequestNameFunc
-	requestIgnorer   RequestIgnorerFunc
+	handler            http.Handler
+	tracer             *apm.Tracer
+	recovery           RecoveryFunc
+	panicPropagation   bool
+	requestName        RequestNameFunc
+	requestIgnorer     RequestIgnorerFunc
+	requestIDHeader    string
+	requestIDGenerator RequestIDFunc
+	contentTypeLabel   bool
+	streamingType      bool
+	forceSampleHeader  string
+	forceSampleSecret  []byte
+	errorStatusMin     int
+	sessionCookie      string
 }
 
 // ServeHTTP delegates to h.Handler, tracing the transaction with
 // h.Tracer, or apm.DefaultTracer if h.Tracer is nil.
 func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if !h.tracer.Recording() || h.requestIgnorer(req) {
+		// Store the request ID for propagation to outgoing
+		// requests, even though the request is not traced.
+		if id := h.requestID(req); id != "" {
+			req = RequestWithContext(ContextWithRequestID(req.Context(), id), req)
+		}
 		h.handler.ServeHTTP(w, req)
 		return
 	}
-	tx, req := StartTransaction(h.tracer, h.requestName(req), req)
+	tx, req := startTransaction(h.tracer, h.requestName(req), req, h.forceSample(req))
 	defer tx.End()
+	if id := h.requestID(req); id != "" {
+		tx.Context.SetLabel(RequestIDLabel, id)
+		req = RequestWithContext(ContextWithRequestID(req.Context(), id), req)
+	}
+	if h.sessionCookie != "" && tx.Sampled() {
+		if c, err := req.Cookie(h.sessionCookie); err == nil && c.Value != "" {
+			tx.Context.SetUserSession(hashSessionID(c.Value))
+		}
+	}
 
 	body := h.tracer.CaptureHTTPRequestBody(req)
-	w, resp := WrapResponseWriter(w)
+	w, resp := wrapResponseWriter(w, h.errorStatusMin)
 	defer func() {
-		if v := recover(); v != nil {
+		v := recover()
+		if v != nil {
 			if h.panicPropagation {
 				defer panic(v)
 				// 500 status code will be set only for APM transaction
@@ -90,7 +147,16 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			}
 			h.recovery(w, req, resp, body, tx, v)
 		}
+		if v == nil && h.errorStatusMin > 0 && resp.StatusCode >= h.errorStatusMin {
+			h.reportErrorStatus(req, resp, body, tx)
+		}
 		SetTransactionContext(tx, req, resp, body)
+		if h.streamingType && isStreaming(resp) {
+			tx.Type = StreamingTransactionType
+		}
+		if h.contentTypeLabel && tx.Sampled() {
+			setResponseContentTypeLabel(&tx.Context, resp.Headers)
+		}
 		body.Discard()
 	}()
 	h.handler.ServeHTTP(w, req)
@@ -99,12 +165,37 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// reportErrorStatus reports an error for a response whose status code is
+// at least h.errorStatusMin, using the captured response body, if any, as
+// the error message.
+func (h *handler) reportErrorStatus(req *http.Request, resp *Response, body *apm.BodyCapturer, tx *apm.Transaction) {
+	message := strings.TrimSpace(string(resp.errorBody))
+	if message == "" {
+		message = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	e := h.tracer.NewErrorLog(apm.ErrorLogRecord{
+		Message: message,
+		Level:   apm.ErrorLevelError,
+	})
+	e.SetTransaction(tx)
+	SetContext(&e.Context, req, resp, body)
+	e.Send()
+}
+
 // StartTransaction returns a new Transaction with name,
 // created with tracer, and taking trace context from req.
 //
 // If the transaction is not ignored, the request will be
 // returned with the transaction added to its context.
+//
+// If req's context holds a request receipt time, recorded by
+// RecordRequestReceived or ContextWithRequestReceived, the
+// transaction's start time will be set to it.
 func StartTransaction(tracer *apm.Tracer, name string, req *http.Request) (*apm.Transaction, *http.Request) {
+	return startTransaction(tracer, name, req, false)
+}
+
+func startTransaction(tracer *apm.Tracer, name string, req *http.Request, forceSampled bool) (*apm.Transaction, *http.Request) {
 	traceContext, ok := getRequestTraceparent(req, ElasticTraceparentHeader)
 	if !ok {
 		traceContext, ok = getRequestTraceparent(req, W3CTraceparentHeader)
@@ -112,7 +203,14 @@ func StartTransaction(tracer *apm.Tracer, name string, req *http.Request) (*apm.
 	if ok {
 		traceContext.State, _ = ParseTracestateHeader(req.Header[TracestateHeader]...)
 	}
-	tx := tracer.StartTransactionOptions(name, "request", apm.TransactionOptions{TraceContext: traceContext})
+	opts := apm.TransactionOptions{
+		TraceContext: traceContext,
+		ForceSampled: forceSampled,
+	}
+	if received, ok := RequestReceivedFromContext(req.Context()); ok && !received.After(time.Now()) {
+		opts.Start = received
+	}
+	tx := tracer.StartTransactionOptions(name, "request", opts)
 	ctx := apm.ContextWithTransaction(req.Context(), tx)
 	req = RequestWithContext(ctx, req)
 	return tx, req
@@ -129,12 +227,54 @@ func getRequestTraceparent(req *http.Request, header string) (apm.TraceContext,
 
 // SetTransactionContext sets tx.Result and, if the transaction is being
 // sampled, sets tx.Context with information from req, resp, and body.
+//
+// If the response was streamed, i.e. it was flushed by the handler, or it
+// is a Server-Sent Events response, then for sampled transactions the number
+// of flushes and the duration of streaming will be recorded as transaction
+// labels.
 func SetTransactionContext(tx *apm.Transaction, req *http.Request, resp *Response, body *apm.BodyCapturer) {
 	tx.Result = StatusCodeResult(resp.StatusCode)
 	if !tx.Sampled() {
 		return
 	}
 	SetContext(&tx.Context, req, resp, body)
+	if isStreaming(resp) {
+		tx.Context.SetLabel(ResponseFlushesLabel, resp.Flushes)
+		if !resp.FirstFlush.IsZero() {
+			streamingDuration := time.Since(resp.FirstFlush)
+			tx.Context.SetLabel(StreamingDurationLabel, streamingDuration.Seconds()*1000)
+		}
+	}
+}
+
+// isStreaming reports whether the response was streamed, i.e. it
+// was flushed by the handler, or it is a Server-Sent Events response.
+func isStreaming(resp *Response) bool {
+	return resp.Flushes > 0 || isEventStream(resp.Headers)
+}
+
+// isEventStream reports whether the response headers describe
+// a Server-Sent Events response.
+func isEventStream(h http.Header) bool {
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// setResponseContentTypeLabel records the media type of the response's
+// Content-Type header, if any, as the ResponseContentTypeLabel label.
+func setResponseContentTypeLabel(ctx *apm.Context, h http.Header) {
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	ctx.SetLabel(ResponseContentTypeLabel, contentType)
 }
 
 // SetContext sets the context for a transaction or error using information
@@ -156,10 +296,18 @@ func SetContext(ctx *apm.Context, req *http.Request, resp *Response, body *apm.B
 // The returned http.ResponseWriter implements http.Pusher and http.Hijacker
 // if and only if the provided http.ResponseWriter does.
 func WrapResponseWriter(w http.ResponseWriter) (http.ResponseWriter, *Response) {
+	return wrapResponseWriter(w, 0)
+}
+
+// wrapResponseWriter is like WrapResponseWriter, additionally capturing
+// the beginning of the response body if the response status code is at
+// least errorStatusMin. If errorStatusMin is zero, no body is captured.
+func wrapResponseWriter(w http.ResponseWriter, errorStatusMin int) (http.ResponseWriter, *Response) {
 	rw := responseWriter{
 		ResponseWriter: w,
 		resp: Response{
-			Headers: w.Header(),
+			Headers:        w.Header(),
+			errorStatusMin: errorStatusMin,
 		},
 	}
 	h, _ := w.(http.Hijacker)
@@ -195,6 +343,34 @@ type Response struct {
 
 	// Headers holds the headers set in the ResponseWriter.
 	Headers http.Header
+
+	// Flushes records the number of times the ResponseWriter was
+	// flushed, e.g. for streaming responses such as Server-Sent Events.
+	Flushes int
+
+	// FirstFlush records the time at which the ResponseWriter was
+	// first flushed, or the zero value if it was never flushed.
+	FirstFlush time.Time
+
+	// errorStatusMin and errorBody are used for capturing the
+	// beginning of error response bodies; see WithErrorStatusReporting.
+	errorStatusMin int
+	errorBody      []byte
+}
+
+// captureErrorBody records the beginning of the response body in
+// r.errorBody, if the response status code is an error status code
+// being reported, up to maxErrorBodyLength bytes.
+func (r *Response) captureErrorBody(data []byte) {
+	if r.errorStatusMin <= 0 || r.StatusCode < r.errorStatusMin {
+		return
+	}
+	if room := maxErrorBodyLength - len(r.errorBody); room > 0 {
+		if len(data) > room {
+			data = data[:room]
+		}
+		r.errorBody = append(r.errorBody, data...)
+	}
 }
 
 type responseWriter struct {
@@ -217,6 +393,7 @@ func (w *responseWriter) Write(data []byte) (int, error) {
 	if w.resp.StatusCode == 0 {
 		w.resp.StatusCode = http.StatusOK
 	}
+	w.resp.captureErrorBody(data[:n])
 	return n, err
 }
 
@@ -229,12 +406,17 @@ func (w *responseWriter) CloseNotify() <-chan bool {
 	return nil
 }
 
-// Flush calls w.flush() if w.flush is non-nil, otherwise
-// it does nothing.
+// Flush calls through to the embedded ResponseWriter if it implements
+// http.Flusher, otherwise it does nothing. Flush records the number of
+// calls, and the time of the first call, in w.resp.
 func (w *responseWriter) Flush() {
 	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
 		flusher.Flush()
 	}
+	if w.resp.Flushes == 0 {
+		w.resp.FirstFlush = time.Now()
+	}
+	w.resp.Flushes++
 }
 
 type responseWriterHijacker struct {
@@ -287,6 +469,69 @@ func WithPanicPropagation() ServerOption {
 	}
 }
 
+// WithResponseContentTypeLabel returns a ServerOption which enables
+// recording the media type of the response's Content-Type header, such
+// as "application/json", as the transaction label ResponseContentTypeLabel.
+// Parameters such as charset are omitted. If the handler does not set a
+// Content-Type header, the label is omitted.
+//
+// The label is recorded independently of response header capture, which
+// is controlled by the tracer's header capture configuration.
+func WithResponseContentTypeLabel() ServerOption {
+	return func(h *handler) {
+		h.contentTypeLabel = true
+	}
+}
+
+// WithStreamingTransactionType returns a ServerOption which enables
+// reporting transactions for streamed responses, i.e. those flushed by
+// the handler or with the Content-Type "text/event-stream", with the
+// type StreamingTransactionType rather than "request". This separates
+// long-lived streaming requests from regular requests in latency
+// statistics. Streaming labels are recorded regardless of this option.
+func WithStreamingTransactionType() ServerOption {
+	return func(h *handler) {
+		h.streamingType = true
+	}
+}
+
+// WithErrorStatusReporting returns a ServerOption which enables reporting
+// an error for each response with a status code of at least minStatus,
+// such as http.StatusInternalServerError, even if the handler responded
+// without panicking. The beginning of the response body, if any, is used
+// as the error message; otherwise the status code and text are used.
+//
+// Errors are not reported for responses to requests which panicked, as
+// those are already reported by the recovery function. By default, no
+// errors are reported for error responses; minStatus of zero or less
+// disables reporting.
+func WithErrorStatusReporting(minStatus int) ServerOption {
+	return func(h *handler) {
+		h.errorStatusMin = minStatus
+	}
+}
+
+// WithSessionCookie returns a ServerOption which enables recording the
+// user session of each transaction, identified by the value of the named
+// request cookie, so that transactions made by the same user session or
+// visitor may be grouped together.
+//
+// Session cookies are commonly credentials, so the cookie value is not
+// recorded verbatim: the session ID recorded is a SHA-256 hash of the
+// value. By default, no session is recorded.
+func WithSessionCookie(name string) ServerOption {
+	return func(h *handler) {
+		h.sessionCookie = name
+	}
+}
+
+// hashSessionID returns the hex-encoded SHA-256 hash of the
+// session cookie value v.
+func hashSessionID(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])
+}
+
 // RequestNameFunc is the type of a function for use in
 // WithServerRequestName.
 type RequestNameFunc func(*http.Request) string
@@ -18,13 +18,19 @@
 package apmhttp_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -107,6 +113,175 @@ func TestHandler(t *testing.T) {
 	}, transaction.Context)
 }
 
+func TestHandlerResponseContentTypeLabel(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/json", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte("{}"))
+	}))
+	mux.Handle("/none", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	h := apmhttp.Wrap(mux, apmhttp.WithTracer(tracer), apmhttp.WithResponseContentTypeLabel())
+
+	for _, path := range []string{"/json", "/none"} {
+		req := httptest.NewRequest("GET", "http://server.testing"+path, nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	assert.Equal(t, model.IfaceMap{{
+		Key:   apmhttp.ResponseContentTypeLabel,
+		Value: "application/json",
+	}}, payloads.Transactions[0].Context.Tags)
+	assert.Nil(t, payloads.Transactions[1].Context.Tags)
+
+	// The label does not interfere with response header capture.
+	assert.Equal(t, model.Headers{{
+		Key:    "Content-Type",
+		Values: []string{"application/json; charset=utf-8"},
+	}}, payloads.Transactions[0].Context.Response.Headers)
+}
+
+func TestHandlerErrorStatusReporting(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/500", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "template: page:1: executing \"page\" failed", http.StatusInternalServerError)
+	}))
+	mux.Handle("/503", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	mux.Handle("/404", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	h := apmhttp.Wrap(mux, apmhttp.WithTracer(tracer), apmhttp.WithErrorStatusReporting(500))
+
+	for _, path := range []string{"/500", "/503", "/404"} {
+		req := httptest.NewRequest("GET", "http://server.testing"+path, nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 3)
+	require.Len(t, payloads.Errors, 2)
+
+	error500 := payloads.Errors[0]
+	assert.Equal(t, `template: page:1: executing "page" failed`, error500.Log.Message)
+	assert.Equal(t, payloads.Transactions[0].ID, error500.TransactionID)
+	assert.Equal(t, 500, error500.Context.Response.StatusCode)
+
+	error503 := payloads.Errors[1]
+	assert.Equal(t, "503 Service Unavailable", error503.Log.Message)
+	assert.Equal(t, payloads.Transactions[1].ID, error503.TransactionID)
+	assert.Equal(t, 503, error503.Context.Response.StatusCode)
+}
+
+func TestHandlerErrorStatusReportingDisabled(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	}), apmhttp.WithTracer(tracer))
+
+	req := httptest.NewRequest("GET", "http://server.testing/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Empty(t, payloads.Errors)
+}
+
+func TestHandlerErrorStatusReportingPanic(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(
+		http.HandlerFunc(panicHandler),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithErrorStatusReporting(400),
+	)
+
+	req := httptest.NewRequest("GET", "http://server.testing/foo", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	// Only the recovered panic is reported.
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, "foo", payloads.Errors[0].Exception.Message)
+}
+
+func TestHandlerSessionCookie(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithSessionCookie("sid"),
+	)
+
+	req := httptest.NewRequest("GET", "http://server.testing/", nil)
+	req.AddCookie(&http.Cookie{Name: "sid", Value: "secret"})
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://server.testing/", nil))
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+
+	// The cookie value is hashed, so as not to record the credential.
+	sum := sha256.Sum256([]byte("secret"))
+	assert.Equal(t, &model.TransactionSession{ID: hex.EncodeToString(sum[:])}, payloads.Transactions[0].Session)
+	assert.Nil(t, payloads.Transactions[1].Session)
+}
+
+func TestHandlerHTTP10NoHost(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(http.NotFoundHandler(), apmhttp.WithTracer(tracer))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	// HTTP/1.0 clients may omit the Host header,
+	// so send the request without one.
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /foo?bar HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	request := payloads.Transactions[0].Context.Request
+	serverAddr := server.Listener.Addr().(*net.TCPAddr)
+	assert.Equal(t, "1.0", request.HTTPVersion)
+	assert.Equal(t, model.URL{
+		Full:     "http://" + serverAddr.String() + "/foo?bar",
+		Protocol: "http",
+		Hostname: serverAddr.IP.String(),
+		Port:     strconv.Itoa(serverAddr.Port),
+		Path:     "/foo",
+		Search:   "bar",
+	}, request.URL)
+}
+
 func TestHandlerCaptureBodyRaw(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -272,6 +447,33 @@ func testPostError(h http.Handler, tracer *apm.Tracer, transport *transporttest.
 	return transport.Payloads().Errors[0]
 }
 
+func TestHandlerCaptureHeadersAllowList(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	tracer.SetCaptureHeadersMode(apm.CaptureHeadersAllowList, "User-Agent", "X-Response-*")
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Response-Id", "123")
+			w.Header().Set("X-Other", "456")
+		}),
+		apmhttp.WithTracer(tracer),
+	)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://server.testing/foo", nil)
+	req.Header.Set("User-Agent", "apmhttp-test")
+	req.Header.Set("X-Other", "789")
+	h.ServeHTTP(w, req)
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	transaction := payloads.Transactions[0]
+	assert.Equal(t, model.Headers{{Key: "User-Agent", Values: []string{"apmhttp-test"}}}, transaction.Context.Request.Headers)
+	assert.Equal(t, model.Headers{{Key: "X-Response-Id", Values: []string{"123"}}}, transaction.Context.Response.Headers)
+}
+
 func TestHandlerRecovery(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -445,6 +647,156 @@ func TestHandlerTraceparentHeader(t *testing.T) {
 	}
 }
 
+func TestHandlerRemoteParentID(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		clientTracer, clientTransport := transporttest.NewRecorderTracer()
+		defer clientTracer.Close()
+		serverTracer, serverTransport := transporttest.NewRecorderTracer()
+		defer serverTracer.Close()
+		if !sampled {
+			clientTracer.SetSampler(apm.NewRatioSampler(0))
+		}
+
+		server := httptest.NewServer(apmhttp.Wrap(http.NotFoundHandler(), apmhttp.WithTracer(serverTracer)))
+		defer server.Close()
+
+		tx := clientTracer.StartTransaction("name", "type")
+		mustGET(apm.ContextWithTransaction(context.Background(), tx), server.URL)
+		tx.End()
+		clientTracer.Flush(nil)
+		serverTracer.Flush(nil)
+
+		clientPayloads := clientTransport.Payloads()
+		serverPayloads := serverTransport.Payloads()
+		require.Len(t, clientPayloads.Transactions, 1)
+		require.Len(t, serverPayloads.Transactions, 1)
+		serverTransaction := serverPayloads.Transactions[0]
+		assert.Equal(t, clientPayloads.Transactions[0].TraceID, serverTransaction.TraceID)
+
+		// The server transaction's parent is the client's HTTP span if
+		// it was sampled, and otherwise the client transaction.
+		if sampled {
+			require.Len(t, clientPayloads.Spans, 1)
+			assert.Equal(t, clientPayloads.Spans[0].ID, serverTransaction.ParentID)
+		} else {
+			require.Len(t, clientPayloads.Spans, 0)
+			assert.Equal(t, clientPayloads.Transactions[0].ID, serverTransaction.ParentID)
+			require.NotNil(t, serverTransaction.Sampled)
+			assert.False(t, *serverTransaction.Sampled)
+		}
+	}
+}
+
+func TestHandlerTraceparentSampled(t *testing.T) {
+	const (
+		sampledTraceparent   = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+		unsampledTraceparent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"
+	)
+	for _, localSampled := range []bool{false, true} {
+		for _, test := range []struct {
+			traceparent string
+			sampled     bool
+		}{
+			{traceparent: sampledTraceparent, sampled: true},
+			{traceparent: unsampledTraceparent, sampled: false},
+			{traceparent: "", sampled: localSampled}, // no parent; local sampler decides
+		} {
+			tracer, transport := transporttest.NewRecorderTracer()
+			ratio := 0.0
+			if localSampled {
+				ratio = 1.0
+			}
+			tracer.SetSampler(apm.NewRatioSampler(ratio))
+
+			req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+			if test.traceparent != "" {
+				req.Header.Set("Traceparent", test.traceparent)
+			}
+			h := apmhttp.Wrap(http.NotFoundHandler(), apmhttp.WithTracer(tracer))
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			tracer.Flush(nil)
+			tracer.Close()
+
+			payloads := transport.Payloads()
+			require.Len(t, payloads.Transactions, 1)
+			sampled := payloads.Transactions[0].Sampled == nil || *payloads.Transactions[0].Sampled
+			assert.Equal(t, test.sampled, sampled, "traceparent=%q, local sampling=%v", test.traceparent, localSampled)
+		}
+	}
+}
+
+func TestHandlerStreaming(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+	}), apmhttp.WithTracer(tracer))
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "data: 0\n\ndata: 1\n\ndata: 2\n\n", string(body))
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	tx := payloads.Transactions[0]
+	assert.Equal(t, "request", tx.Type)
+	assert.Equal(t, "HTTP 2xx", tx.Result)
+
+	labels := make(map[string]interface{})
+	for _, label := range tx.Context.Tags {
+		labels[label.Key] = label.Value
+	}
+	assert.Equal(t, float64(3), labels["http_response_flushes"])
+	assert.Contains(t, labels, "http_response_streaming_duration_ms")
+}
+
+func TestHandlerStreamingTransactionType(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("data: 0\n\n"))
+		w.(http.Flusher).Flush()
+	}), apmhttp.WithTracer(tracer), apmhttp.WithStreamingTransactionType())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	for _, tx := range payloads.Transactions {
+		assert.Equal(t, "request.streaming", tx.Type)
+	}
+}
+
+func TestHandlerNotStreaming(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	}), apmhttp.WithTracer(tracer), apmhttp.WithStreamingTransactionType())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, "request", payloads.Transactions[0].Type)
+	assert.Empty(t, payloads.Transactions[0].Context.Tags)
+}
+
 func TestHandlerTracestateHeader(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.Handle("/foo", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
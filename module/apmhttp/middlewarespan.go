@@ -0,0 +1,54 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp
+
+import (
+	"time"
+
+	"go.elastic.co/apm"
+)
+
+// MiddlewareSpan records the time spent in web framework middleware,
+// from the start of a transaction until the request handler is entered,
+// for framework integrations which report it as a span.
+//
+// A MiddlewareSpan is not safe for concurrent use; it is intended to be
+// stored in the framework's request context, and ended by the same
+// request's middleware chain.
+type MiddlewareSpan struct {
+	tx    *apm.Transaction
+	start time.Time
+	ended bool
+}
+
+// StartMiddlewareSpan returns a new MiddlewareSpan for tx, starting now.
+func StartMiddlewareSpan(tx *apm.Transaction) *MiddlewareSpan {
+	return &MiddlewareSpan{tx: tx, start: time.Now()}
+}
+
+// End reports a span named "middleware" of type "app.middleware",
+// covering the time since the MiddlewareSpan was started. Only the
+// first call to End reports a span; subsequent calls do nothing.
+func (ms *MiddlewareSpan) End() {
+	if ms.ended {
+		return
+	}
+	ms.ended = true
+	span := ms.tx.StartSpanOptions("middleware", "app.middleware", apm.SpanOptions{Start: ms.start})
+	span.End()
+}
@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// DefaultPathGroupingRules holds the default rules used by
+// NewPathGroupingRequestName, replacing integer and UUID path
+// segments with the placeholder ":id".
+var DefaultPathGroupingRules = []PathGroupingRule{{
+	Pattern:     regexp.MustCompile(`[0-9]+`),
+	Placeholder: ":id",
+}, {
+	Pattern:     regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`),
+	Placeholder: ":id",
+}}
+
+// PathGroupingRule is a rule for replacing high-cardinality URL path
+// segments with a placeholder, for use with NewPathGroupingRequestName.
+type PathGroupingRule struct {
+	// Pattern is matched against each segment of the URL path.
+	// A segment is replaced only if Pattern matches the entire
+	// segment, i.e. patterns are implicitly anchored.
+	Pattern *regexp.Regexp
+
+	// Placeholder is the value with which matching segments
+	// are replaced, e.g. ":id".
+	Placeholder string
+}
+
+// NewPathGroupingRequestName returns a RequestNameFunc which names
+// transactions by the request method and URL path, as ServerRequestName
+// does, but with path segments matching any of the given rules replaced
+// by the rule's placeholder. For example, with the default rules, a
+// request for "/users/123/orders" is named "GET /users/:id/orders".
+//
+// Rules are tried in order, and the first matching rule is applied.
+// If no rules are specified, DefaultPathGroupingRules will be used.
+//
+// This is intended for use with WithServerRequestName, to obtain
+// low-cardinality transaction names without the use of a router.
+func NewPathGroupingRequestName(rules ...PathGroupingRule) RequestNameFunc {
+	if len(rules) == 0 {
+		rules = DefaultPathGroupingRules
+	}
+	// Anchor the patterns so they must match whole segments. Checking
+	// the extent of an unanchored match is not equivalent, as the
+	// leftmost match of an alternation such as "a|ab" may be shorter
+	// than the segment even if another alternative matches it entirely.
+	anchored := make([]PathGroupingRule, len(rules))
+	for i, rule := range rules {
+		if rule.Pattern == nil {
+			panic("rule.Pattern == nil")
+		}
+		anchored[i] = PathGroupingRule{
+			Pattern:     regexp.MustCompile(`^(?:` + rule.Pattern.String() + `)$`),
+			Placeholder: rule.Placeholder,
+		}
+	}
+	return func(req *http.Request) string {
+		return req.Method + " " + groupPath(req.URL.Path, anchored)
+	}
+}
+
+// groupPath returns path with segments matching rules replaced
+// by the corresponding placeholders. The rules' patterns must be
+// anchored.
+func groupPath(path string, rules []PathGroupingRule) string {
+	segments := strings.Split(path, "/")
+	var replaced bool
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		for _, rule := range rules {
+			if rule.Pattern.MatchString(segment) {
+				segments[i] = rule.Placeholder
+				replaced = true
+				break
+			}
+		}
+	}
+	if !replaced {
+		return path
+	}
+	return strings.Join(segments, "/")
+}
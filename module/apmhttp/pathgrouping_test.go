@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestPathGroupingRequestNameDefaultRules(t *testing.T) {
+	requestName := apmhttp.NewPathGroupingRequestName()
+	for path, expected := range map[string]string{
+		"/":                "GET /",
+		"/users":           "GET /users",
+		"/users/123":       "GET /users/:id",
+		"/users/123/":      "GET /users/:id/",
+		"/users/123/posts": "GET /users/:id/posts",
+		"/users/123abc":    "GET /users/123abc",
+		"/v2/items/0":      "GET /v2/items/:id",
+		"/orders/f47ac10b-58cc-4372-a567-0e02b2c3d479/items/7": "GET /orders/:id/items/:id",
+		"/orders/F47AC10B-58CC-4372-A567-0E02B2C3D479x":        "GET /orders/F47AC10B-58CC-4372-A567-0E02B2C3D479x",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		assert.Equal(t, expected, requestName(req), path)
+	}
+}
+
+func TestPathGroupingRequestNameCustomRules(t *testing.T) {
+	requestName := apmhttp.NewPathGroupingRequestName(
+		apmhttp.PathGroupingRule{Pattern: regexp.MustCompile(`[0-9a-f]{40}`), Placeholder: ":sha"},
+		apmhttp.PathGroupingRule{Pattern: regexp.MustCompile(`user-\d+`), Placeholder: ":user"},
+	)
+	req := httptest.NewRequest("POST", "/repos/user-42/commits/da39a3ee5e6b4b0d3255bfef95601890afd80709/123", nil)
+	// Custom rules replace the defaults, so "123" is not replaced.
+	assert.Equal(t, "POST /repos/:user/commits/:sha/123", requestName(req))
+}
+
+func TestPathGroupingRequestNameAlternation(t *testing.T) {
+	// The leftmost match of "a|ab" in "ab" is "a", but the
+	// pattern matches the entire segment with the second
+	// alternative.
+	requestName := apmhttp.NewPathGroupingRequestName(
+		apmhttp.PathGroupingRule{Pattern: regexp.MustCompile(`a|ab`), Placeholder: ":x"},
+	)
+	assert.Equal(t, "GET /:x/:x/abc", requestName(httptest.NewRequest("GET", "/a/ab/abc", nil)))
+}
+
+func TestPathGroupingRequestNameNilPattern(t *testing.T) {
+	assert.Panics(t, func() {
+		apmhttp.NewPathGroupingRequestName(apmhttp.PathGroupingRule{Placeholder: ":id"})
+	})
+}
+
+func TestPathGroupingRequestNameHandler(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithServerRequestName(apmhttp.NewPathGroupingRequestName()),
+	)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/123", nil))
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, "GET /users/:id", payloads.Transactions[0].Name)
+	assert.Equal(t, "/users/123", payloads.Transactions[0].Context.Request.URL.Path)
+}
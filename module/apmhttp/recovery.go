@@ -18,11 +18,32 @@
 package apmhttp
 
 import (
+	"fmt"
 	"net/http"
+	"reflect"
 
 	"go.elastic.co/apm"
 )
 
+func init() {
+	apm.RegisterTypeErrorDetailer(reflect.TypeOf(&panicError{}), apm.ErrorDetailerFunc(func(err error, details *apm.ErrorDetails) {
+		t := reflect.TypeOf(err.(*panicError).value)
+		if t == nil {
+			details.Type.Name = "nil"
+			details.Type.PackagePath = ""
+			return
+		}
+		if t.Name() == "" && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		details.Type.Name = t.Name()
+		if details.Type.Name == "" {
+			details.Type.Name = t.String()
+		}
+		details.Type.PackagePath = t.PkgPath()
+	}))
+}
+
 // RecoveryFunc is the type of a function for use in WithRecovery.
 type RecoveryFunc func(
 	w http.ResponseWriter,
@@ -52,9 +73,32 @@ func NewTraceRecovery(t *apm.Tracer) RecoveryFunc {
 		tx *apm.Transaction,
 		recovered interface{},
 	) {
-		e := t.Recovered(recovered)
+		e := RecoveredError(t, recovered)
 		e.SetTransaction(tx)
 		SetContext(&e.Context, req, resp, body)
 		e.Send()
 	}
 }
+
+// RecoveredError returns a new apm.Error, using the given Tracer, for a
+// value recovered from a panic.
+//
+// If v is an error, RecoveredError is equivalent to t.Recovered(v).
+// Otherwise the error's message is the value formatted with "%v", and
+// its type is the dynamic type of v, so that panics with values of
+// different types are grouped separately.
+func RecoveredError(t *apm.Tracer, v interface{}) *apm.Error {
+	if err, ok := v.(error); ok {
+		return t.Recovered(err)
+	}
+	return t.Recovered(&panicError{value: v})
+}
+
+// panicError is an error wrapping a non-error value recovered from a panic.
+type panicError struct {
+	value interface{}
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprint(e.value)
+}
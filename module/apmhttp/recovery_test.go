@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+type panicValue struct {
+	Reason string
+}
+
+func TestRecoveredError(t *testing.T) {
+	type test struct {
+		value   interface{}
+		message string
+		typ     string
+		module  string
+	}
+	tests := []test{{
+		value:   "boom",
+		message: "boom",
+		typ:     "string",
+	}, {
+		value:   123,
+		message: "123",
+		typ:     "int",
+	}, {
+		value:   []int{1, 2},
+		message: "[1 2]",
+		typ:     "[]int",
+	}, {
+		value:   panicValue{Reason: "boom"},
+		message: "{boom}",
+		typ:     "panicValue",
+		module:  "go.elastic.co/apm/module/apmhttp_test",
+	}, {
+		value:   &panicValue{Reason: "boom"},
+		message: "&{boom}",
+		typ:     "panicValue",
+		module:  "go.elastic.co/apm/module/apmhttp_test",
+	}, {
+		value:   errors.New("boom"),
+		message: "boom",
+		typ:     "errorString",
+		module:  "errors",
+	}, {
+		value:   recoverRuntimeError(func() { var m map[string]int; m["a"] = 1 }),
+		message: "assignment to entry in nil map",
+		typ:     "plainError",
+		module:  "runtime",
+	}, {
+		value:   recoverRuntimeError(func() { var s []int; _ = s[len(s)] }),
+		message: "runtime error: index out of range [0] with length 0",
+		typ:     "boundsError",
+		module:  "runtime",
+	}}
+
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	for _, test := range tests {
+		apmhttp.RecoveredError(tracer, test.value).Send()
+	}
+	tracer.Flush(nil)
+
+	errors := transport.Payloads().Errors
+	require.Len(t, errors, len(tests))
+	for i, test := range tests {
+		exception := errors[i].Exception
+		assert.Equal(t, test.message, exception.Message)
+		assert.Equal(t, test.typ, exception.Type)
+		assert.Equal(t, test.module, exception.Module)
+	}
+}
+
+func recoverRuntimeError(f func()) (v interface{}) {
+	defer func() { v = recover() }()
+	f()
+	return nil
+}
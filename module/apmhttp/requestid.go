@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	// RequestIDHeader is the conventional HTTP header for request IDs,
+	// which may be passed to WithServerRequestIDHeader and
+	// WithClientRequestIDHeader.
+	RequestIDHeader = "X-Request-Id"
+
+	// RequestIDLabel is the name of the transaction label in which
+	// request IDs are recorded.
+	RequestIDLabel = "request_id"
+)
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of parent in which the given
+// request ID is stored.
+func ContextWithRequestID(parent context.Context, id string) context.Context {
+	return context.WithValue(parent, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or the
+// empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDFunc is the type of a function for use in
+// WithServerRequestIDGenerator.
+type RequestIDFunc func(*http.Request) string
+
+// WithServerRequestIDHeader returns a ServerOption which enables
+// recording of request IDs, taken from the specified request header.
+//
+// If a request contains the header, its value will be recorded in the
+// transaction label "request_id", and stored in the request context
+// for propagation to outgoing requests; see WithClientRequestIDHeader
+// and RequestIDFromContext.
+func WithServerRequestIDHeader(header string) ServerOption {
+	if header == "" {
+		panic("header == \"\"")
+	}
+	return func(h *handler) {
+		h.requestIDHeader = http.CanonicalHeaderKey(header)
+	}
+}
+
+// WithServerRequestIDGenerator returns a ServerOption which sets f as the
+// function to use to generate a request ID for requests that do not contain
+// one. This has no effect unless WithServerRequestIDHeader is also used.
+func WithServerRequestIDGenerator(f RequestIDFunc) ServerOption {
+	if f == nil {
+		panic("f == nil")
+	}
+	return func(h *handler) {
+		h.requestIDGenerator = f
+	}
+}
+
+// WithClientRequestIDHeader returns a ClientOption which enables propagation
+// of request IDs stored in the request context (see RequestIDFromContext),
+// using the specified request header.
+//
+// If the outgoing request already has the header, it will not be replaced.
+func WithClientRequestIDHeader(header string) ClientOption {
+	if header == "" {
+		panic("header == \"\"")
+	}
+	return func(rt *roundTripper) {
+		rt.requestIDHeader = http.CanonicalHeaderKey(header)
+	}
+}
+
+// requestID returns the request ID for req, using h.requestIDHeader and
+// h.requestIDGenerator.
+func (h *handler) requestID(req *http.Request) string {
+	if h.requestIDHeader == "" {
+		return ""
+	}
+	if id := req.Header.Get(h.requestIDHeader); id != "" {
+		return id
+	}
+	if h.requestIDGenerator != nil {
+		return h.requestIDGenerator(req)
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestHandlerRequestID(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var contextRequestIDs []string
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			contextRequestIDs = append(contextRequestIDs, apmhttp.RequestIDFromContext(req.Context()))
+		}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithServerRequestIDHeader("x-request-id"),
+		apmhttp.WithServerRequestIDGenerator(func(*http.Request) string {
+			return "generated"
+		}),
+	)
+
+	req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+	req.Header.Set("X-Request-ID", "abc123")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	req, _ = http.NewRequest("GET", "http://server.testing/foo", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	assert.Equal(t, []string{"abc123", "generated"}, contextRequestIDs)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	assert.Equal(t, model.IfaceMap{{Key: "request_id", Value: "abc123"}}, payloads.Transactions[0].Context.Tags)
+	assert.Equal(t, model.IfaceMap{{Key: "request_id", Value: "generated"}}, payloads.Transactions[1].Context.Tags)
+}
+
+func TestHandlerRequestIDAbsent(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var contextRequestID = "unset"
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			contextRequestID = apmhttp.RequestIDFromContext(req.Context())
+		}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithServerRequestIDHeader(apmhttp.RequestIDHeader),
+	)
+	req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	assert.Equal(t, "", contextRequestID)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Empty(t, payloads.Transactions[0].Context.Tags)
+}
+
+func TestClientRequestID(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var requestIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestIDs = append(requestIDs, req.Header.Get("X-Request-Id"))
+	}))
+	defer server.Close()
+
+	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientRequestIDHeader(apmhttp.RequestIDHeader))
+	tx := tracer.StartTransaction("name", "type")
+	ctx := apm.ContextWithTransaction(context.Background(), tx)
+	ctx = apmhttp.ContextWithRequestID(ctx, "abc123")
+	defer tx.End()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, req.Header.Get("X-Request-Id")) // original request not modified
+
+	// An existing header is not overridden.
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("X-Request-Id", "def456")
+	resp, err = client.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []string{"abc123", "def456"}, requestIDs)
+}
+
+func TestClientRequestIDUntraced(t *testing.T) {
+	var requestIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestIDs = append(requestIDs, req.Header.Get("X-Request-Id"))
+	}))
+	defer server.Close()
+
+	// Requests with no transaction in their
+	// context still propagate the request ID.
+	client := apmhttp.WrapClient(http.DefaultClient, apmhttp.WithClientRequestIDHeader(apmhttp.RequestIDHeader))
+	ctx := apmhttp.ContextWithRequestID(context.Background(), "abc123")
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, req.Header.Get("X-Request-Id")) // original request not modified
+	assert.Equal(t, []string{"abc123"}, requestIDs)
+}
+
+func TestHandlerRequestIDIgnored(t *testing.T) {
+	tracer, _ := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var contextRequestID string
+	h := apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			contextRequestID = apmhttp.RequestIDFromContext(req.Context())
+		}),
+		apmhttp.WithTracer(tracer),
+		apmhttp.WithServerRequestIDHeader(apmhttp.RequestIDHeader),
+		apmhttp.WithServerRequestIgnorer(func(*http.Request) bool { return true }),
+	)
+	req, _ := http.NewRequest("GET", "http://server.testing/", nil)
+	req.Header.Set("X-Request-Id", "abc123")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "abc123", contextRequestID)
+}
@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type requestReceivedKey struct{}
+
+// ContextWithRequestReceived returns a copy of parent in which the given
+// request receipt time is stored.
+//
+// Transactions started by StartTransaction, and by the handlers and
+// framework middleware built on it, have their start time set to the
+// receipt time stored in the request context. This allows the
+// transaction duration to include time spent in middleware, or
+// elsewhere, before the transaction is started.
+func ContextWithRequestReceived(parent context.Context, t time.Time) context.Context {
+	return context.WithValue(parent, requestReceivedKey{}, t)
+}
+
+// RequestReceivedFromContext returns the request receipt time stored in
+// ctx, and a boolean indicating whether there is one.
+func RequestReceivedFromContext(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(requestReceivedKey{}).(time.Time)
+	return t, ok
+}
+
+// RecordRequestReceived returns an http.Handler which records the time
+// at which each request is received in the request context, and then
+// calls h. If the request context already holds a receipt time, it is
+// left unchanged.
+//
+// RecordRequestReceived should wrap the outermost handler, so that the
+// receipt time is recorded before any other middleware runs. The Go
+// standard library does not expose the time at which a request was read
+// from the connection, so the recorded time excludes time spent reading
+// the request headers.
+func RecordRequestReceived(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := RequestReceivedFromContext(req.Context()); !ok {
+			ctx := ContextWithRequestReceived(req.Context(), time.Now())
+			req = RequestWithContext(ctx, req)
+		}
+		h.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestRecordRequestReceived(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	const delay = 50 * time.Millisecond
+	h := apmhttp.RecordRequestReceived(slowMiddleware(delay, apmhttp.Wrap(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+		apmhttp.WithTracer(tracer),
+	)))
+
+	before := time.Now()
+	req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	tx := payloads.Transactions[0]
+	assert.WithinDuration(t, before, time.Time(tx.Timestamp), delay/2)
+	assert.True(t, tx.Duration >= float64(delay/time.Millisecond), tx.Duration)
+}
+
+func TestRecordRequestReceivedExisting(t *testing.T) {
+	var received []time.Time
+	h := apmhttp.RecordRequestReceived(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if t, ok := apmhttp.RequestReceivedFromContext(req.Context()); ok {
+			received = append(received, t)
+		}
+	}))
+
+	existing := time.Now().Add(-time.Minute)
+	req, _ := http.NewRequest("GET", "http://server.testing/foo", nil)
+	req = req.WithContext(apmhttp.ContextWithRequestReceived(req.Context(), existing))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	require.Len(t, received, 1)
+	assert.Equal(t, existing, received[0])
+
+	_, ok := apmhttp.RequestReceivedFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func slowMiddleware(d time.Duration, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(d)
+		h.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"go.elastic.co/apm"
+)
+
+// RetriesLabel is the name of the span label in which the number of
+// retries of an outgoing request is recorded, if it was retried.
+const RetriesLabel = "retries"
+
+type retryCounterKey struct{}
+
+// retryCounter records the attempts and retries of an outgoing request.
+type retryCounter struct {
+	attempts int32 // accessed atomically
+	retries  int32 // accessed atomically
+}
+
+// RecordRetry records a retry of the outgoing request with the given
+// context, if the request is being traced by a RoundTripper returned
+// by WrapRoundTripper. The number of retries is recorded in the span's
+// RetriesLabel label.
+//
+// Retries performed below the traced RoundTripper, for example by a
+// retrying http.RoundTripper wrapped by WrapRoundTripper, are not
+// otherwise visible to the agent. Such RoundTrippers may call
+// RecordRetry with the request's context for each retry, or may use
+// a RoundTripper returned by WrapAttemptCounter to send requests.
+func RecordRetry(ctx context.Context) {
+	if c, ok := ctx.Value(retryCounterKey{}).(*retryCounter); ok {
+		atomic.AddInt32(&c.retries, 1)
+	}
+}
+
+// WrapAttemptCounter returns an http.RoundTripper wrapping r, which
+// counts each request it sends as an attempt, recording all attempts
+// after the first with RecordRetry.
+//
+// WrapAttemptCounter should be used to wrap the http.RoundTripper used
+// by a retrying http.RoundTripper, which is itself wrapped by
+// WrapRoundTripper. For example:
+//
+//	transport := apmhttp.WrapRoundTripper(
+//		newRetryingTransport(apmhttp.WrapAttemptCounter(http.DefaultTransport)),
+//	)
+func WrapAttemptCounter(r http.RoundTripper) http.RoundTripper {
+	if r == nil {
+		panic("r == nil")
+	}
+	return attemptCounter{r}
+}
+
+type attemptCounter struct {
+	r http.RoundTripper
+}
+
+// RoundTrip records the request attempt, and delegates to the
+// wrapped http.RoundTripper.
+func (a attemptCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c, ok := req.Context().Value(retryCounterKey{}).(*retryCounter); ok {
+		if atomic.AddInt32(&c.attempts, 1) > 1 {
+			atomic.AddInt32(&c.retries, 1)
+		}
+	}
+	return a.r.RoundTrip(req)
+}
+
+// contextWithRetryCounter returns a copy of ctx with a new retryCounter.
+func contextWithRetryCounter(ctx context.Context) (context.Context, *retryCounter) {
+	c := &retryCounter{}
+	return context.WithValue(ctx, retryCounterKey{}, c), c
+}
+
+// setRetriesLabel records the number of retries counted by c
+// in span's RetriesLabel label, if there were any.
+func setRetriesLabel(span *apm.Span, c *retryCounter) {
+	if n := atomic.LoadInt32(&c.retries); n > 0 {
+		span.Context.SetLabel(RetriesLabel, int(n))
+	}
+}
@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestClientRetriesAttemptCounter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	transport := &retryingTransport{
+		transport:   apmhttp.WrapAttemptCounter(http.DefaultTransport),
+		maxAttempts: 5,
+	}
+	span := testClientRetries(t, server.URL, transport)
+	assert.Equal(t, 200, span.Context.HTTP.StatusCode)
+	assert.Equal(t, model.IfaceMap{{Key: apmhttp.RetriesLabel, Value: float64(2)}}, span.Context.Tags)
+}
+
+func TestClientRetriesRecordRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		apmhttp.RecordRetry(req.Context())
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	span := testClientRetries(t, server.URL, transport)
+	assert.Equal(t, model.IfaceMap{{Key: apmhttp.RetriesLabel, Value: float64(1)}}, span.Context.Tags)
+}
+
+func TestClientNoRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	span := testClientRetries(t, server.URL, apmhttp.WrapAttemptCounter(http.DefaultTransport))
+	assert.Nil(t, span.Context.Tags)
+}
+
+func testClientRetries(t *testing.T, url string, transport http.RoundTripper) model.Span {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	client := &http.Client{Transport: apmhttp.WrapRoundTripper(transport)}
+	tx := tracer.StartTransaction("name", "type")
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req.WithContext(apm.ContextWithTransaction(context.Background(), tx)))
+	require.NoError(t, err)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	spans := recorder.Payloads().Spans
+	require.Len(t, spans, 1)
+	return spans[0]
+}
+
+// retryingTransport is an http.RoundTripper which retries requests
+// for which the server responds with 503 Service Unavailable.
+type retryingTransport struct {
+	transport   http.RoundTripper
+	maxAttempts int
+}
+
+func (r *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := r.transport.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusServiceUnavailable || attempt == r.maxAttempts {
+			return resp, err
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,322 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.elastic.co/apm"
+)
+
+// RetrySkippedLabel is the name of the span label in which the reason
+// for not retrying a failed request is recorded by a RoundTripper
+// returned by NewRetryingRoundTripper, when the request would otherwise
+// have been retried.
+const RetrySkippedLabel = "retry_skipped"
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBackoff     = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = 30 * time.Second
+
+	// maxRetryDrainSize is the maximum number of bytes read from a
+	// response body before retrying, so the connection can be reused.
+	// Larger bodies are closed without being fully read.
+	maxRetryDrainSize = 4 << 10
+)
+
+// RetryPolicy controls the retrying of requests by a RoundTripper
+// returned by NewRetryingRoundTripper.
+type RetryPolicy struct {
+	// MaxAttempts holds the maximum number of attempts made for each
+	// request, including the first. If MaxAttempts is zero, 3 attempts
+	// will be made; if it is negative, requests will not be retried.
+	MaxAttempts int
+
+	// Backoff, if non-nil, returns the amount of time to wait before
+	// the given retry, numbered from 1. If Backoff is nil, retries are
+	// delayed exponentially, starting with 100ms, unless a response with
+	// the status code 429 (Too Many Requests) or 503 (Service Unavailable)
+	// has a Retry-After header, in which case the delay it specifies is
+	// used. The request's context may be used to bound the delay.
+	Backoff func(retry int) time.Duration
+
+	// MaxBackoff holds the maximum delay before a retry when Backoff is
+	// nil. Exponential delays are capped at MaxBackoff, and if the delay
+	// requested by a Retry-After header exceeds MaxBackoff, the request is
+	// not retried and the response is returned. If MaxBackoff is zero, a
+	// maximum of 30 seconds is used; if it is negative, there is no maximum.
+	MaxBackoff time.Duration
+
+	// Retryable, if non-nil, reports whether a request should be retried
+	// given the response or error returned by an attempt. If Retryable is
+	// nil, DefaultRetryable is used.
+	Retryable func(resp *http.Response, err error) bool
+}
+
+// DefaultRetryable reports whether a request should be retried given
+// the response or error returned by an attempt: requests are retried
+// if they fail with an error, or respond with one of the status codes
+// 429 (Too Many Requests), 502 (Bad Gateway), 503 (Service Unavailable),
+// or 504 (Gateway Timeout).
+func DefaultRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (p RetryPolicy) maxAttempts() int {
+	switch {
+	case p.MaxAttempts == 0:
+		return defaultRetryMaxAttempts
+	case p.MaxAttempts < 0:
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+func (p RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff == 0 {
+		return defaultRetryMaxBackoff
+	}
+	return p.MaxBackoff
+}
+
+// backoff returns the amount of time to wait before the given retry,
+// following a response resp (which may be nil), and a boolean indicating
+// whether the request should be retried: false if the delay requested by
+// resp's Retry-After header exceeds the maximum backoff.
+func (p RetryPolicy) backoff(retry int, resp *http.Response) (time.Duration, bool) {
+	if p.Backoff != nil {
+		return p.Backoff(retry), true
+	}
+	maxBackoff := p.maxBackoff()
+	if resp != nil {
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			if d, ok := retryAfter(resp); ok {
+				return d, maxBackoff < 0 || d <= maxBackoff
+			}
+		}
+	}
+	d := defaultRetryBackoff << uint(retry-1)
+	if maxBackoff >= 0 && (d > maxBackoff || d <= 0) {
+		// d <= 0 if the shift overflowed.
+		d = maxBackoff
+	}
+	return d, true
+}
+
+// retryAfter returns the delay specified by resp's Retry-After header,
+// which may hold either a number of seconds or an HTTP date, and a
+// boolean indicating whether the header holds a valid delay.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if d := time.Until(t); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+func (p RetryPolicy) retryable(resp *http.Response, err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(resp, err)
+	}
+	return DefaultRetryable(resp, err)
+}
+
+// NewRetryingRoundTripper returns an http.RoundTripper which sends
+// requests using base, retrying idempotent requests as described by
+// policy. If base is nil, http.DefaultTransport is used.
+//
+// Each attempt is traced with a RoundTripper returned by WrapRoundTripper,
+// configured with the given options, so that each attempt is reported as
+// a span, and propagates its own trace context. If the request's context
+// contains a sampled transaction, the attempts are grouped under a single
+// span of type "external.http" with the action "retry", representing the
+// logical request, and the number of retries is recorded in its
+// RetriesLabel label.
+//
+// Only requests with idempotent methods (GET, HEAD, OPTIONS, TRACE, PUT,
+// and DELETE), or with an Idempotency-Key or X-Idempotency-Key header,
+// are retried. Requests with a body are only retried if the body can be
+// rewound with the request's GetBody field, which is set by
+// http.NewRequest for common body types. If a request would otherwise be
+// retried, the reason for not retrying it is recorded in the logical
+// span's RetrySkippedLabel label.
+//
+// Retries are abandoned if the request's context is done while waiting
+// to retry, in which case the context's error is returned. If a response's
+// Retry-After header requests a delay longer than policy's MaxBackoff, the
+// request is not retried, and the response is returned.
+func NewRetryingRoundTripper(base http.RoundTripper, policy RetryPolicy, o ...ClientOption) http.RoundTripper {
+	return &retryingRoundTripper{
+		r:      WrapRoundTripper(base, o...),
+		policy: policy,
+	}
+}
+
+type retryingRoundTripper struct {
+	r      http.RoundTripper
+	policy RetryPolicy
+}
+
+// RoundTrip sends req using r.r, retrying according to r.policy.
+func (r *retryingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	var span *apm.Span
+	if tx := apm.TransactionFromContext(ctx); tx != nil && tx.Sampled() {
+		span, ctx = apm.StartSpan(ctx, ClientRequestName(req), "external.http")
+		if !span.Dropped() {
+			span.Action = "retry"
+			req = RequestWithContext(ctx, req)
+		} else {
+			span.End()
+			span = nil
+		}
+	}
+
+	var skipReason string
+	switch {
+	case !isIdempotentRequest(req):
+		skipReason = "request not idempotent"
+	case req.Body != nil && req.Body != http.NoBody && req.GetBody == nil:
+		skipReason = "request body not rewindable"
+	}
+
+	maxAttempts := r.policy.maxAttempts()
+	attemptReq := req
+	var resp *http.Response
+	var err error
+	for attempt := 1; ; attempt++ {
+		resp, err = r.r.RoundTrip(attemptReq)
+		if attempt == maxAttempts || !r.policy.retryable(resp, err) {
+			break
+		}
+		if skipReason != "" {
+			if span != nil {
+				span.Context.SetLabel(RetrySkippedLabel, skipReason)
+			}
+			break
+		}
+		delay, ok := r.policy.backoff(attempt, resp)
+		if !ok {
+			if span != nil {
+				span.Context.SetLabel(RetrySkippedLabel, "Retry-After exceeds MaxBackoff")
+			}
+			break
+		}
+		if attemptReq, err = r.nextAttempt(ctx, req, resp, delay); err != nil {
+			resp = nil
+			break
+		}
+		if span != nil {
+			span.Context.SetLabel(RetriesLabel, attempt)
+		}
+	}
+
+	if span != nil {
+		if err != nil {
+			span.End()
+		} else {
+			// The logical span is ended along with the final
+			// attempt's span, when the response body is consumed.
+			resp.Body = &responseBody{span: span, body: resp.Body}
+		}
+	}
+	return resp, err
+}
+
+// nextAttempt discards resp, if non-nil, and waits for delay before
+// returning a copy of req to send for the next attempt.
+func (r *retryingRoundTripper) nextAttempt(ctx context.Context, req *http.Request, resp *http.Response, delay time.Duration) (*http.Request, error) {
+	if resp != nil {
+		// Drain the body so the connection can be reused,
+		// and to end the attempt's span.
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxRetryDrainSize))
+		resp.Body.Close()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	reqCopy := *req
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		reqCopy.Body = body
+	}
+	return &reqCopy, nil
+}
+
+// CloseIdleConnections calls r.r.CloseIdleConnections if the method exists.
+func (r *retryingRoundTripper) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if r, ok := r.r.(closeIdler); ok {
+		r.CloseIdleConnections()
+	}
+}
+
+// isIdempotentRequest reports whether req may be safely retried.
+func isIdempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	if _, ok := req.Header["X-Idempotency-Key"]; ok {
+		return true
+	}
+	return false
+}
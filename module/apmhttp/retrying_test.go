@@ -0,0 +1,248 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmhttp_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestRetryingRoundTripper(t *testing.T) {
+	server, requests := newRetryServer(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK)
+	defer server.Close()
+
+	req, _ := http.NewRequest("PUT", server.URL, strings.NewReader("body"))
+	resp, spans := testRetryingRoundTripper(t, req, apmhttp.RetryPolicy{})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The logical span is ended last, after the attempt spans.
+	require.Len(t, spans, 4)
+	logical := spans[3]
+	assert.Equal(t, "external", logical.Type)
+	assert.Equal(t, "http", logical.Subtype)
+	assert.Equal(t, "retry", logical.Action)
+	assert.Equal(t, model.IfaceMap{{Key: apmhttp.RetriesLabel, Value: float64(2)}}, logical.Context.Tags)
+
+	// Each attempt is a child of the logical span,
+	// and propagates its own trace context.
+	require.Len(t, *requests, 3)
+	for i, attempt := range spans[:3] {
+		assert.Equal(t, logical.ID, attempt.ParentID)
+		traceparent := (*requests)[i].Header.Get(apmhttp.W3CTraceparentHeader)
+		traceContext, err := apmhttp.ParseTraceparentHeader(traceparent)
+		require.NoError(t, err)
+		assert.Equal(t, model.SpanID(traceContext.Span), attempt.ID)
+		assert.Equal(t, "body", (*requests)[i].body)
+	}
+}
+
+func TestRetryingRoundTripperMaxAttempts(t *testing.T) {
+	server, requests := newRetryServer(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, spans := testRetryingRoundTripper(t, req, apmhttp.RetryPolicy{MaxAttempts: 2})
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Len(t, *requests, 2)
+	require.Len(t, spans, 3)
+	assert.Equal(t, 503, spans[1].Context.HTTP.StatusCode)
+}
+
+func TestRetryingRoundTripperNotRetryable(t *testing.T) {
+	server, requests := newRetryServer(http.StatusInternalServerError, http.StatusOK)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, spans := testRetryingRoundTripper(t, req, apmhttp.RetryPolicy{})
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Len(t, *requests, 1)
+	require.Len(t, spans, 2)
+	assert.Nil(t, spans[1].Context)
+
+	// A custom policy may retry other responses.
+	server, requests = newRetryServer(http.StatusInternalServerError, http.StatusOK)
+	defer server.Close()
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	resp, _ = testRetryingRoundTripper(t, req, apmhttp.RetryPolicy{
+		Retryable: func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode >= 500
+		},
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, *requests, 2)
+}
+
+func TestRetryingRoundTripperSkipped(t *testing.T) {
+	for name, newRequest := range map[string]func(url string) *http.Request{
+		"request not idempotent": func(url string) *http.Request {
+			req, _ := http.NewRequest("POST", url, strings.NewReader("body"))
+			return req
+		},
+		"request body not rewindable": func(url string) *http.Request {
+			req, _ := http.NewRequest("PUT", url, ioutil.NopCloser(strings.NewReader("body")))
+			return req
+		},
+	} {
+		newRequest := newRequest
+		t.Run(name, func(t *testing.T) {
+			server, requests := newRetryServer(http.StatusServiceUnavailable, http.StatusOK)
+			defer server.Close()
+
+			resp, spans := testRetryingRoundTripper(t, newRequest(server.URL), apmhttp.RetryPolicy{})
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+			assert.Len(t, *requests, 1)
+			require.Len(t, spans, 2)
+			assert.Equal(t, model.IfaceMap{{Key: apmhttp.RetrySkippedLabel, Value: name}}, spans[1].Context.Tags)
+		})
+	}
+}
+
+func TestRetryingRoundTripperContextCancelled(t *testing.T) {
+	server, requests := newRetryServer(http.StatusServiceUnavailable, http.StatusOK)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &http.Client{Transport: apmhttp.NewRetryingRoundTripper(nil, apmhttp.RetryPolicy{
+		Backoff: func(int) time.Duration {
+			cancel()
+			return time.Hour
+		},
+	})}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	_, err := client.Do(req.WithContext(ctx))
+	assert.Error(t, err)
+	assert.Len(t, *requests, 1)
+}
+
+func TestRetryingRoundTripperRetryAfter(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: apmhttp.NewRetryingRoundTripper(nil, apmhttp.RetryPolicy{})}
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, requests)
+	assert.True(t, time.Since(start) >= time.Second, "Retry-After not respected")
+}
+
+func TestRetryingRoundTripperRetryAfterMaxBackoff(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	client := &http.Client{Transport: apmhttp.NewRetryingRoundTripper(nil, apmhttp.RetryPolicy{})}
+	tx := tracer.StartTransaction("name", "type")
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(apm.ContextWithTransaction(context.Background(), tx)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+
+	// The Retry-After delay exceeds the default MaxBackoff,
+	// so the response is returned without retrying.
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 1, requests)
+	assert.True(t, time.Since(start) < 30*time.Second)
+	spans := recorder.Payloads().Spans
+	require.Len(t, spans, 2)
+	var logical model.Span
+	for _, span := range spans {
+		if span.Action == "retry" {
+			logical = span
+		}
+	}
+	require.NotNil(t, logical.Context)
+	assert.Equal(t, model.IfaceMap{
+		{Key: apmhttp.RetrySkippedLabel, Value: "Retry-After exceeds MaxBackoff"},
+	}, logical.Context.Tags)
+}
+
+func testRetryingRoundTripper(t *testing.T, req *http.Request, policy apmhttp.RetryPolicy) (*http.Response, []model.Span) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	if policy.Backoff == nil {
+		policy.Backoff = func(int) time.Duration { return 0 }
+	}
+	client := &http.Client{Transport: apmhttp.NewRetryingRoundTripper(nil, policy)}
+	tx := tracer.StartTransaction("name", "type")
+	resp, err := client.Do(req.WithContext(apm.ContextWithTransaction(context.Background(), tx)))
+	require.NoError(t, err)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	tx.End()
+	tracer.Flush(nil)
+	return resp, recorder.Payloads().Spans
+}
+
+type retryServerRequest struct {
+	*http.Request
+	body string
+}
+
+// newRetryServer returns a server which responds to successive
+// requests with the given status codes, and a pointer to the slice
+// in which the requests it receives are recorded.
+func newRetryServer(statusCodes ...int) (*httptest.Server, *[]retryServerRequest) {
+	var mu sync.Mutex
+	var requests []retryServerRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		statusCode := statusCodes[len(requests)]
+		requests = append(requests, retryServerRequest{Request: req, body: string(body)})
+		mu.Unlock()
+		w.WriteHeader(statusCode)
+		io.WriteString(w, "response")
+	}))
+	return server, &requests
+}
@@ -2,6 +2,7 @@ module go.elastic.co/apm/module/apmiris
 
 require (
 	github.com/kataras/iris v11.1.1+incompatible
+	github.com/stretchr/testify v1.4.0
 	go.elastic.co/apm v1.7.2
 	go.elastic.co/apm/module/apmhttp v1.7.2
 )
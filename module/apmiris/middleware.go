@@ -10,7 +10,6 @@ package apmiris
 
 import (
 	"net/http"
-	"sync"
 
 	"github.com/kataras/iris"
 
@@ -26,9 +25,13 @@ func init() {
 	)
 }
 
+// Middleware returns an iris.Handler which traces requests, naming
+// transactions after the route matched by iris for each request, so
+// routes registered at any time are named correctly.
+//
+// The engine argument is ignored, and is kept only for compatibility.
 func Middleware(engine *iris.Application, o ...Option) iris.Handler {
 	m := &middleware{
-		engine:         engine,
 		tracer:         apm.DefaultTracer,
 		requestIgnorer: apmhttp.DefaultServerRequestIgnorer(),
 	}
@@ -39,16 +42,9 @@ func Middleware(engine *iris.Application, o ...Option) iris.Handler {
 }
 
 type middleware struct {
-	engine         *iris.Application
 	tracer         *apm.Tracer
 	requestIgnorer apmhttp.RequestIgnorerFunc
-
-	setRouteMapOnce sync.Once
-	routeMap        map[string]map[string]routeInfo
-}
-
-type routeInfo struct {
-	transactionName string // e.g. "GET /foo"
+	resultMapper   ResultMapperFunc
 }
 
 func (m *middleware) handle(c iris.Context) {
@@ -56,26 +52,12 @@ func (m *middleware) handle(c iris.Context) {
 		c.Next()
 		return
 	}
-	m.setRouteMapOnce.Do(func() {
-		routes := m.engine.GetRoutes()
-		rm := make(map[string]map[string]routeInfo)
-		for _, r := range routes {
-			mm := rm[r.Method]
-			if mm == nil {
-				mm = make(map[string]routeInfo)
-				rm[r.Method] = mm
-			}
-			mm[r.Path] = routeInfo{
-				transactionName: r.Method + " " + r.Path,
-			}
-		}
-		m.routeMap = rm
-	})
-
+	// The current route is looked up by iris for each request,
+	// so there is no route map to keep in sync with the routes
+	// registered with the application.
 	var requestName string
-	handlerName := c.GetCurrentRoute().Path()
-	if routeInfo, ok := m.routeMap[c.Request().Method][handlerName]; ok {
-		requestName = routeInfo.transactionName
+	if route := c.GetCurrentRoute(); route != nil {
+		requestName = route.Method() + " " + route.Path()
 	} else {
 		requestName = apmhttp.UnknownRouteRequestName(c.Request())
 	}
@@ -87,13 +69,20 @@ func (m *middleware) handle(c iris.Context) {
 		if v := recover(); v != nil {
 			c.StatusCode(http.StatusInternalServerError)
 			c.StopExecution()
-			e := m.tracer.Recovered(v)
+			e := apmhttp.RecoveredError(m.tracer, v)
 			e.SetTransaction(tx)
 			setContext(&e.Context, c, body, req)
 			e.Send()
 		}
 		c.ResponseWriter().Header()
 		tx.Result = apmhttp.StatusCodeResult(c.ResponseWriter().StatusCode())
+		if m.resultMapper != nil {
+			result, outcome := m.resultMapper(c)
+			if result != "" {
+				tx.Result = result
+			}
+			tx.Outcome = outcome
+		}
 
 		if tx.Sampled() {
 			setContext(&tx.Context, c, body, req)
@@ -132,3 +121,24 @@ func WithRequestIgnorer(r apmhttp.RequestIgnorerFunc) Option {
 		m.requestIgnorer = r
 	}
 }
+
+// ResultMapperFunc is the type of a function for use in WithResultMapper.
+type ResultMapperFunc func(c iris.Context) (result, outcome string)
+
+// WithResultMapper returns an Option which sets f as the function
+// used to map the handled request to the transaction result and
+// outcome, e.g. for APIs which report errors in the response body
+// with a 200 status code.
+//
+// f is called after the handler returns. If f returns an empty
+// result, the result will be derived from the response status
+// code as usual; if it returns an empty outcome, no outcome will
+// be reported.
+func WithResultMapper(f ResultMapperFunc) Option {
+	if f == nil {
+		panic("f == nil")
+	}
+	return func(m *middleware) {
+		m.resultMapper = f
+	}
+}
@@ -0,0 +1,165 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmiris_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/module/apmiris"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestMiddlewareTransactionName(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	app := iris.New()
+	app.Use(apmiris.Middleware(app, apmiris.WithTracer(tracer)))
+	app.Get("/hello/{name}", func(c iris.Context) {})
+	require.NoError(t, app.Build())
+
+	serve(app, "GET", "/hello/isbel")
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, "GET /hello/{name}", payloads.Transactions[0].Name)
+	assert.Equal(t, "HTTP 2xx", payloads.Transactions[0].Result)
+}
+
+func TestMiddlewareRoutesAddedLater(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	app := iris.New()
+	app.Use(apmiris.Middleware(app, apmiris.WithTracer(tracer)))
+	app.Get("/foo", func(c iris.Context) {})
+	require.NoError(t, app.Build())
+	serve(app, "GET", "/foo")
+
+	// Routes registered after the application has started serving
+	// are named once the router has been refreshed.
+	app.Post("/bar/{id}", func(c iris.Context) {})
+	require.NoError(t, app.RefreshRouter())
+	serve(app, "POST", "/bar/123")
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	assert.Equal(t, "GET /foo", payloads.Transactions[0].Name)
+	assert.Equal(t, "POST /bar/{id}", payloads.Transactions[1].Name)
+}
+
+func TestMiddlewareEngineIgnored(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	// The middleware is created before any routes are registered,
+	// and without the application, as the engine argument is unused.
+	middleware := apmiris.Middleware(nil, apmiris.WithTracer(tracer))
+	app := iris.New()
+	app.Use(middleware)
+	app.Get("/hello/{name}", func(c iris.Context) {})
+	require.NoError(t, app.Build())
+
+	serve(app, "GET", "/hello/isbel")
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, "GET /hello/{name}", payloads.Transactions[0].Name)
+}
+
+func TestMiddlewareConcurrentRequests(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	app := iris.New()
+	app.Use(apmiris.Middleware(app, apmiris.WithTracer(tracer)))
+	app.Get("/foo", func(c iris.Context) {})
+	require.NoError(t, app.Build())
+
+	const n = 10
+	done := make(chan struct{})
+	for i := 0; i < n; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			serve(app, "GET", "/foo")
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-done
+	}
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, n)
+	for _, tx := range payloads.Transactions {
+		assert.Equal(t, "GET /foo", tx.Name)
+	}
+}
+
+func TestMiddlewareResultMapper(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	app := iris.New()
+	app.Use(apmiris.Middleware(app,
+		apmiris.WithTracer(tracer),
+		apmiris.WithResultMapper(func(c iris.Context) (string, string) {
+			if c.ResponseWriter().Header().Get("X-Error") != "" {
+				return "business error", "failure"
+			}
+			return "", ""
+		}),
+	))
+	app.Get("/ok", func(c iris.Context) {})
+	app.Get("/error", func(c iris.Context) {
+		c.Header("X-Error", "insufficient funds")
+	})
+	require.NoError(t, app.Build())
+
+	serve(app, "GET", "/ok")
+	serve(app, "GET", "/error")
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+
+	// An empty result falls back to the status code result,
+	// and an empty outcome is not reported.
+	assert.Equal(t, "HTTP 2xx", payloads.Transactions[0].Result)
+	assert.Equal(t, "", payloads.Transactions[0].Outcome)
+	assert.Equal(t, "business error", payloads.Transactions[1].Result)
+	assert.Equal(t, "failure", payloads.Transactions[1].Outcome)
+}
+
+func TestWithResultMapperNil(t *testing.T) {
+	assert.Panics(t, func() { apmiris.WithResultMapper(nil) })
+}
+
+func serve(h http.Handler, method, path string) {
+	req, _ := http.NewRequest(method, "http://server.testing"+path, nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -94,7 +94,7 @@ func (h *Hook) Fire(entry *logrus.Entry) error {
 	err, _ := entry.Data[logrus.ErrorKey].(error)
 	errlog := tracer.NewErrorLog(apm.ErrorLogRecord{
 		Message: entry.Message,
-		Level:   entry.Level.String(),
+		Level:   errorLevel(entry.Level),
 		Error:   err,
 	})
 	errlog.Handled = true
@@ -130,3 +130,17 @@ func (h *Hook) Fire(entry *logrus.Entry) error {
 	}
 	return nil
 }
+
+// errorLevel returns the apm.Error severity level corresponding
+// to the given logrus level.
+func errorLevel(level logrus.Level) string {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return apm.ErrorLevelCritical
+	case logrus.ErrorLevel:
+		return apm.ErrorLevelError
+	case logrus.WarnLevel:
+		return apm.ErrorLevelWarning
+	}
+	return level.String()
+}
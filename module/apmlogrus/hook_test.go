@@ -94,6 +94,26 @@ func TestHookTransactionTraceContext(t *testing.T) {
 	assert.Equal(t, payloads.Transactions[0].ID, err0.TransactionID)
 }
 
+func TestHookWarningLevel(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var buf bytes.Buffer
+	logger := newLogger(&buf)
+	logger.AddHook(&apmlogrus.Hook{
+		Tracer:    tracer,
+		LogLevels: []logrus.Level{logrus.WarnLevel, logrus.ErrorLevel},
+	})
+	logger.Warn("take care")
+	logger.Error("oh no")
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Errors, 2)
+	assert.Equal(t, apm.ErrorLevelWarning, payloads.Errors[0].Log.Level)
+	assert.Equal(t, apm.ErrorLevelError, payloads.Errors[1].Log.Level)
+}
+
 func TestHookWithError(t *testing.T) {
 	tracer, transport := transporttest.NewRecorderTracer()
 	defer tracer.Close()
@@ -157,7 +177,7 @@ func TestHookFatal(t *testing.T) {
 	payloads := recorder.Payloads()
 	require.Len(t, payloads.Errors, 1)
 	assert.Equal(t, "fatality!", payloads.Errors[0].Log.Message)
-	assert.Equal(t, "fatal", payloads.Errors[0].Log.Level)
+	assert.Equal(t, "critical", payloads.Errors[0].Log.Level)
 }
 
 func TestHookTracerClosed(t *testing.T) {
@@ -92,10 +92,11 @@ func (c *commandMonitor) started(ctx context.Context, event *event.CommandStarte
 	if collectionName, ok := collectionName(event.CommandName, event.Command); ok {
 		spanName = collectionName + "." + spanName
 	}
-	span, _ := apm.StartSpan(ctx, spanName, "db.mongodb.query")
+	span, _ := apm.StartSpan(ctx, spanName, "db.mongodb")
 	if span.Dropped() {
 		return
 	}
+	span.SetTypeSubtypeAction("db", "mongodb", event.CommandName)
 
 	var statement string
 	if len(event.Command) > 0 {
@@ -119,6 +120,10 @@ func (c *commandMonitor) started(ctx context.Context, event *event.CommandStarte
 		Type:      "mongodb",
 		Statement: statement,
 	})
+	span.Context.SetServiceTarget(apm.ServiceTargetSpanContext{
+		Type: "mongodb",
+		Name: event.DatabaseName,
+	})
 
 	// The command/event monitoring API does not provide a means of associating
 	// arbitrary data with a request, so we must maintain our own map.
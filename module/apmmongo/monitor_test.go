@@ -141,7 +141,7 @@ func testCommandMonitorFinished(t *testing.T, failure string) {
 	assert.Equal(t, "test_coll.find", spans[0].Name)
 	assert.Equal(t, "db", spans[0].Type)
 	assert.Equal(t, "mongodb", spans[0].Subtype)
-	assert.Equal(t, "query", spans[0].Action)
+	assert.Equal(t, "find", spans[0].Action)
 	assert.Equal(t, 123.0, spans[0].Duration)
 	assert.Equal(t, &model.SpanContext{
 		Database: &model.DatabaseSpanContext{
@@ -149,6 +149,9 @@ func testCommandMonitorFinished(t *testing.T, failure string) {
 			Type:      "mongodb",
 			Statement: `{"find":"test_coll"}`,
 		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "mongodb", Name: "test_db"},
+		},
 	}, spans[0].Context)
 }
 
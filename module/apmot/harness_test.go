@@ -28,7 +28,6 @@ import (
 
 	"go.elastic.co/apm"
 	"go.elastic.co/apm/apmtest"
-	"go.elastic.co/apm/module/apmhttp"
 )
 
 func TestHarness(t *testing.T) {
@@ -36,14 +35,20 @@ func TestHarness(t *testing.T) {
 	// basic support *for the tests only* so we can check compatibility
 	// with the HTTP and text formats.
 	binaryInject = func(w io.Writer, traceContext apm.TraceContext) error {
-		return json.NewEncoder(w).Encode(apmhttp.FormatTraceparentHeader(traceContext))
+		carrier := make(apm.SpanContextCarrier)
+		carrier.Inject(traceContext)
+		return json.NewEncoder(w).Encode(carrier)
 	}
 	binaryExtract = func(r io.Reader) (apm.TraceContext, error) {
-		var headerValue string
-		if err := json.NewDecoder(r).Decode(&headerValue); err != nil {
+		var carrier apm.SpanContextCarrier
+		if err := json.NewDecoder(r).Decode(&carrier); err != nil {
 			return apm.TraceContext{}, err
 		}
-		return apmhttp.ParseTraceparentHeader(headerValue)
+		traceContext, ok := carrier.Extract()
+		if !ok {
+			return apm.TraceContext{}, opentracing.ErrSpanContextCorrupted
+		}
+		return traceContext, nil
 	}
 	defer func() {
 		binaryInject = binaryInjectUnsupported
@@ -115,5 +120,8 @@ func (harnessAPIProbe) SameSpanContext(span opentracing.Span, sc opentracing.Spa
 	if !ok {
 		return false
 	}
-	return ctx1.traceContext == ctx2.traceContext
+	// TraceState holds pointers to its entries, so compare its string form.
+	tc1, tc2 := ctx1.traceContext, ctx2.traceContext
+	return tc1.Trace == tc2.Trace && tc1.Span == tc2.Span && tc1.Options == tc2.Options &&
+		tc1.State.String() == tc2.State.String()
 }
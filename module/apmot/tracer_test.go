@@ -189,6 +189,12 @@ func TestHTTPSpan(t *testing.T) {
 				Resource: "testing.invalid:8443",
 			},
 		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{
+				Type: "http",
+				Name: "testing.invalid:8443",
+			},
+		},
 	}, modelSpan.Context)
 }
 
@@ -93,7 +93,7 @@ func Do(ctx context.Context, conn redis.Conn, commandName string, args ...interf
 	if spanName == "" {
 		spanName = "(flush pipeline)"
 	}
-	span, _ := apm.StartSpan(ctx, spanName, "db.redis")
+	span := startSpan(ctx, spanName, commandName)
 	defer span.End()
 	return conn.Do(commandName, args...)
 }
@@ -104,7 +104,22 @@ func DoWithTimeout(ctx context.Context, conn redis.Conn, timeout time.Duration,
 	if spanName == "" {
 		spanName = "(flush pipeline)"
 	}
-	span, _ := apm.StartSpan(ctx, spanName, "db.redis")
+	span := startSpan(ctx, spanName, commandName)
 	defer span.End()
 	return redis.DoWithTimeout(conn, timeout, commandName, args...)
 }
+
+// startSpan starts a span for a redis command. The span action is the
+// lower-cased command name, or "flush" for flushing a pipeline.
+func startSpan(ctx context.Context, name, commandName string) *apm.Span {
+	span, _ := apm.StartSpan(ctx, name, "db.redis")
+	if !span.Dropped() {
+		action := strings.ToLower(commandName)
+		if action == "" {
+			action = "flush"
+		}
+		span.SetTypeSubtypeAction("db", "redis", action)
+		span.Context.SetServiceTarget(apm.ServiceTargetSpanContext{Type: "redis"})
+	}
+	return span
+}
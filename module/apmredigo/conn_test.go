@@ -29,6 +29,7 @@ import (
 
 	"go.elastic.co/apm"
 	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
 	"go.elastic.co/apm/module/apmredigo"
 )
 
@@ -42,6 +43,11 @@ func TestWrap(t *testing.T) {
 	assert.Equal(t, "PING", spans[0].Name)
 	assert.Equal(t, "db", spans[0].Type)
 	assert.Equal(t, "redis", spans[0].Subtype)
+	assert.Equal(t, "ping", spans[0].Action)
+	require.NotNil(t, spans[0].Context)
+	assert.Equal(t, &model.ServiceSpanContext{
+		Target: &model.ServiceTargetSpanContext{Type: "redis"},
+	}, spans[0].Context.Service)
 }
 
 func TestWithContext(t *testing.T) {
@@ -85,6 +91,7 @@ func TestWrapPipeline(t *testing.T) {
 	require.Len(t, spans, 2)
 	assert.Equal(t, "(flush pipeline)", spans[0].Name)
 	assert.Equal(t, "(flush pipeline)", spans[1].Name)
+	assert.Equal(t, "flush", spans[1].Action)
 }
 
 type mockConnWithTimeout struct{ mockConn }
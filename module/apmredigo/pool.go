@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmredigo
+
+import (
+	"context"
+
+	"github.com/gomodule/redigo/redis"
+
+	"go.elastic.co/apm"
+)
+
+// GetConn gets a connection from pool, as in pool.GetContext, reporting
+// the time spent waiting for the connection as a span with the name
+// "acquire". The returned connection is wrapped and bound to ctx, as
+// in Wrap(conn).WithContext(ctx).
+//
+// Acquiring connections is not traced by default due to the overhead
+// of the additional span; GetConn may be used in place of pool.Get
+// when pool contention is suspected, e.g. for pools configured with
+// Wait set to true.
+func GetConn(ctx context.Context, pool *redis.Pool) (Conn, error) {
+	span, spanCtx := apm.StartSpan(ctx, "acquire", "db.redis.acquire")
+	conn, err := pool.GetContext(spanCtx)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(conn).WithContext(ctx), nil
+}
+
+// NewPoolStatsGatherer returns an apm.MetricsGatherer which gathers
+// connection pool metrics from pool.Stats. If name is non-empty, the
+// metrics will be labeled with "db" set to name, for distinguishing
+// multiple connection pools.
+//
+// The following metrics are gathered:
+//
+//   - db.redis.pool.connections.active: number of connections in the pool
+//   - db.redis.pool.connections.idle: number of idle connections in the pool
+//
+// The gatherer should be registered with apm.Tracer.RegisterMetricsGatherer.
+func NewPoolStatsGatherer(pool *redis.Pool, name string) apm.MetricsGatherer {
+	g := poolStatsGatherer{pool: pool}
+	if name != "" {
+		g.labels = []apm.MetricLabel{{Name: "db", Value: name}}
+	}
+	return g
+}
+
+type poolStatsGatherer struct {
+	pool   *redis.Pool
+	labels []apm.MetricLabel
+}
+
+// GatherMetrics gathers connection pool metrics into m.
+func (g poolStatsGatherer) GatherMetrics(ctx context.Context, m *apm.Metrics) error {
+	stats := g.pool.Stats()
+	m.Add("db.redis.pool.connections.active", g.labels, float64(stats.ActiveCount))
+	m.Add("db.redis.pool.connections.idle", g.labels, float64(stats.IdleCount))
+	return nil
+}
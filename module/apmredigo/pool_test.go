@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmredigo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmredigo"
+)
+
+func TestGetConn(t *testing.T) {
+	pool := newMockPool()
+	defer pool.Close()
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		conn, err := apmredigo.GetConn(ctx, pool)
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.Do("PING", "hello, world!")
+	})
+	require.Len(t, spans, 2)
+	assert.Equal(t, "acquire", spans[0].Name)
+	assert.Equal(t, "db", spans[0].Type)
+	assert.Equal(t, "redis", spans[0].Subtype)
+	assert.Equal(t, "acquire", spans[0].Action)
+	assert.Equal(t, "PING", spans[1].Name)
+	assert.Equal(t, spans[0].ParentID, spans[1].ParentID)
+}
+
+func TestPoolStatsGatherer(t *testing.T) {
+	pool := newMockPool()
+	defer pool.Close()
+	conn := pool.Get()
+	defer conn.Close()
+
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.RegisterMetricsGatherer(apmredigo.NewPoolStatsGatherer(pool, "cache"))
+	tracer.SendMetrics(nil)
+
+	var poolMetrics *model.Metrics
+	metrics := tracer.Payloads().Metrics
+	for i := range metrics {
+		if len(metrics[i].Labels) != 0 {
+			poolMetrics = &metrics[i]
+		}
+	}
+	require.NotNil(t, poolMetrics)
+	assert.Equal(t, model.StringMap{{Key: "db", Value: "cache"}}, poolMetrics.Labels)
+	assert.Equal(t, map[string]model.Metric{
+		"db.redis.pool.connections.active": {Value: 1},
+		"db.redis.pool.connections.idle":   {Value: 0},
+	}, poolMetrics.Samples)
+}
+
+func newMockPool() *redis.Pool {
+	return &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return pooledMockConn{}, nil
+		},
+	}
+}
+
+// pooledMockConn is a mockConn which may be closed,
+// for returning connections to a redis.Pool.
+type pooledMockConn struct{ mockConn }
+
+func (pooledMockConn) Close() error {
+	return nil
+}
+
+func (pooledMockConn) Err() error {
+	return nil
+}
@@ -82,7 +82,7 @@ func (f *filter) filter(req *restful.Request, resp *restful.Response, chain *res
 			if httpResp.StatusCode == 0 {
 				w.WriteHeader(http.StatusInternalServerError)
 			}
-			e := f.tracer.Recovered(v)
+			e := apmhttp.RecoveredError(f.tracer, v)
 			e.SetTransaction(tx)
 			apmhttp.SetContext(&e.Context, req.Request, httpResp, body)
 			e.Context.SetFramework(frameworkName, frameworkVersion)
@@ -22,11 +22,13 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"testing"
+	"time"
 
 	sqlite3 "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"go.elastic.co/apm"
 	"go.elastic.co/apm/apmtest"
 	"go.elastic.co/apm/model"
 	"go.elastic.co/apm/module/apmsql"
@@ -35,6 +37,14 @@ import (
 
 func init() {
 	apmsql.Register("sqlite3_test", &sqlite3TestDriver{})
+	apmsql.Register("sqlite3_stacktrace_always", &sqlite3.SQLiteDriver{},
+		apmsql.WithDriverName("sqlite3"),
+		apmsql.WithStackTraceMinDuration(0),
+	)
+	apmsql.Register("sqlite3_stacktrace_slow", &sqlite3.SQLiteDriver{},
+		apmsql.WithDriverName("sqlite3"),
+		apmsql.WithStackTraceMinDuration(time.Hour),
+	)
 }
 
 func TestPingContext(t *testing.T) {
@@ -97,6 +107,9 @@ func TestExecContext(t *testing.T) {
 			Statement:    "CREATE TABLE foo (bar INT)",
 			Type:         "sql",
 		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "sqlite3", Name: ":memory:"},
+		},
 	}, spans[0].Context)
 
 	for i := 0; i < N; i++ {
@@ -109,6 +122,9 @@ func TestExecContext(t *testing.T) {
 				Statement:    "INSERT INTO foo VALUES (?)",
 				Type:         "sql",
 			},
+			Service: &model.ServiceSpanContext{
+				Target: &model.ServiceTargetSpanContext{Type: "sqlite3", Name: ":memory:"},
+			},
 		}, span.Context)
 	}
 
@@ -120,6 +136,9 @@ func TestExecContext(t *testing.T) {
 			Statement:    "DELETE FROM foo",
 			Type:         "sql",
 		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "sqlite3", Name: ":memory:"},
+		},
 	}, spans[N+1].Context)
 }
 
@@ -150,6 +169,9 @@ func TestQueryContext(t *testing.T) {
 			Statement: "SELECT * FROM foo",
 			Type:      "sql",
 		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "sqlite3", Name: ":memory:"},
+		},
 	}, spans[0].Context)
 }
 
@@ -314,6 +336,44 @@ func TestContextCanceled(t *testing.T) {
 	assert.Len(t, errors, 0) // no "context canceled" errors reported
 }
 
+func TestStackTraceMinDuration(t *testing.T) {
+	// Stack traces are captured for all spans by default,
+	// and for none by the sqlite3_stacktrace_slow driver.
+	spans := testStackTraceMinDuration(t, "sqlite3", 0)
+	assert.NotEmpty(t, spans[0].Stacktrace)
+	spans = testStackTraceMinDuration(t, "sqlite3_stacktrace_slow", 0)
+	assert.Empty(t, spans[0].Stacktrace)
+
+	// Stack traces are captured for no spans by default,
+	// and for all by the sqlite3_stacktrace_always driver.
+	spans = testStackTraceMinDuration(t, "sqlite3", time.Hour)
+	assert.Empty(t, spans[0].Stacktrace)
+	spans = testStackTraceMinDuration(t, "sqlite3_stacktrace_always", time.Hour)
+	assert.NotEmpty(t, spans[0].Stacktrace)
+}
+
+func testStackTraceMinDuration(t *testing.T, driverName string, tracerMinDuration time.Duration) []model.Span {
+	db, err := apmsql.Open(driverName, ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.Ping() // connect
+
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.SetSpanFramesMinDuration(tracerMinDuration)
+
+	tx := tracer.StartTransaction("name", "type")
+	ctx := apm.ContextWithTransaction(context.Background(), tx)
+	_, err = db.ExecContext(ctx, "SELECT 1")
+	require.NoError(t, err)
+	tx.End()
+	tracer.Flush(nil)
+
+	spans := tracer.Payloads().Spans
+	require.Len(t, spans, 1)
+	return spans
+}
+
 type sqlite3TestDriver struct {
 	sqlite3.SQLiteDriver
 }
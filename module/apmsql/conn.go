@@ -57,6 +57,15 @@ type conn struct {
 	execer             driver.Execer
 	execerContext      driver.ExecerContext
 	connBeginTx        driver.ConnBeginTx
+
+	// sessionTraceID holds the trace ID last set in the session
+	// variable configured with WithSessionTraceTag. If the last
+	// attempt to set the variable failed with a transient error,
+	// sessionTraceIDUnknown is set so that it is set again on the
+	// next use of the connection.
+	sessionTraceID        apm.TraceID
+	sessionTraceIDUnknown bool
+	sessionTraceTagFailed bool
 }
 
 func (c *conn) startStmtSpan(ctx context.Context, stmt, spanType string) (*apm.Span, context.Context) {
@@ -64,7 +73,7 @@ func (c *conn) startStmtSpan(ctx context.Context, stmt, spanType string) (*apm.S
 }
 
 func (c *conn) startSpan(ctx context.Context, name, spanType, stmt string) (*apm.Span, context.Context) {
-	span, ctx := apm.StartSpan(ctx, name, spanType)
+	span, ctx := c.driver.startSpan(ctx, name, spanType)
 	if !span.Dropped() {
 		if c.dsnInfo.Address != "" {
 			span.Context.SetDestinationAddress(c.dsnInfo.Address, c.dsnInfo.Port)
@@ -79,6 +88,10 @@ func (c *conn) startSpan(ctx context.Context, name, spanType, stmt string) (*apm
 			Type:      "sql",
 			User:      c.dsnInfo.User,
 		})
+		span.Context.SetServiceTarget(apm.ServiceTargetSpanContext{
+			Type: c.driver.driverName,
+			Name: c.dsnInfo.Database,
+		})
 	}
 	return span, ctx
 }
@@ -128,8 +141,10 @@ func (c *conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 	if c.queryerContext == nil && c.queryer == nil {
 		return nil, driver.ErrSkip
 	}
+	c.setSessionTraceTag(ctx)
 	span, ctx := c.startStmtSpan(ctx, query, c.driver.querySpanType)
 	defer c.finishSpan(ctx, span, nil, &resultError)
+	query = c.driver.commentStatement(ctx, span, query)
 
 	if c.queryerContext != nil {
 		return c.queryerContext.QueryContext(ctx, query, args)
@@ -151,6 +166,7 @@ func (*conn) Query(query string, args []driver.Value) (driver.Rows, error) {
 }
 
 func (c *conn) PrepareContext(ctx context.Context, query string) (_ driver.Stmt, resultError error) {
+	c.setSessionTraceTag(ctx)
 	span, ctx := c.startStmtSpan(ctx, query, c.driver.prepareSpanType)
 	defer c.finishSpan(ctx, span, nil, &resultError)
 	var stmt driver.Stmt
@@ -178,8 +194,10 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 	if c.execerContext == nil && c.execer == nil {
 		return nil, driver.ErrSkip
 	}
+	c.setSessionTraceTag(ctx)
 	span, ctx := c.startStmtSpan(ctx, query, c.driver.execSpanType)
 	defer c.finishSpan(ctx, span, &result, &resultError)
+	query = c.driver.commentStatement(ctx, span, query)
 
 	if c.execerContext != nil {
 		return c.execerContext.ExecContext(ctx, query, args)
@@ -211,5 +229,6 @@ type connBeginTx struct {
 
 func (c *connBeginTx) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
 	// TODO(axw) instrument commit/rollback?
+	c.setSessionTraceTag(ctx)
 	return c.connBeginTx.BeginTx(ctx, opts)
 }
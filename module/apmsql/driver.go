@@ -18,11 +18,14 @@
 package apmsql
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
 	"sync"
+	"time"
 
+	"go.elastic.co/apm"
 	"go.elastic.co/apm/internal/sqlutil"
 )
 
@@ -123,10 +126,40 @@ func WithDSNParser(f DSNParserFunc) WrapOption {
 	}
 }
 
+// WithStackTraceMinDuration returns a WrapOption which sets the minimum
+// duration of SQL spans for which stack traces are captured, overriding
+// the tracer's span frames minimum duration (ELASTIC_APM_SPAN_FRAMES_MIN_DURATION)
+// for spans created by the wrapped driver only. For example, stack traces
+// may be captured for queries slower than 100ms, to find the code issuing
+// slow queries, without capturing them for fast queries.
+func WithStackTraceMinDuration(d time.Duration) WrapOption {
+	return func(drv *tracingDriver) {
+		drv.stackTraceMinDuration = d
+		drv.stackTraceMinDurationSet = true
+	}
+}
+
+// startSpan starts a span with the given name and type, applying the
+// driver's stack trace minimum duration, if any.
+func (d *tracingDriver) startSpan(ctx context.Context, name, spanType string) (*apm.Span, context.Context) {
+	span, ctx := apm.StartSpan(ctx, name, spanType)
+	if d.stackTraceMinDurationSet {
+		span.SetStackFramesMinDuration(d.stackTraceMinDuration)
+	}
+	return span, ctx
+}
+
 type tracingDriver struct {
 	driver.Driver
-	driverName string
-	dsnParser  DSNParserFunc
+	driverName      string
+	dsnParser       DSNParserFunc
+	sqlCommenter    bool
+	sessionTraceTag string
+
+	// stackTraceMinDuration, if stackTraceMinDurationSet is true,
+	// overrides the tracer's span frames minimum duration for spans.
+	stackTraceMinDuration    time.Duration
+	stackTraceMinDurationSet bool
 
 	connectSpanType string
 	execSpanType    string
@@ -47,7 +47,7 @@ type driverConnector struct {
 }
 
 func (d *driverConnector) Connect(ctx context.Context) (driver.Conn, error) {
-	span, ctx := apm.StartSpan(ctx, "connect", d.driver.connectSpanType)
+	span, ctx := d.driver.startSpan(ctx, "connect", d.driver.connectSpanType)
 	defer span.End()
 	dsnInfo := d.driver.dsnParser(d.name)
 	if !span.Dropped() {
@@ -71,5 +71,8 @@ func TestQueryContext(t *testing.T) {
 			Type:      "sql",
 			User:      "root",
 		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "mysql", Name: "test_db"},
+		},
 	}, spans[0].Context)
 }
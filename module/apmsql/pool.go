@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build go1.11
+
+package apmsql
+
+import (
+	"context"
+	"database/sql"
+
+	"go.elastic.co/apm"
+)
+
+// AcquireConn acquires a connection from db's connection pool, as in
+// db.Conn, reporting the time spent waiting for the connection as a
+// span with the name "acquire".
+//
+// Operations performed with database/sql.DB acquire a connection
+// implicitly, so the time spent waiting for an available connection
+// is otherwise included in the operations' spans. AcquireConn may be
+// used to separate pool contention from query latency, at the cost of
+// an additional span; callers are responsible for closing the returned
+// connection.
+func AcquireConn(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	spanType := "db.sql.acquire"
+	if d, ok := db.Driver().(*tracingDriver); ok {
+		spanType = d.formatSpanType("acquire")
+	}
+	span, ctx := apm.StartSpan(ctx, "acquire", spanType)
+	defer span.End()
+	return db.Conn(ctx)
+}
+
+// NewPoolStatsGatherer returns an apm.MetricsGatherer which gathers
+// connection pool metrics from db.Stats. If name is non-empty, the
+// metrics will be labeled with "db" set to name, for distinguishing
+// multiple connection pools.
+//
+// The following metrics are gathered:
+//
+//   - db.sql.pool.connections.max_open: maximum number of open connections
+//   - db.sql.pool.connections.open: number of open connections
+//   - db.sql.pool.connections.in_use: number of connections in use
+//   - db.sql.pool.connections.idle: number of idle connections
+//   - db.sql.pool.wait.count: total number of connections waited for
+//   - db.sql.pool.wait.duration.us: total time spent waiting for connections
+//
+// The gatherer should be registered with apm.Tracer.RegisterMetricsGatherer.
+func NewPoolStatsGatherer(db *sql.DB, name string) apm.MetricsGatherer {
+	g := poolStatsGatherer{db: db}
+	if name != "" {
+		g.labels = []apm.MetricLabel{{Name: "db", Value: name}}
+	}
+	return g
+}
+
+type poolStatsGatherer struct {
+	db     *sql.DB
+	labels []apm.MetricLabel
+}
+
+// GatherMetrics gathers connection pool metrics into m.
+func (g poolStatsGatherer) GatherMetrics(ctx context.Context, m *apm.Metrics) error {
+	stats := g.db.Stats()
+	m.Add("db.sql.pool.connections.max_open", g.labels, float64(stats.MaxOpenConnections))
+	m.Add("db.sql.pool.connections.open", g.labels, float64(stats.OpenConnections))
+	m.Add("db.sql.pool.connections.in_use", g.labels, float64(stats.InUse))
+	m.Add("db.sql.pool.connections.idle", g.labels, float64(stats.Idle))
+	m.Add("db.sql.pool.wait.count", g.labels, float64(stats.WaitCount))
+	m.Add("db.sql.pool.wait.duration.us", g.labels, float64(stats.WaitDuration.Nanoseconds())/1e3)
+	return nil
+}
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build go1.11
+
+package apmsql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmsql"
+)
+
+func TestAcquireConn(t *testing.T) {
+	db, err := apmsql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		conn, err := apmsql.AcquireConn(ctx, db)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.NoError(t, conn.PingContext(ctx))
+	})
+	require.Len(t, spans, 3)
+	assert.Equal(t, "connect", spans[0].Name)
+	assert.Equal(t, "acquire", spans[1].Name)
+	assert.Equal(t, "db", spans[1].Type)
+	assert.Equal(t, "sqlite3", spans[1].Subtype)
+	assert.Equal(t, "acquire", spans[1].Action)
+	assert.Equal(t, "ping", spans[2].Name)
+}
+
+func TestPoolStatsGatherer(t *testing.T) {
+	db, err := apmsql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(5)
+
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.RegisterMetricsGatherer(apmsql.NewPoolStatsGatherer(db, "main"))
+	tracer.SendMetrics(nil)
+
+	var poolMetrics *model.Metrics
+	metrics := tracer.Payloads().Metrics
+	for i := range metrics {
+		if len(metrics[i].Labels) != 0 {
+			poolMetrics = &metrics[i]
+		}
+	}
+	require.NotNil(t, poolMetrics)
+	assert.Equal(t, model.StringMap{{Key: "db", Value: "main"}}, poolMetrics.Labels)
+	assert.Equal(t, map[string]model.Metric{
+		"db.sql.pool.connections.max_open": {Value: 5},
+		"db.sql.pool.connections.open":     {Value: 1},
+		"db.sql.pool.connections.in_use":   {Value: 1},
+		"db.sql.pool.connections.idle":     {Value: 0},
+		"db.sql.pool.wait.count":           {Value: 0},
+		"db.sql.pool.wait.duration.us":     {Value: 0},
+	}, poolMetrics.Samples)
+}
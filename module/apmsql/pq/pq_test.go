@@ -69,5 +69,8 @@ func TestQueryContext(t *testing.T) {
 			Type:      "sql",
 			User:      "postgres",
 		},
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "postgresql", Name: "test_db"},
+		},
 	}, spans[0].Context)
 }
@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+
+	"go.elastic.co/apm"
+)
+
+var sessionVarNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// WithSessionTraceTag returns a WrapOption which enables setting a session
+// variable with the given name to the current trace ID on connections used
+// within a transaction, so that active queries can be correlated with traces
+// in server-side monitoring, such as PostgreSQL's pg_stat_activity.
+//
+// The variable is set before the first operation performed on a connection
+// within a trace, i.e. when a connection is acquired from the pool for use
+// in a different trace, and is cleared when the connection is next used
+// outside of a transaction. The following drivers are supported:
+//
+//   - postgresql: varName is set as a configuration parameter with set_config.
+//     This may be a built-in parameter such as "application_name", or a custom
+//     parameter with a prefix, such as "apm.trace_id".
+//   - mysql: varName is set as the user-defined variable @varName.
+//
+// WithSessionTraceTag has no effect for other drivers. If setting the variable
+// fails, the error is ignored. If the failure is due to context cancellation or
+// a bad connection, the variable will be set again on the next use of the
+// connection; otherwise no further attempts are made to set it on the connection.
+//
+// WithSessionTraceTag panics if varName is not a valid variable name.
+func WithSessionTraceTag(varName string) WrapOption {
+	if !sessionVarNameRegexp.MatchString(varName) {
+		panic(fmt.Sprintf("invalid session variable name %q", varName))
+	}
+	return func(d *tracingDriver) {
+		d.sessionTraceTag = varName
+	}
+}
+
+// sessionTraceTagStatement returns the statement for setting the
+// session trace tag variable to value, or the empty string if the
+// driver does not support session trace tags.
+func (d *tracingDriver) sessionTraceTagStatement(value string) string {
+	switch d.driverName {
+	case "postgresql":
+		return fmt.Sprintf("SELECT set_config('%s', '%s', false)", d.sessionTraceTag, value)
+	case "mysql":
+		return fmt.Sprintf("SET @%s = '%s'", d.sessionTraceTag, value)
+	}
+	return ""
+}
+
+// setSessionTraceTag sets the session trace tag variable to the ID of
+// the trace in ctx, if enabled and it differs from the value last set
+// on the connection.
+func (c *conn) setSessionTraceTag(ctx context.Context) {
+	if c.driver.sessionTraceTag == "" || c.sessionTraceTagFailed {
+		return
+	}
+	var traceID apm.TraceID
+	if tx := apm.TransactionFromContext(ctx); tx != nil {
+		traceID = tx.TraceContext().Trace
+	}
+	if traceID == c.sessionTraceID && !c.sessionTraceIDUnknown {
+		return
+	}
+	var value string
+	if traceID.Validate() == nil {
+		value = traceID.String()
+	}
+	stmt := c.driver.sessionTraceTagStatement(value)
+	if stmt == "" {
+		c.sessionTraceTagFailed = true
+		return
+	}
+	var err error
+	switch {
+	case c.execerContext != nil:
+		_, err = c.execerContext.ExecContext(ctx, stmt, nil)
+	case c.execer != nil:
+		_, err = c.execer.Exec(stmt, nil)
+	default:
+		err = driver.ErrSkip
+	}
+	if err != nil {
+		if isTransientError(ctx, err) {
+			// The variable may hold a stale value; reset
+			// the trace ID so it is set on the next use.
+			c.sessionTraceID = apm.TraceID{}
+			c.sessionTraceIDUnknown = true
+		} else {
+			// The statement is unsupported by the database,
+			// e.g. due to a syntax error; stop trying.
+			c.sessionTraceTagFailed = true
+		}
+		return
+	}
+	c.sessionTraceID = traceID
+	c.sessionTraceIDUnknown = false
+}
+
+// isTransientError reports whether err, returned by an operation
+// performed with ctx, may not recur if the operation is retried.
+func isTransientError(ctx context.Context, err error) bool {
+	switch err {
+	case context.Canceled, context.DeadlineExceeded, driver.ErrBadConn:
+		return true
+	}
+	return ctx.Err() != nil
+}
@@ -0,0 +1,160 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmsql_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmsql"
+)
+
+func init() {
+	apmsql.Register("sqlite3_session_postgresql", &sqlite3RecordingDriver{},
+		apmsql.WithDriverName("postgresql"),
+		apmsql.WithSessionTraceTag("apm.trace_id"),
+	)
+	apmsql.Register("sqlite3_session_mysql", &sqlite3RecordingDriver{},
+		apmsql.WithDriverName("mysql"),
+		apmsql.WithSessionTraceTag("apm_trace_id"),
+	)
+	apmsql.Register("sqlite3_session_unsupported", &sqlite3RecordingDriver{},
+		apmsql.WithDriverName("sqlite3"),
+		apmsql.WithSessionTraceTag("apm_trace_id"),
+	)
+}
+
+func TestSessionTraceTagPostgreSQL(t *testing.T) {
+	testSessionTraceTag(t, "sqlite3_session_postgresql", func(traceID string) string {
+		return fmt.Sprintf("SELECT set_config('apm.trace_id', '%s', false)", traceID)
+	})
+}
+
+func TestSessionTraceTagMySQL(t *testing.T) {
+	testSessionTraceTag(t, "sqlite3_session_mysql", func(traceID string) string {
+		return fmt.Sprintf("SET @apm_trace_id = '%s'", traceID)
+	})
+}
+
+func testSessionTraceTag(t *testing.T, driverName string, setStatement func(traceID string) string) {
+	db, err := apmsql.Open(driverName, ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	db.Ping() // connect
+
+	recordedQueries.reset()
+	var traceIDs []model.TraceID
+	for i := 0; i < 2; i++ {
+		tx, _, _ := apmtest.WithTransaction(func(ctx context.Context) {
+			// The variable is set only once per trace on a connection.
+			for j := 0; j < 2; j++ {
+				_, err := db.ExecContext(ctx, "SELECT 1")
+				require.NoError(t, err)
+			}
+		})
+		traceIDs = append(traceIDs, tx.TraceID)
+	}
+	// The variable is cleared when the connection is next used outside a transaction.
+	_, err = db.Exec("SELECT 2")
+	require.NoError(t, err)
+
+	traceID := func(id model.TraceID) string { return fmt.Sprintf("%x", id[:]) }
+	assert.Equal(t, []string{
+		setStatement(traceID(traceIDs[0])), "SELECT 1", "SELECT 1",
+		setStatement(traceID(traceIDs[1])), "SELECT 1", "SELECT 1",
+		setStatement(""), "SELECT 2",
+	}, recordedQueries.get())
+}
+
+func TestSessionTraceTagUnsupported(t *testing.T) {
+	db, err := apmsql.Open("sqlite3_session_unsupported", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.Ping() // connect
+
+	recordedQueries.reset()
+	apmtest.WithTransaction(func(ctx context.Context) {
+		_, err := db.ExecContext(ctx, "SELECT 1")
+		require.NoError(t, err)
+	})
+	assert.Equal(t, []string{"SELECT 1"}, recordedQueries.get())
+}
+
+func TestSessionTraceTagTransientError(t *testing.T) {
+	db, err := apmsql.Open("sqlite3_session_mysql", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	db.Ping() // connect
+
+	recordedQueries.reset()
+	recordedQueries.failSessionStatements(context.DeadlineExceeded)
+	defer recordedQueries.failSessionStatements()
+	tx, _, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		// The variable is set again after a transient error.
+		for j := 0; j < 3; j++ {
+			_, err := db.ExecContext(ctx, "SELECT 1")
+			require.NoError(t, err)
+		}
+	})
+
+	setStatement := fmt.Sprintf("SET @apm_trace_id = '%x'", tx.TraceID[:])
+	assert.Equal(t, []string{
+		setStatement, "SELECT 1",
+		setStatement, "SELECT 1",
+		"SELECT 1",
+	}, recordedQueries.get())
+}
+
+func TestSessionTraceTagUnsupportedStatement(t *testing.T) {
+	db, err := apmsql.Open("sqlite3_session_mysql", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	db.Ping() // connect
+
+	recordedQueries.reset()
+	recordedQueries.failSessionStatements(errors.New("syntax error"))
+	defer recordedQueries.failSessionStatements()
+	for i := 0; i < 2; i++ {
+		apmtest.WithTransaction(func(ctx context.Context) {
+			_, err := db.ExecContext(ctx, "SELECT 1")
+			require.NoError(t, err)
+		})
+	}
+
+	// No further attempts are made after the statement fails.
+	queries := recordedQueries.get()
+	require.Len(t, queries, 3)
+	assert.Regexp(t, "^SET @apm_trace_id = ", queries[0])
+	assert.Equal(t, []string{"SELECT 1", "SELECT 1"}, queries[1:])
+}
+
+func TestSessionTraceTagInvalidName(t *testing.T) {
+	for _, name := range []string{"", "foo bar", "foo'", "1foo", "a.b.c"} {
+		assert.Panics(t, func() { apmsql.WithSessionTraceTag(name) }, name)
+	}
+}
@@ -0,0 +1,85 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmsql
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"go.elastic.co/apm"
+)
+
+// WithSQLCommenter returns a WrapOption which enables appending a
+// sqlcommenter-style comment to statements executed and queried via
+// the wrapped driver, so that queries recorded in the database's own
+// logs (e.g. slow query logs or pg_stat_statements) can be correlated
+// with the trace that issued them. For example:
+//
+//	SELECT * FROM foo /*traceparent='00-<trace-id>-<span-id>-01'*/
+//
+// Comments are only added for statements executed within a transaction,
+// and never for prepared statements, which may be reused across traces.
+// Statements which already contain a comment are left unmodified. The
+// statement recorded in the span does not include the comment.
+//
+// WithSQLCommenter should only be used with drivers and databases which
+// accept trailing comments in statements.
+func WithSQLCommenter() WrapOption {
+	return func(d *tracingDriver) {
+		d.sqlCommenter = true
+	}
+}
+
+// commentStatement returns stmt with a sqlcommenter-style comment
+// appended, if the driver was wrapped with WithSQLCommenter and it
+// is safe to do so; otherwise stmt is returned unmodified.
+func (d *tracingDriver) commentStatement(ctx context.Context, span *apm.Span, stmt string) string {
+	if !d.sqlCommenter {
+		return stmt
+	}
+	tx := apm.TransactionFromContext(ctx)
+	if tx == nil || strings.Contains(stmt, "/*") || strings.Contains(stmt, "--") {
+		return stmt
+	}
+	// Only the trace context is included: it is immutable, so unlike
+	// the transaction's name it may be read at any time, including
+	// after the transaction has ended.
+	traceContext := tx.TraceContext()
+	if !span.Dropped() {
+		traceContext = span.TraceContext()
+	}
+	carrier := make(apm.SpanContextCarrier, 1)
+	carrier.Inject(traceContext)
+	traceparent := carrier[apm.SpanContextCarrierTraceparentKey]
+
+	var buf strings.Builder
+	trimmed := strings.TrimRight(stmt, " \t\r\n")
+	semicolon := strings.HasSuffix(trimmed, ";")
+	if semicolon {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	buf.WriteString(trimmed)
+	buf.WriteString(" /*traceparent='")
+	buf.WriteString(url.PathEscape(traceparent))
+	buf.WriteString("'*/")
+	if semicolon {
+		buf.WriteByte(';')
+	}
+	return buf.String()
+}
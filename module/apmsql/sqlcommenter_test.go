@@ -0,0 +1,210 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmsql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/module/apmsql"
+)
+
+func init() {
+	apmsql.Register("sqlite3_commenter", &sqlite3RecordingDriver{},
+		apmsql.WithDriverName("sqlite3"),
+		apmsql.WithSQLCommenter(),
+	)
+}
+
+func TestSQLCommenter(t *testing.T) {
+	db, err := apmsql.Open("sqlite3_commenter", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.Ping() // connect
+
+	recordedQueries.reset()
+	tx, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		_, err := db.ExecContext(ctx, "CREATE TABLE foo (bar INT);")
+		require.NoError(t, err)
+		rows, err := db.QueryContext(ctx, "SELECT * FROM foo")
+		require.NoError(t, err)
+		rows.Close()
+	})
+	require.Len(t, spans, 2)
+
+	traceparent := func(spanID [8]byte) string {
+		return fmt.Sprintf("00-%x-%x-01", tx.TraceID, spanID)
+	}
+	assert.Equal(t, []string{
+		"CREATE TABLE foo (bar INT) /*traceparent='" + traceparent(spans[0].ID) + "'*/;",
+		"SELECT * FROM foo /*traceparent='" + traceparent(spans[1].ID) + "'*/",
+	}, recordedQueries.get())
+
+	// The statements recorded in the spans do not include the comment.
+	assert.Equal(t, "CREATE TABLE foo (bar INT);", spans[0].Context.Database.Statement)
+	assert.Equal(t, "SELECT * FROM foo", spans[1].Context.Database.Statement)
+}
+
+func TestSQLCommenterEndedTransaction(t *testing.T) {
+	db, err := apmsql.Open("sqlite3_commenter", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.Ping() // connect
+
+	// Statements may be executed with a context whose
+	// transaction has already ended, e.g. by a goroutine
+	// which outlives the request.
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tx := tracer.StartTransaction("name", "type")
+	ctx := apm.ContextWithTransaction(context.Background(), tx)
+	traceID := tx.TraceContext().Trace
+	tx.End()
+
+	recordedQueries.reset()
+	_, err = db.ExecContext(ctx, "CREATE TABLE foo (bar INT)")
+	require.NoError(t, err)
+	queries := recordedQueries.get()
+	require.Len(t, queries, 1)
+	assert.Contains(t, queries[0], "/*traceparent='00-"+traceID.String()+"-")
+}
+
+func TestSQLCommenterSkipped(t *testing.T) {
+	db, err := apmsql.Open("sqlite3_commenter", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.Ping() // connect
+
+	// No comment is added outside of a transaction.
+	recordedQueries.reset()
+	_, err = db.Exec("CREATE TABLE foo (bar INT)")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CREATE TABLE foo (bar INT)"}, recordedQueries.get())
+
+	// No comment is added to statements which already contain a comment,
+	// or to prepared statements.
+	recordedQueries.reset()
+	apmtest.WithTransaction(func(ctx context.Context) {
+		_, err := db.ExecContext(ctx, "INSERT INTO foo VALUES (1) /* existing */")
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx, "INSERT INTO foo VALUES (2) -- existing")
+		require.NoError(t, err)
+		stmt, err := db.PrepareContext(ctx, "INSERT INTO foo VALUES (?)")
+		require.NoError(t, err)
+		defer stmt.Close()
+		_, err = stmt.ExecContext(ctx, 3)
+		require.NoError(t, err)
+	})
+	assert.Equal(t, []string{
+		"INSERT INTO foo VALUES (1) /* existing */",
+		"INSERT INTO foo VALUES (2) -- existing",
+	}, recordedQueries.get())
+}
+
+var recordedQueries queryRecorder
+
+type queryRecorder struct {
+	mu      sync.Mutex
+	queries []string
+
+	// sessionErrs holds errors to return, in order, for
+	// session variable statements.
+	sessionErrs []error
+}
+
+func (r *queryRecorder) failSessionStatements(errs ...error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessionErrs = errs
+}
+
+func (r *queryRecorder) sessionStatementError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.sessionErrs) == 0 {
+		return nil
+	}
+	err := r.sessionErrs[0]
+	r.sessionErrs = r.sessionErrs[1:]
+	return err
+}
+
+func (r *queryRecorder) record(query string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = append(r.queries, query)
+}
+
+func (r *queryRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = nil
+}
+
+func (r *queryRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.queries...)
+}
+
+// sqlite3RecordingDriver is a sqlite3 driver which records the
+// statements passed to QueryContext and ExecContext.
+type sqlite3RecordingDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *sqlite3RecordingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return conn, err
+	}
+	return sqlite3RecordingConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type sqlite3RecordingConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c sqlite3RecordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	recordedQueries.record(query)
+	return c.SQLiteConn.QueryContext(ctx, query, args)
+}
+
+func (c sqlite3RecordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	recordedQueries.record(query)
+	if strings.HasPrefix(query, "SELECT set_config(") || strings.HasPrefix(query, "SET @") {
+		// Session variable statements issued for WithSessionTraceTag
+		// are not supported by sqlite3; pretend they succeeded,
+		// unless the test has configured them to fail.
+		if err := recordedQueries.sessionStatementError(); err != nil {
+			return nil, err
+		}
+		return driver.ResultNoRows, nil
+	}
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmtemporal
+
+import (
+	"context"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+
+	"go.elastic.co/apm"
+)
+
+// InterceptActivity returns an interceptor.ActivityInboundInterceptor
+// which traces activity executions as transactions.
+func (i *apmInterceptor) InterceptActivity(
+	ctx context.Context,
+	next interceptor.ActivityInboundInterceptor,
+) interceptor.ActivityInboundInterceptor {
+	return &activityInboundInterceptor{
+		ActivityInboundInterceptorBase: interceptor.ActivityInboundInterceptorBase{Next: next},
+		tracer:                         i.tracer,
+	}
+}
+
+type activityInboundInterceptor struct {
+	interceptor.ActivityInboundInterceptorBase
+	tracer *apm.Tracer
+}
+
+func (a *activityInboundInterceptor) ExecuteActivity(
+	ctx context.Context,
+	in *interceptor.ExecuteActivityInput,
+) (interface{}, error) {
+	if !a.tracer.Recording() {
+		return a.Next.ExecuteActivity(ctx, in)
+	}
+	info := activity.GetInfo(ctx)
+	var opts apm.TransactionOptions
+	opts.TraceContext, _ = readTraceContext(interceptor.Header(ctx))
+	tx := a.tracer.StartTransactionOptions(info.ActivityType.Name, "temporal.activity", opts)
+	defer tx.End()
+	tx.Context.SetLabel("workflow_id", info.WorkflowExecution.ID)
+	tx.Context.SetLabel("run_id", info.WorkflowExecution.RunID)
+	tx.Context.SetLabel("activity_id", info.ActivityID)
+	tx.Context.SetLabel("attempt", int(info.Attempt))
+
+	ctx = apm.ContextWithTransaction(ctx, tx)
+	result, err := a.Next.ExecuteActivity(ctx, in)
+	setTransactionResult(a.tracer, tx, err)
+	return result, err
+}
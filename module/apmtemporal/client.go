@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmtemporal
+
+import (
+	"context"
+
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptor"
+
+	"go.elastic.co/apm"
+)
+
+// InterceptClient returns an interceptor.ClientOutboundInterceptor which traces
+// workflows started by the client, propagating trace context to
+// the workflow execution.
+func (i *apmInterceptor) InterceptClient(next interceptor.ClientOutboundInterceptor) interceptor.ClientOutboundInterceptor {
+	return &clientOutboundInterceptor{
+		ClientOutboundInterceptorBase: interceptor.ClientOutboundInterceptorBase{Next: next},
+	}
+}
+
+type clientOutboundInterceptor struct {
+	interceptor.ClientOutboundInterceptorBase
+}
+
+func (c *clientOutboundInterceptor) ExecuteWorkflow(
+	ctx context.Context,
+	in *interceptor.ClientExecuteWorkflowInput,
+) (client.WorkflowRun, error) {
+	span := startClientSpan(ctx, "StartWorkflow "+in.WorkflowType, in.Options)
+	defer span.End()
+	return c.Next.ExecuteWorkflow(ctx, in)
+}
+
+func (c *clientOutboundInterceptor) SignalWithStartWorkflow(
+	ctx context.Context,
+	in *interceptor.ClientSignalWithStartWorkflowInput,
+) (client.WorkflowRun, error) {
+	span := startClientSpan(ctx, "SignalWithStartWorkflow "+in.WorkflowType, in.Options)
+	defer span.End()
+	return c.Next.SignalWithStartWorkflow(ctx, in)
+}
+
+// startClientSpan starts a span for starting a workflow, and writes
+// its trace context to the Temporal header in ctx.
+//
+// If ctx does not contain a transaction, the span will be dropped,
+// and no trace context will be propagated.
+func startClientSpan(ctx context.Context, name string, opts *client.StartWorkflowOptions) *apm.Span {
+	span, _ := apm.StartSpan(ctx, name, "external.temporal")
+	if span.Dropped() {
+		return span
+	}
+	if opts != nil && opts.ID != "" {
+		span.Context.SetLabel("workflow_id", opts.ID)
+	}
+	writeTraceContext(interceptor.Header(ctx), span.TraceContext())
+	return span
+}
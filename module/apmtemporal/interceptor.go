@@ -0,0 +1,150 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmtemporal
+
+import (
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/module/apmhttp"
+)
+
+const (
+	// HeaderKey is the key of the Temporal header used for
+	// propagating trace context between clients, workflows,
+	// and activities.
+	HeaderKey = "_elastic-apm-trace-context"
+
+	traceparentKey = "traceparent"
+	tracestateKey  = "tracestate"
+)
+
+// NewInterceptor returns an interceptor.Interceptor that traces
+// Temporal client calls, workflows, and activities.
+//
+// The interceptor must be registered with both the client and the
+// worker, by way of client.Options.Interceptors and
+// worker.Options.Interceptors respectively:
+//
+//   - workflows started with client.Client.ExecuteWorkflow are
+//     traced as "external.temporal" spans, if the context contains
+//     a transaction;
+//   - workflow executions are traced as transactions with the
+//     type "temporal.workflow";
+//   - activity executions are traced as transactions with the
+//     type "temporal.activity".
+//
+// Trace context is propagated through the Temporal headers, so the
+// workflow transactions are children of the client spans, and the
+// activity transactions are children of the workflow transactions.
+//
+// Workflows may be replayed from their history, e.g. when a worker
+// is restarted or a workflow is evicted from its cache. A workflow
+// transaction is reported only by the worker which completes the
+// workflow execution, with the execution's start time. The workflow
+// transaction ID is derived from the run ID, so activities scheduled
+// before and after a replay share the same parent. If the workflow has
+// no incoming trace context, the trace ID is also derived from the run
+// ID. The sampling decision for such a trace is the same for each replay
+// if the tracer's sampler bases its decision on the transaction ID, as
+// the default sampler does.
+//
+// By default, the interceptor will trace with apm.DefaultTracer.
+// Use WithTracer to specify an alternative tracer.
+func NewInterceptor(o ...Option) interceptor.Interceptor {
+	opts := options{tracer: apm.DefaultTracer}
+	for _, o := range o {
+		o(&opts)
+	}
+	return &apmInterceptor{tracer: opts.tracer}
+}
+
+type apmInterceptor struct {
+	interceptor.InterceptorBase
+	tracer *apm.Tracer
+}
+
+// readTraceContext reads the trace context from the given Temporal header.
+func readTraceContext(header map[string]*commonpb.Payload) (apm.TraceContext, bool) {
+	payload := header[HeaderKey]
+	if payload == nil {
+		return apm.TraceContext{}, false
+	}
+	var data map[string]string
+	if err := converter.GetDefaultDataConverter().FromPayload(payload, &data); err != nil {
+		return apm.TraceContext{}, false
+	}
+	traceContext, err := apmhttp.ParseTraceparentHeader(data[traceparentKey])
+	if err != nil {
+		return apm.TraceContext{}, false
+	}
+	if tracestate, ok := data[tracestateKey]; ok {
+		traceContext.State, _ = apmhttp.ParseTracestateHeader(tracestate)
+	}
+	return traceContext, true
+}
+
+// writeTraceContext writes traceContext to the given Temporal header.
+func writeTraceContext(header map[string]*commonpb.Payload, traceContext apm.TraceContext) {
+	if header == nil {
+		return
+	}
+	data := map[string]string{
+		traceparentKey: apmhttp.FormatTraceparentHeader(traceContext),
+	}
+	if tracestate := traceContext.State.String(); tracestate != "" {
+		data[tracestateKey] = tracestate
+	}
+	payload, err := converter.GetDefaultDataConverter().ToPayload(data)
+	if err != nil {
+		return
+	}
+	header[HeaderKey] = payload
+}
+
+func setTransactionResult(tracer *apm.Tracer, tx *apm.Transaction, err error) {
+	if err != nil {
+		e := tracer.NewError(err)
+		e.SetTransaction(tx)
+		e.Send()
+		tx.Result = "error"
+	} else {
+		tx.Result = "success"
+	}
+}
+
+type options struct {
+	tracer *apm.Tracer
+}
+
+// Option sets options for tracing Temporal.
+type Option func(*options)
+
+// WithTracer returns an Option which sets t as the tracer
+// to use for tracing Temporal client calls, workflows, and
+// activities.
+func WithTracer(t *apm.Tracer) Option {
+	if t == nil {
+		panic("t == nil")
+	}
+	return func(o *options) {
+		o.tracer = t
+	}
+}
@@ -0,0 +1,320 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmtemporal_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	taskqueuepb "go.temporal.io/api/taskqueue/v1"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/model"
+	"go.elastic.co/apm/module/apmhttp"
+	"go.elastic.co/apm/module/apmtemporal"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestWorkflowActivity(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{
+			apmtemporal.NewInterceptor(apmtemporal.WithTracer(tracer)),
+		},
+	})
+	env.RegisterWorkflow(greetingWorkflow)
+	env.RegisterActivity(greetingActivity)
+
+	parentTraceContext := apm.TraceContext{
+		Trace:   apm.TraceID{0: 1},
+		Span:    apm.SpanID{0: 2},
+		Options: apm.TraceOptions(0).WithRecorded(true),
+	}
+	env.SetHeader(traceContextHeader(t, parentTraceContext))
+	env.ExecuteWorkflow(greetingWorkflow, "world")
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var greeting string
+	require.NoError(t, env.GetWorkflowResult(&greeting))
+	assert.Equal(t, "hello, world", greeting)
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	activityTx := payloads.Transactions[0]
+	workflowTx := payloads.Transactions[1]
+
+	assert.Equal(t, "greetingWorkflow", workflowTx.Name)
+	assert.Equal(t, "temporal.workflow", workflowTx.Type)
+	assert.Equal(t, "success", workflowTx.Result)
+	assert.Equal(t, model.TraceID(parentTraceContext.Trace), workflowTx.TraceID)
+	assert.Equal(t, model.SpanID(parentTraceContext.Span), workflowTx.ParentID)
+
+	assert.Equal(t, "greetingActivity", activityTx.Name)
+	assert.Equal(t, "temporal.activity", activityTx.Type)
+	assert.Equal(t, "success", activityTx.Result)
+	assert.Equal(t, workflowTx.TraceID, activityTx.TraceID)
+	assert.Equal(t, workflowTx.ID, activityTx.ParentID)
+}
+
+func TestWorkflowRootTraceContext(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{
+			apmtemporal.NewInterceptor(apmtemporal.WithTracer(tracer)),
+		},
+	})
+	env.RegisterWorkflow(greetingWorkflow)
+	env.RegisterActivity(greetingActivity)
+	env.ExecuteWorkflow(greetingWorkflow, "world")
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	activityTx := payloads.Transactions[0]
+	workflowTx := payloads.Transactions[1]
+
+	// The trace ID is derived from the run ID, like the transaction
+	// ID, so that it is the same if the workflow is replayed.
+	var runID string
+	for _, label := range workflowTx.Context.Tags {
+		if label.Key == "run_id" {
+			runID, _ = label.Value.(string)
+		}
+	}
+	require.NotEmpty(t, runID)
+	sum := sha256.Sum256([]byte(runID))
+	var traceID model.TraceID
+	copy(traceID[:], sum[8:])
+	assert.Equal(t, traceID, workflowTx.TraceID)
+	assert.Zero(t, workflowTx.ParentID)
+	require.NotNil(t, workflowTx.SampleRate)
+	assert.Equal(t, 1.0, *workflowTx.SampleRate)
+
+	assert.Equal(t, workflowTx.TraceID, activityTx.TraceID)
+	assert.Equal(t, workflowTx.ID, activityTx.ParentID)
+}
+
+func TestActivityError(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestActivityEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{
+			apmtemporal.NewInterceptor(apmtemporal.WithTracer(tracer)),
+		},
+	})
+	env.RegisterActivity(failingActivity)
+	_, err := env.ExecuteActivity(failingActivity)
+	require.Error(t, err)
+
+	tracer.Flush(nil)
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Errors, 1)
+	assert.Equal(t, "error", payloads.Transactions[0].Result)
+	assert.Equal(t, payloads.Transactions[0].ID, payloads.Errors[0].TransactionID)
+	assert.Equal(t, "boom", payloads.Errors[0].Exception.Message)
+}
+
+func TestWorkflowReplay(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	replayer, err := worker.NewWorkflowReplayerWithOptions(worker.WorkflowReplayerOptions{
+		Interceptors: []interceptor.WorkerInterceptor{
+			apmtemporal.NewInterceptor(apmtemporal.WithTracer(tracer)),
+		},
+	})
+	require.NoError(t, err)
+	replayer.RegisterWorkflow(noopWorkflow)
+	err = replayer.ReplayWorkflowHistory(nil, noopWorkflowHistory())
+	require.NoError(t, err)
+
+	// The workflow execution has already been reported by
+	// the worker which originally executed it.
+	tracer.Flush(nil)
+	assert.Empty(t, transport.Payloads().Transactions)
+}
+
+func TestWorkflowDestroyed(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	// exitInterceptor is registered outside the apmtemporal interceptor,
+	// so exited is closed once the latter's ExecuteWorkflow has returned.
+	exited := make(chan struct{})
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{
+		Interceptors: []interceptor.WorkerInterceptor{
+			&exitInterceptor{exited: exited},
+			apmtemporal.NewInterceptor(apmtemporal.WithTracer(tracer)),
+		},
+	})
+	env.RegisterWorkflow(signalWorkflow)
+
+	// The workflow blocks waiting for a signal until it times out, after
+	// which its coroutine is destroyed, as it would be when the workflow
+	// is evicted from a worker's cache.
+	env.ExecuteWorkflow(signalWorkflow)
+	require.True(t, env.IsWorkflowCompleted())
+	require.Error(t, env.GetWorkflowError())
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for workflow to exit")
+	}
+
+	// The workflow did not complete, so its transaction is discarded
+	// rather than reported with a partial duration.
+	tracer.Flush(nil)
+	assert.Empty(t, transport.Payloads().Transactions)
+}
+
+type exitInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	exited chan struct{}
+}
+
+func (i *exitInterceptor) InterceptWorkflow(
+	ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor,
+) interceptor.WorkflowInboundInterceptor {
+	return &exitWorkflowInterceptor{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		exited:                         i.exited,
+	}
+}
+
+type exitWorkflowInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	exited chan struct{}
+}
+
+func (w *exitWorkflowInterceptor) ExecuteWorkflow(
+	ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput,
+) (interface{}, error) {
+	defer close(w.exited)
+	return w.Next.ExecuteWorkflow(ctx, in)
+}
+
+func greetingWorkflow(ctx workflow.Context, name string) (string, error) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute,
+	})
+	var greeting string
+	err := workflow.ExecuteActivity(ctx, greetingActivity, name).Get(ctx, &greeting)
+	return greeting, err
+}
+
+func greetingActivity(ctx context.Context, name string) (string, error) {
+	if apm.TransactionFromContext(ctx) == nil {
+		return "", errors.New("missing transaction")
+	}
+	return "hello, " + name, nil
+}
+
+func failingActivity(ctx context.Context) error {
+	return errors.New("boom")
+}
+
+func noopWorkflow(ctx workflow.Context) error {
+	return nil
+}
+
+func signalWorkflow(ctx workflow.Context) error {
+	workflow.GetSignalChannel(ctx, "signal").Receive(ctx, nil)
+	return nil
+}
+
+func traceContextHeader(t *testing.T, traceContext apm.TraceContext) *commonpb.Header {
+	payload, err := converter.GetDefaultDataConverter().ToPayload(map[string]string{
+		"traceparent": apmhttp.FormatTraceparentHeader(traceContext),
+	})
+	require.NoError(t, err)
+	return &commonpb.Header{Fields: map[string]*commonpb.Payload{apmtemporal.HeaderKey: payload}}
+}
+
+func noopWorkflowHistory() *historypb.History {
+	return &historypb.History{Events: []*historypb.HistoryEvent{{
+		EventId:   1,
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+		Attributes: &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{
+			WorkflowExecutionStartedEventAttributes: &historypb.WorkflowExecutionStartedEventAttributes{
+				WorkflowType: &commonpb.WorkflowType{Name: "noopWorkflow"},
+				TaskQueue:    &taskqueuepb.TaskQueue{Name: "replay"},
+			},
+		},
+	}, {
+		EventId:   2,
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_SCHEDULED,
+		Attributes: &historypb.HistoryEvent_WorkflowTaskScheduledEventAttributes{
+			WorkflowTaskScheduledEventAttributes: &historypb.WorkflowTaskScheduledEventAttributes{},
+		},
+	}, {
+		EventId:   3,
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_STARTED,
+		Attributes: &historypb.HistoryEvent_WorkflowTaskStartedEventAttributes{
+			WorkflowTaskStartedEventAttributes: &historypb.WorkflowTaskStartedEventAttributes{ScheduledEventId: 2},
+		},
+	}, {
+		EventId:   4,
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_TASK_COMPLETED,
+		Attributes: &historypb.HistoryEvent_WorkflowTaskCompletedEventAttributes{
+			WorkflowTaskCompletedEventAttributes: &historypb.WorkflowTaskCompletedEventAttributes{
+				ScheduledEventId: 2,
+				StartedEventId:   3,
+			},
+		},
+	}, {
+		EventId:   5,
+		EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED,
+		Attributes: &historypb.HistoryEvent_WorkflowExecutionCompletedEventAttributes{
+			WorkflowExecutionCompletedEventAttributes: &historypb.WorkflowExecutionCompletedEventAttributes{
+				WorkflowTaskCompletedEventId: 4,
+			},
+		},
+	}}}
+}
@@ -0,0 +1,167 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apmtemporal
+
+import (
+	"crypto/sha256"
+
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+
+	"go.elastic.co/apm"
+)
+
+// traceContextKey is the workflow.Context key for the trace
+// context to propagate to activities and child workflows.
+type traceContextKey struct{}
+
+// InterceptWorkflow returns an interceptor.WorkflowInboundInterceptor
+// which traces workflow executions as transactions, and propagates
+// trace context to the activities and child workflows they start.
+func (i *apmInterceptor) InterceptWorkflow(
+	ctx workflow.Context,
+	next interceptor.WorkflowInboundInterceptor,
+) interceptor.WorkflowInboundInterceptor {
+	return &workflowInboundInterceptor{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		tracer:                         i.tracer,
+	}
+}
+
+type workflowInboundInterceptor struct {
+	interceptor.WorkflowInboundInterceptorBase
+	tracer *apm.Tracer
+}
+
+func (w *workflowInboundInterceptor) Init(outbound interceptor.WorkflowOutboundInterceptor) error {
+	return w.Next.Init(&workflowOutboundInterceptor{
+		WorkflowOutboundInterceptorBase: interceptor.WorkflowOutboundInterceptorBase{Next: outbound},
+	})
+}
+
+func (w *workflowInboundInterceptor) ExecuteWorkflow(
+	ctx workflow.Context,
+	in *interceptor.ExecuteWorkflowInput,
+) (interface{}, error) {
+	info := workflow.GetInfo(ctx)
+
+	// The workflow execution may be replayed from its history, e.g. when
+	// the worker is restarted or the workflow is evicted from its cache,
+	// so the transaction is started for each execution with IDs derived
+	// from the run ID. Activities and child workflows scheduled before and
+	// after a replay then share the same parent, in the same trace.
+	transactionID, traceID := workflowIDs(info.WorkflowExecution.RunID)
+	traceContext, ok := readTraceContext(interceptor.WorkflowHeader(ctx))
+	if !ok {
+		traceContext = w.rootTraceContext(transactionID, traceID)
+	}
+	tx := w.tracer.StartTransactionOptions(info.WorkflowType.Name, "temporal.workflow", apm.TransactionOptions{
+		TraceContext:  traceContext,
+		TransactionID: transactionID,
+		Start:         info.WorkflowStartTime,
+	})
+	var completed bool
+	var err error
+	defer func() {
+		// The execution is reported only by the worker which completes
+		// it. If the workflow's coroutine is destroyed before completing,
+		// e.g. due to cache eviction, or the completion is being replayed,
+		// the transaction is discarded.
+		if !completed || workflow.IsReplaying(ctx) {
+			tx.Discard()
+			return
+		}
+		setTransactionResult(w.tracer, tx, err)
+		tx.End()
+	}()
+	tx.Context.SetLabel("workflow_id", info.WorkflowExecution.ID)
+	tx.Context.SetLabel("run_id", info.WorkflowExecution.RunID)
+
+	ctx = workflow.WithValue(ctx, traceContextKey{}, tx.TraceContext())
+	result, err := w.Next.ExecuteWorkflow(ctx, in)
+	completed = true
+	return result, err
+}
+
+// workflowIDs returns the transaction ID for the workflow execution with
+// the given run ID, and the trace ID to use if the execution does not
+// continue an existing trace. Both are the same for each replay.
+func workflowIDs(runID string) (apm.SpanID, apm.TraceID) {
+	var transactionID apm.SpanID
+	var traceID apm.TraceID
+	sum := sha256.Sum256([]byte(runID))
+	copy(transactionID[:], sum[:8])
+	copy(traceID[:], sum[8:])
+	return transactionID, traceID
+}
+
+// rootTraceContext returns the trace context for a workflow execution
+// which does not continue an existing trace, with the given trace ID.
+//
+// The sampling decision is made by the tracer for a root transaction with
+// the given transaction ID, so that it is the same for each replay when
+// the sampler's decision depends only on the transaction ID, as with the
+// default ratio sampler. The resulting trace state propagates the sample
+// rate to the workflow transaction.
+func (w *workflowInboundInterceptor) rootTraceContext(transactionID apm.SpanID, traceID apm.TraceID) apm.TraceContext {
+	tx := w.tracer.StartTransactionOptions("", "", apm.TransactionOptions{TransactionID: transactionID})
+	traceContext := tx.TraceContext()
+	tx.Discard()
+	traceContext.Trace = traceID
+	traceContext.Span = apm.SpanID{}
+	return traceContext
+}
+
+type workflowOutboundInterceptor struct {
+	interceptor.WorkflowOutboundInterceptorBase
+}
+
+func (w *workflowOutboundInterceptor) ExecuteActivity(
+	ctx workflow.Context,
+	activityType string,
+	args ...interface{},
+) workflow.Future {
+	propagateTraceContext(ctx)
+	return w.Next.ExecuteActivity(ctx, activityType, args...)
+}
+
+func (w *workflowOutboundInterceptor) ExecuteLocalActivity(
+	ctx workflow.Context,
+	activityType string,
+	args ...interface{},
+) workflow.Future {
+	propagateTraceContext(ctx)
+	return w.Next.ExecuteLocalActivity(ctx, activityType, args...)
+}
+
+func (w *workflowOutboundInterceptor) ExecuteChildWorkflow(
+	ctx workflow.Context,
+	childWorkflowType string,
+	args ...interface{},
+) workflow.ChildWorkflowFuture {
+	propagateTraceContext(ctx)
+	return w.Next.ExecuteChildWorkflow(ctx, childWorkflowType, args...)
+}
+
+// propagateTraceContext writes the workflow's trace context, if any,
+// to the Temporal header in ctx.
+func propagateTraceContext(ctx workflow.Context) {
+	if traceContext, ok := ctx.Value(traceContextKey{}).(apm.TraceContext); ok {
+		writeTraceContext(interceptor.WorkflowHeader(ctx), traceContext)
+	}
+}
@@ -135,7 +135,7 @@ func (c *contextCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
 	tracer := c.core.tracer()
 	errlog := tracer.NewErrorLog(apm.ErrorLogRecord{
 		Message:    entry.Message,
-		Level:      entry.Level.String(),
+		Level:      errorLevel(entry.Level),
 		LoggerName: entry.LoggerName,
 		Error:      traceContext.err,
 	})
@@ -186,3 +186,17 @@ func (c *traceContext) fields(fields []zapcore.Field) {
 		}
 	}
 }
+
+// errorLevel returns the apm.Error severity level corresponding
+// to the given zap level.
+func errorLevel(level zapcore.Level) string {
+	switch level {
+	case zapcore.DPanicLevel, zapcore.PanicLevel, zapcore.FatalLevel:
+		return apm.ErrorLevelCritical
+	case zapcore.ErrorLevel:
+		return apm.ErrorLevelError
+	case zapcore.WarnLevel:
+		return apm.ErrorLevelWarning
+	}
+	return level.String()
+}
@@ -158,5 +158,5 @@ func TestCoreFatal(t *testing.T) {
 	payloads := recorder.Payloads()
 	require.Len(t, payloads.Errors, 1)
 	assert.Equal(t, "fatality!", payloads.Errors[0].Log.Message)
-	assert.Equal(t, "fatal", payloads.Errors[0].Log.Level)
+	assert.Equal(t, "critical", payloads.Errors[0].Log.Level)
 }
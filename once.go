@@ -0,0 +1,39 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"context"
+	"sync"
+)
+
+// TraceOnce calls once.Do(f), reporting a span with the given name and
+// type "app.init" if f is executed by this call. The span is started
+// within the transaction and parent span in ctx, if any.
+//
+// TraceOnce is intended for recording the latency of lazy, one-time
+// initialization in the request that triggers it. Calls for which once
+// has already run f do not record a span, and have no overhead beyond
+// that of sync.Once.Do.
+func TraceOnce(ctx context.Context, once *sync.Once, name string, f func()) {
+	once.Do(func() {
+		span, _ := StartSpan(ctx, name, "app.init")
+		defer span.End()
+		f()
+	})
+}
@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/apmtest"
+)
+
+func TestTraceOnce(t *testing.T) {
+	var once sync.Once
+	var calls int
+	initialize := func() { calls++ }
+
+	tx, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		apm.TraceOnce(ctx, &once, "initialize", initialize)
+		apm.TraceOnce(ctx, &once, "initialize", initialize)
+	})
+	assert.Equal(t, 1, calls)
+	require.Len(t, spans, 1)
+	assert.Equal(t, "initialize", spans[0].Name)
+	assert.Equal(t, "app", spans[0].Type)
+	assert.Equal(t, "init", spans[0].Subtype)
+	assert.Equal(t, tx.ID, spans[0].ParentID)
+
+	// Subsequent transactions do not record a span,
+	// as the initialization function is not called.
+	_, spans, _ = apmtest.WithTransaction(func(ctx context.Context) {
+		apm.TraceOnce(ctx, &once, "initialize", initialize)
+	})
+	assert.Equal(t, 1, calls)
+	assert.Len(t, spans, 0)
+}
+
+func TestTraceOnceNested(t *testing.T) {
+	var once sync.Once
+	tx, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		span, ctx := apm.StartSpan(ctx, "parent", "custom")
+		defer span.End()
+		apm.TraceOnce(ctx, &once, "initialize", func() {})
+	})
+	require.Len(t, spans, 2)
+	assert.Equal(t, "initialize", spans[0].Name)
+	assert.Equal(t, spans[1].ID, spans[0].ParentID)
+	assert.Equal(t, tx.ID, spans[1].ParentID)
+}
+
+func TestTraceOnceNoTransaction(t *testing.T) {
+	var once sync.Once
+	var called bool
+	apm.TraceOnce(context.Background(), &once, "initialize", func() { called = true })
+	assert.True(t, called)
+}
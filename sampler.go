@@ -21,6 +21,7 @@ import (
 	"encoding/binary"
 	"math"
 	"math/big"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -35,6 +36,45 @@ type Sampler interface {
 	Sample(TraceContext) bool
 }
 
+// ExtendedSampler may be implemented by Samplers, providing
+// a method for sampling and returning an extended SampleResult,
+// which includes the sample rate used for the decision.
+//
+// If a Sampler does not implement ExtendedSampler, the sample
+// rate of transactions it samples will not be recorded, and the
+// APM Server will treat each of them as representing exactly one
+// transaction.
+type ExtendedSampler interface {
+	// SampleExtended indicates whether or not a transaction
+	// should be sampled, and the sample rate in effect at the
+	// time. This method will be invoked by calls to
+	// Tracer.StartTransaction for the root of a trace, so it
+	// must be goroutine-safe, and should avoid synchronization
+	// as far as possible.
+	SampleExtended(SampleParams) SampleResult
+}
+
+// SampleParams holds parameters for SampleExtended.
+type SampleParams struct {
+	// TraceContext holds the newly-generated TraceContext
+	// for the root transaction which is being sampled.
+	TraceContext TraceContext
+}
+
+// SampleResult holds information about a sampling decision.
+type SampleResult struct {
+	// Sampled holds the sampling decision.
+	Sampled bool
+
+	// SampleRate holds the sample rate in effect at the
+	// time of the sampling decision. This is used for
+	// propagating the value downstream, and for inclusion
+	// in events sent to APM Server.
+	//
+	// The sample rate should be in the range [0,1.0].
+	SampleRate float64
+}
+
 // NewRatioSampler returns a new Sampler with the given ratio
 //
 // A ratio of 1.0 samples 100% of transactions, a ratio of 0.5
@@ -44,6 +84,26 @@ type Sampler interface {
 // The returned Sampler bases its decision on the value of the
 // transaction ID, so there is no synchronization involved.
 func NewRatioSampler(r float64) Sampler {
+	return ratioSampler{ceil: ratioCeil(r), rate: r}
+}
+
+// NewRatioSamplerWithSeed returns a new Sampler with the given ratio,
+// like NewRatioSampler, whose decisions are based on the trace ID
+// combined with the given seed.
+//
+// Samplers created with the same ratio and seed will make the same
+// decision for a given trace ID, so they can be used to obtain
+// reproducible sampling decisions in tests, or to coordinate sampling
+// between shards of a deployment. Samplers with different seeds will
+// make independent decisions. In production, you should generally use
+// NewRatioSampler, which uses the randomly generated transaction ID.
+func NewRatioSamplerWithSeed(r float64, seed int64) Sampler {
+	return seededRatioSampler{ceil: ratioCeil(r), rate: r, seed: uint64(seed)}
+}
+
+// ratioCeil returns the value below which a uniformly distributed
+// uint64 must lie to be sampled with the given ratio.
+func ratioCeil(r float64) uint64 {
 	if r < 0 || r > 1.0 {
 		panic(errors.Errorf("ratio %v out of range [0,1.0]", r))
 	}
@@ -51,11 +111,83 @@ func NewRatioSampler(r float64) Sampler {
 	x.SetUint64(math.MaxUint64)
 	x.Mul(&x, big.NewFloat(r))
 	ceil, _ := x.Uint64()
-	return ratioSampler{ceil}
+	return ceil
+}
+
+// NewDecayingSampler returns a new Sampler whose sampling ratio decays
+// linearly from initialRate to finalRate over the given duration, starting
+// from when NewDecayingSampler is called, and thereafter remains at
+// finalRate. If decayOver is not positive, finalRate is used immediately.
+//
+// This is intended for services which should be sampled at a high rate
+// shortly after they are deployed, e.g. to validate the deployment, and
+// at a lower rate once they reach a steady state. The sampler should be
+// created when the process starts, e.g. by calling Tracer.SetSampler in
+// main.
+//
+// If either rate does not lie within the range [0,1.0], NewDecayingSampler
+// will panic. Like NewRatioSampler, the returned Sampler bases its decision
+// on the value of the transaction ID.
+func NewDecayingSampler(initialRate, finalRate float64, decayOver time.Duration) Sampler {
+	ratioCeil(initialRate)
+	final := ratioSampler{ceil: ratioCeil(finalRate), rate: finalRate}
+	return &decayingSampler{
+		start:       time.Now(),
+		initialRate: initialRate,
+		finalRate:   finalRate,
+		decayOver:   decayOver,
+		final:       final,
+		now:         time.Now,
+	}
+}
+
+type decayingSampler struct {
+	start       time.Time
+	initialRate float64
+	finalRate   float64
+	decayOver   time.Duration
+	final       ratioSampler
+	now         func() time.Time
+}
+
+// Sample samples the transaction according to the ratio at the
+// current time, and the transaction ID.
+func (s *decayingSampler) Sample(c TraceContext) bool {
+	return s.SampleExtended(SampleParams{TraceContext: c}).Sampled
+}
+
+// SampleExtended samples the transaction according to the ratio
+// at the current time, and the transaction ID, returning the
+// ratio as the sample rate.
+func (s *decayingSampler) SampleExtended(p SampleParams) SampleResult {
+	elapsed := s.now().Sub(s.start)
+	if elapsed >= s.decayOver {
+		return s.final.SampleExtended(p)
+	}
+	rate := s.rate(elapsed)
+	sampler := ratioSampler{ceil: math.MaxUint64, rate: rate}
+	if rate < 1 {
+		sampler.ceil = uint64(rate * math.MaxUint64)
+	}
+	return sampler.SampleExtended(p)
+}
+
+// rate returns the sampling ratio after the given amount of
+// time has elapsed since the sampler was created.
+func (s *decayingSampler) rate(elapsed time.Duration) float64 {
+	if elapsed >= s.decayOver {
+		return s.finalRate
+	}
+	if elapsed <= 0 {
+		return s.initialRate
+	}
+	progress := float64(elapsed) / float64(s.decayOver)
+	return s.initialRate + (s.finalRate-s.initialRate)*progress
 }
 
 type ratioSampler struct {
 	ceil uint64
+	rate float64
 }
 
 // Sample samples the transaction according to the configured
@@ -64,3 +196,43 @@ func (s ratioSampler) Sample(c TraceContext) bool {
 	v := binary.BigEndian.Uint64(c.Span[:])
 	return v > 0 && v-1 < s.ceil
 }
+
+// SampleExtended samples the transaction according to the
+// configured ratio and pseudo-random source, returning the
+// ratio as the sample rate.
+func (s ratioSampler) SampleExtended(p SampleParams) SampleResult {
+	return SampleResult{Sampled: s.Sample(p.TraceContext), SampleRate: s.rate}
+}
+
+type seededRatioSampler struct {
+	ceil uint64
+	rate float64
+	seed uint64
+}
+
+// Sample samples the transaction according to the configured
+// ratio, the trace ID, and the seed.
+func (s seededRatioSampler) Sample(c TraceContext) bool {
+	if c.Trace.Validate() != nil {
+		return false
+	}
+	v := binary.BigEndian.Uint64(c.Trace[:8]) ^ binary.BigEndian.Uint64(c.Trace[8:])
+	v = mix64(v ^ s.seed)
+	return v > 0 && v-1 < s.ceil
+}
+
+// SampleExtended samples the transaction according to the
+// configured ratio, the trace ID, and the seed, returning the
+// ratio as the sample rate.
+func (s seededRatioSampler) SampleExtended(p SampleParams) SampleResult {
+	return SampleResult{Sampled: s.Sample(p.TraceContext), SampleRate: s.rate}
+}
+
+// mix64 is the finalizer of the SplitMix64 pseudo-random number
+// generator, which is used to uniformly distribute the bits of
+// the combined trace ID and seed.
+func mix64(v uint64) uint64 {
+	v = (v ^ (v >> 30)) * 0xbf58476d1ce4e5b9
+	v = (v ^ (v >> 27)) * 0x94d049bb133111eb
+	return v ^ (v >> 31)
+}
@@ -0,0 +1,81 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecayingSamplerRate(t *testing.T) {
+	s := NewDecayingSampler(1.0, 0.1, 10*time.Minute).(*decayingSampler)
+	for _, test := range []struct {
+		elapsed time.Duration
+		rate    float64
+	}{
+		{-time.Minute, 1.0},
+		{0, 1.0},
+		{time.Minute, 0.91},
+		{5 * time.Minute, 0.55},
+		{9 * time.Minute, 0.19},
+		{10 * time.Minute, 0.1},
+		{time.Hour, 0.1},
+	} {
+		assert.InDelta(t, test.rate, s.rate(test.elapsed), 1e-9, "elapsed=%s", test.elapsed)
+	}
+}
+
+func TestDecayingSamplerSample(t *testing.T) {
+	s := NewDecayingSampler(1.0, 0, 10*time.Minute).(*decayingSampler)
+	var now time.Time
+	s.now = func() time.Time { return now }
+
+	sampleRatio := func() float64 {
+		const numTraces = 10000
+		rng := rand.New(rand.NewSource(0))
+		var sampled int
+		for i := 0; i < numTraces; i++ {
+			var traceContext TraceContext
+			binary.LittleEndian.PutUint64(traceContext.Span[:], rng.Uint64())
+			if s.Sample(traceContext) {
+				sampled++
+			}
+		}
+		return float64(sampled) / numTraces
+	}
+
+	now = s.start
+	assert.Equal(t, 1.0, sampleRatio())
+	now = s.start.Add(2 * time.Minute)
+	assert.InDelta(t, 0.8, sampleRatio(), 0.02)
+	now = s.start.Add(5 * time.Minute)
+	assert.InDelta(t, 0.5, sampleRatio(), 0.02)
+	now = s.start.Add(10 * time.Minute)
+	assert.Equal(t, 0.0, sampleRatio())
+}
+
+func TestDecayingSamplerNoDecay(t *testing.T) {
+	s := NewDecayingSampler(1.0, 0.25, 0).(*decayingSampler)
+	assert.Equal(t, 0.25, s.rate(0))
+	assert.Panics(t, func() { NewDecayingSampler(1.5, 0.5, time.Minute) })
+	assert.Panics(t, func() { NewDecayingSampler(1.0, -0.5, time.Minute) })
+}
@@ -22,10 +22,13 @@ import (
 	"math/rand"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"go.elastic.co/apm"
+	"go.elastic.co/apm/apmtest"
 )
 
 func TestRatioSampler(t *testing.T) {
@@ -86,3 +89,195 @@ func TestRatioSamplerNever(t *testing.T) {
 		Span: apm.SpanID{255, 255, 255, 255, 255, 255, 255, 255},
 	}))
 }
+
+func TestRatioSamplerWithSeed(t *testing.T) {
+	const ratio = 0.5
+	s1 := apm.NewRatioSamplerWithSeed(ratio, 42)
+	s2 := apm.NewRatioSamplerWithSeed(ratio, 42)
+	s3 := apm.NewRatioSamplerWithSeed(ratio, 43)
+
+	const numTraces = 10000
+	rng := rand.New(rand.NewSource(0))
+	var sampled, differ int
+	for i := 0; i < numTraces; i++ {
+		var traceContext apm.TraceContext
+		rng.Read(traceContext.Trace[:])
+		rng.Read(traceContext.Span[:])
+		decision := s1.Sample(traceContext)
+		if decision {
+			sampled++
+		}
+
+		// Samplers with the same seed make the same decision
+		// for a given trace ID, regardless of the span ID.
+		rng.Read(traceContext.Span[:])
+		assert.Equal(t, decision, s2.Sample(traceContext))
+		if decision != s3.Sample(traceContext) {
+			differ++
+		}
+	}
+	assert.InDelta(t, ratio, float64(sampled)/numTraces, 0.05)
+
+	// Samplers with different seeds make independent decisions,
+	// so they should differ for approximately half of traces.
+	assert.InDelta(t, 0.5, float64(differ)/numTraces, 0.05)
+}
+
+func TestRatioSamplerWithSeedAlwaysNever(t *testing.T) {
+	traceContext := apm.TraceContext{
+		Trace: apm.TraceID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	}
+	assert.True(t, apm.NewRatioSamplerWithSeed(1.0, 1).Sample(traceContext))
+	assert.False(t, apm.NewRatioSamplerWithSeed(0, 1).Sample(traceContext))
+	assert.False(t, apm.NewRatioSamplerWithSeed(1.0, 1).Sample(apm.TraceContext{})) // invalid trace ID
+}
+
+func TestTransactionSampleRate(t *testing.T) {
+	type test struct {
+		name    string
+		sampler apm.Sampler
+		opts    apm.TransactionOptions
+		// expected holds the expected sample rate of sampled
+		// transactions, or nil if the rate is not recorded.
+		expected *float64
+	}
+	rate := func(r float64) *float64 { return &r }
+	traceContext := apm.TraceContext{
+		Trace:   apm.TraceID{1},
+		Span:    apm.SpanID{1},
+		Options: apm.TraceOptions(0).WithRecorded(true),
+	}
+	for _, test := range []test{
+		{name: "default", expected: rate(1)},
+		{name: "ratio", sampler: apm.NewRatioSampler(0.5), expected: rate(0.5)},
+		{name: "ratio_seed", sampler: apm.NewRatioSamplerWithSeed(0.25, 1), expected: rate(0.25)},
+		{name: "decaying", sampler: apm.NewDecayingSampler(0.8, 0.8, time.Hour), expected: rate(0.8)},
+		{name: "decayed", sampler: apm.NewDecayingSampler(1.0, 0.3, 0), expected: rate(0.3)},
+		{name: "custom", sampler: customSampler{}, expected: nil},
+		{name: "rounded", sampler: apm.NewRatioSampler(0.123456), expected: rate(0.1235)},
+		{name: "inherited", sampler: apm.NewRatioSampler(0.5), opts: apm.TransactionOptions{TraceContext: traceContext}},
+		{
+			name:     "inherited_tracestate",
+			sampler:  apm.NewRatioSampler(0.5),
+			opts:     apm.TransactionOptions{TraceContext: withTracestate(traceContext, "s:0.25")},
+			expected: rate(0.25),
+		},
+		{
+			name:    "inherited_tracestate_invalid",
+			sampler: apm.NewRatioSampler(0.5),
+			opts:    apm.TransactionOptions{TraceContext: withTracestate(traceContext, "s:2")},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tracer := apmtest.NewRecordingTracer()
+			defer tracer.Close()
+			tracer.SetSampler(test.sampler)
+			for i := 0; i < 100; i++ {
+				tracer.StartTransactionOptions("name", "type", test.opts).End()
+			}
+			tracer.Flush(nil)
+
+			var sampled int
+			for _, tx := range tracer.Payloads().Transactions {
+				if tx.Sampled == nil || *tx.Sampled {
+					sampled++
+					assert.Equal(t, test.expected, tx.SampleRate)
+				} else if test.expected != nil {
+					// Non-sampled transactions record a rate of zero.
+					assert.Equal(t, rate(0), tx.SampleRate)
+				} else {
+					assert.Nil(t, tx.SampleRate)
+				}
+			}
+			assert.NotZero(t, sampled)
+		})
+	}
+}
+
+func TestTransactionSampleRateForceSampled(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.SetSampler(apm.NewRatioSampler(0))
+	tracer.StartTransactionOptions("name", "type", apm.TransactionOptions{ForceSampled: true}).End()
+	tracer.Flush(nil)
+
+	// Forced sampling does not follow the sample
+	// rate, so no sample rate is recorded.
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Nil(t, payloads.Transactions[0].Sampled)
+	assert.Nil(t, payloads.Transactions[0].SampleRate)
+}
+
+func TestTransactionSampleRateTracestate(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		result   apm.SampleResult
+		opts     apm.TransactionOptions
+		expected string
+	}{
+		{name: "sampled", result: apm.SampleResult{Sampled: true, SampleRate: 0.5}, expected: "es=s:0.5"},
+		{name: "rounded", result: apm.SampleResult{Sampled: true, SampleRate: 1.0 / 3}, expected: "es=s:0.3333"},
+		{name: "minimum", result: apm.SampleResult{Sampled: true, SampleRate: 0.00001}, expected: "es=s:0.0001"},
+		{name: "not_sampled", result: apm.SampleResult{Sampled: false, SampleRate: 0.5}, expected: "es=s:0"},
+		{
+			name:   "force_sampled",
+			result: apm.SampleResult{Sampled: false, SampleRate: 0.5},
+			opts:   apm.TransactionOptions{ForceSampled: true},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tracer := apmtest.NewRecordingTracer()
+			defer tracer.Close()
+			tracer.SetSampler(extendedSampler{test.result})
+
+			tx := tracer.StartTransactionOptions("name", "type", test.opts)
+			assert.Equal(t, test.expected, tx.TraceContext().State.String())
+
+			// Transactions continuing the trace record
+			// the propagated sample rate.
+			tx2 := tracer.StartTransactionOptions("name", "type", apm.TransactionOptions{
+				TraceContext: tx.TraceContext(),
+			})
+			assert.Equal(t, test.expected, tx2.TraceContext().State.String())
+			tx2.End()
+			tx.End()
+			tracer.Flush(nil)
+
+			transactions := tracer.Payloads().Transactions
+			require.Len(t, transactions, 2)
+			assert.Equal(t, transactions[1].SampleRate, transactions[0].SampleRate)
+		})
+	}
+}
+
+func TestRatioSamplerSampleExtended(t *testing.T) {
+	s := apm.NewRatioSampler(0.5).(apm.ExtendedSampler)
+	result := s.SampleExtended(apm.SampleParams{TraceContext: apm.TraceContext{
+		Span: apm.SpanID{0, 0, 0, 0, 0, 0, 0, 1},
+	}})
+	assert.Equal(t, apm.SampleResult{Sampled: true, SampleRate: 0.5}, result)
+}
+
+// customSampler is a Sampler which does not implement
+// ExtendedSampler, and so whose sample rate is unknown.
+type customSampler struct{}
+
+func (customSampler) Sample(apm.TraceContext) bool { return true }
+
+// extendedSampler is an ExtendedSampler which
+// always returns the same result.
+type extendedSampler struct {
+	result apm.SampleResult
+}
+
+func (s extendedSampler) Sample(apm.TraceContext) bool { return s.result.Sampled }
+
+func (s extendedSampler) SampleExtended(apm.SampleParams) apm.SampleResult { return s.result }
+
+// withTracestate returns a copy of traceContext with
+// an Elastic tracestate entry holding the given value.
+func withTracestate(traceContext apm.TraceContext, value string) apm.TraceContext {
+	traceContext.State = apm.NewTraceState(apm.TraceStateEntry{Key: "es", Value: value})
+	return traceContext
+}
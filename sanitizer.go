@@ -60,7 +60,8 @@ func sanitizeHeaders(headers model.Headers, matchers wildcard.Matchers) {
 		if !matchers.MatchAny(h.Key) || len(h.Values) == 0 {
 			continue
 		}
-		h.Values = h.Values[:1]
-		h.Values[0] = redacted
+		// The values may be shared with the original http.Header,
+		// so they must be replaced rather than modified in place.
+		h.Values = []string{redacted}
 	}
 }
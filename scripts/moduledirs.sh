@@ -3,8 +3,32 @@
 # Print the module directories. If modules are disabled or unsupported
 # by the installed Go toolchain, then just print the current working
 # directory (assumed to be the repo top level.)
+#
+# Modules declaring a newer Go version than the installed toolchain,
+# e.g. because their dependencies require it, are omitted unless the
+# -all flag is specified.
 if test -z "$(go env GOMOD)"; then
     pwd
-else
-    find . -type f -name go.mod \! -path './vendor/*' -exec dirname '{}' \;
+    exit
 fi
+
+mingoversion="$(dirname "$0")/mingoversion.go"
+supported=" "
+unsupported=" "
+for gomod in $(find . -type f -name go.mod \! -path './vendor/*'); do
+    version=$(sed -n 's/^go \([0-9.]*\)$/\1/p' "$gomod")
+    if test "$1" != "-all" -a -n "$version"; then
+        case "$unsupported" in *" $version "*) continue;; esac
+        case "$supported" in
+        *" $version "*) ;;
+        *)
+            if test "$(go run "$mingoversion" -print "$version")" != "true"; then
+                unsupported="$unsupported$version "
+                continue
+            fi
+            supported="$supported$version "
+            ;;
+        esac
+    fi
+    dirname "$gomod"
+done
@@ -5,7 +5,7 @@ export GO111MODULE=on
 
 prefix=go.elastic.co/apm
 version=$(sed 's@^\s*AgentVersion = "\(.*\)"$@\1@;t;d' version.go)
-modules=$(for dir in $(./scripts/moduledirs.sh); do (cd $dir && go list -m); done | grep $prefix/)
+modules=$(for dir in $(./scripts/moduledirs.sh -all); do (cd $dir && go list -m); done | grep $prefix/)
 
 echo "# Create tags"
 for m in "" $modules; do
@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownFlushTimeout is the default maximum amount of time
+// FlushOnShutdown waits for the tracer to flush buffered events after
+// receiving a shutdown signal.
+const DefaultShutdownFlushTimeout = 5 * time.Second
+
+// FlushOnShutdown installs a handler for the given signals, which
+// flushes and closes tracer when one of the signals is received, or
+// apm.DefaultTracer if tracer is nil. If no signals are given, then
+// os.Interrupt and syscall.SIGTERM are handled.
+//
+// When a signal is received, buffered events are flushed to the APM
+// Server, waiting at most timeout, or DefaultShutdownFlushTimeout if
+// timeout is not positive, after which the tracer is closed regardless;
+// events that have not been sent by then are lost. The handler is then
+// removed, and the signal is raised again, so that the signal's default
+// behaviour, such as terminating the process, takes place once the tracer
+// has been flushed. Where the signal cannot be raised again, e.g.
+// os.Interrupt on Windows, the process is left running, and it is up to
+// the application to handle the signal.
+//
+// FlushOnShutdown does not consume signals: handlers installed by the
+// application with signal.Notify continue to receive them, concurrently
+// with the tracer being flushed. Such handlers will receive the signal
+// a second time when it is raised again, and so should tolerate repeated
+// signals. Applications that handle shutdown themselves may prefer to
+// call Tracer.Flush and Tracer.Close directly.
+//
+// FlushOnShutdown returns a function which removes the handler, if a
+// signal has not yet been received. The returned function does not flush
+// or close the tracer.
+func FlushOnShutdown(tracer *Tracer, timeout time.Duration, signals ...os.Signal) func() {
+	if tracer == nil {
+		tracer = DefaultTracer
+	}
+	if timeout <= 0 {
+		timeout = DefaultShutdownFlushTimeout
+	}
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+	done := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() {
+		stopOnce.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+
+	go func() {
+		select {
+		case <-done:
+			return
+		case sig := <-c:
+			abort := make(chan struct{})
+			timer := time.AfterFunc(timeout, func() { close(abort) })
+			tracer.Flush(abort)
+			timer.Stop()
+			tracer.Close()
+			stop()
+			raiseSignal(sig)
+		}
+	}()
+	return stop
+}
+
+// raiseSignal sends sig to the current process, if possible.
+func raiseSignal(sig os.Signal) {
+	if p, err := os.FindProcess(os.Getpid()); err == nil {
+		p.Signal(sig)
+	}
+}
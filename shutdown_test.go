@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !windows
+
+package apm_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestFlushOnShutdown(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	// Install our own handler to observe the signal being delivered,
+	// and raised again after flushing, and to prevent the default
+	// action of terminating the test process.
+	received := make(chan os.Signal, 2)
+	signal.Notify(received, syscall.SIGUSR1)
+	defer signal.Stop(received)
+
+	apm.FlushOnShutdown(tracer, 0, syscall.SIGUSR1)
+	tracer.StartTransaction("name", "type").End()
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for signal %d", i+1)
+		}
+	}
+
+	// The signal is only raised again once the tracer has been flushed.
+	payloads := transport.Payloads()
+	assert.Len(t, payloads.Transactions, 1)
+	assert.False(t, tracer.Active())
+}
+
+func TestFlushOnShutdownStop(t *testing.T) {
+	tracer, transport := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	received := make(chan os.Signal, 2)
+	signal.Notify(received, syscall.SIGUSR1)
+	defer signal.Stop(received)
+
+	stop := apm.FlushOnShutdown(tracer, 0, syscall.SIGUSR1)
+	stop()
+	stop() // idempotent
+	tracer.StartTransaction("name", "type").End()
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for signal")
+	}
+	select {
+	case <-received:
+		t.Fatal("unexpected signal raised after stopping")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.True(t, tracer.Active())
+	assert.Empty(t, transport.Payloads().Transactions)
+}
+
+func TestFlushOnShutdownTimeout(t *testing.T) {
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{Transport: blockingTransport{}})
+	require.NoError(t, err)
+	defer tracer.Close()
+
+	received := make(chan os.Signal, 2)
+	signal.Notify(received, syscall.SIGUSR1)
+	defer signal.Stop(received)
+
+	apm.FlushOnShutdown(tracer, 100*time.Millisecond, syscall.SIGUSR1)
+	tracer.StartTransaction("name", "type").End()
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	// The signal should be raised again once the timeout expires,
+	// well before the default timeout.
+	timeout := time.After(apm.DefaultShutdownFlushTimeout - time.Second)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-timeout:
+			t.Fatalf("timed out waiting for signal %d", i+1)
+		}
+	}
+	assert.False(t, tracer.Active())
+}
+
+// blockingTransport is a transport which blocks
+// sending events until the context is canceled.
+type blockingTransport struct{}
+
+func (blockingTransport) SendStream(ctx context.Context, r io.Reader) error {
+	io.Copy(ioutil.Discard, r)
+	<-ctx.Done()
+	return ctx.Err()
+}
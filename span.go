@@ -99,6 +99,12 @@ func (tx *Transaction) StartSpanOptions(name, spanType string, opts SpanOptions)
 	// Guard access to spansCreated, spansDropped, rand, and childrenTimer.
 	tx.TransactionData.mu.Lock()
 	defer tx.TransactionData.mu.Unlock()
+	if tx.spanCountLabels {
+		if tx.spanCounts == nil {
+			tx.spanCounts = make(map[string]int)
+		}
+		tx.spanCounts[span.Type]++
+	}
 	if !span.traceContext.Options.Recorded() {
 		span.tracer = nil // span is dropped
 	} else if tx.maxSpans >= 0 && tx.spansCreated >= tx.maxSpans {
@@ -129,6 +135,39 @@ func (tx *Transaction) StartSpanOptions(name, spanType string, opts SpanOptions)
 	return span
 }
 
+// SpanSpec describes a span to start with Transaction.StartSpans.
+type SpanSpec struct {
+	// Name is the name of the span.
+	Name string
+
+	// Type is the type of the span, as passed to Transaction.StartSpan.
+	Type string
+
+	// Parent, if non-nil, is the parent of the span. If Parent is nil,
+	// the span will be a direct child of the transaction.
+	Parent *Span
+}
+
+// StartSpans starts and returns a new Span within the transaction for
+// each of the given specs, in the same order, all with the same start
+// time. This is intended for tracing operations which fan out to many
+// concurrent sub-operations.
+//
+// Each span is independent of the others: their End methods must each
+// be called when the corresponding operation completes, and may be
+// called concurrently from different goroutines.
+func (tx *Transaction) StartSpans(specs []SpanSpec) []*Span {
+	spans := make([]*Span, len(specs))
+	start := time.Now()
+	for i, spec := range specs {
+		spans[i] = tx.StartSpanOptions(spec.Name, spec.Type, SpanOptions{
+			parent: spec.Parent,
+			Start:  start,
+		})
+	}
+	return spans
+}
+
 // StartSpan returns a new Span with the specified name, type, transaction ID,
 // and options. The parent transaction context and transaction IDs must have
 // valid, non-zero values, or else the span will be dropped.
@@ -220,11 +259,11 @@ func (t *Tracer) startSpan(name, spanType string, transactionID SpanID, opts Spa
 
 // newDropped returns a new Span with a non-nil SpanData.
 func newDroppedSpan() *Span {
-	span, _ := droppedSpanDataPool.Get().(*Span)
-	if span == nil {
-		span = &Span{SpanData: &SpanData{}}
+	sd, _ := droppedSpanDataPool.Get().(*SpanData)
+	if sd == nil {
+		sd = &SpanData{}
 	}
-	return span
+	return &Span{SpanData: sd}
 }
 
 // Span describes an operation within a transaction.
@@ -265,6 +304,37 @@ func (s *Span) SetStacktrace(skip int) {
 	s.SpanData.setStacktrace(skip + 1)
 }
 
+// SetStackFramesMinDuration overrides, for this span only, the minimum
+// duration for which a stack trace is captured when the span is ended,
+// which otherwise defaults to the tracer's configured span frames minimum
+// duration. Integrations may use this to capture stack traces for their
+// own slow spans, without affecting others.
+//
+// SetStackFramesMinDuration must be called before the span is ended.
+func (s *Span) SetStackFramesMinDuration(d time.Duration) {
+	if s == nil || s.dropped() {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.ended() {
+		return
+	}
+	s.stackFramesMinDuration = d
+}
+
+// SetTypeSubtypeAction sets the span's type, subtype, and action at once.
+// This is equivalent to setting the span's Type, Subtype, and Action fields,
+// and may be used in place of starting the span with a dotted span type when
+// the components are not known until after the span has started.
+//
+// SetTypeSubtypeAction must be called before the span is ended.
+func (s *Span) SetTypeSubtypeAction(spanType, subtype, action string) {
+	s.Type = spanType
+	s.Subtype = subtype
+	s.Action = action
+}
+
 // Dropped indicates whether or not the span is dropped, meaning it will not
 // be included in any transaction. Spans are dropped by Transaction.StartSpan
 // if the transaction is nil, non-sampled, or the transaction's max spans
@@ -295,6 +365,7 @@ func (s *Span) End() {
 	}
 	if s.dropped() {
 		if s.tx == nil {
+			*s.SpanData = SpanData{}
 			droppedSpanDataPool.Put(s.SpanData)
 		} else {
 			s.reportSelfTime()
@@ -388,6 +459,12 @@ type SpanData struct {
 	// and can be set after starting the span.
 	Action string
 
+	// Outcome holds the span outcome: "success", "failure", or "unknown".
+	// For spans representing calls to other services, Outcome describes
+	// whether or not the call succeeded. If Outcome is empty, it will not
+	// be reported; any other value will be reported as "unknown".
+	Outcome string
+
 	// Duration holds the span duration, initialized to -1.
 	//
 	// If you do not update Duration, calling Span.End will calculate the
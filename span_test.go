@@ -19,6 +19,7 @@ package apm_test
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -137,6 +138,109 @@ func TestSpanType(t *testing.T) {
 	check(spans[3], "type", "subtype", "action.figure")
 }
 
+func TestSpanOutcome(t *testing.T) {
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		for _, outcome := range []string{"", "success", "failure"} {
+			span, _ := apm.StartSpan(ctx, "name", "type")
+			span.Outcome = outcome
+			span.End()
+		}
+	})
+	require.Len(t, spans, 3)
+	assert.Equal(t, "", spans[0].Outcome)
+	assert.Equal(t, "success", spans[1].Outcome)
+	assert.Equal(t, "failure", spans[2].Outcome)
+}
+
+func TestSpanOutcomeInvalid(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	logger := warningsLogger(make(chan string, 10))
+	tracer.SetLogger(logger)
+
+	tx := tracer.StartTransaction("name", "type")
+	span := tx.StartSpan("name", "type", nil)
+	span.Outcome = "partial"
+	span.End()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Spans, 1)
+	assert.Equal(t, "unknown", payloads.Spans[0].Outcome)
+	require.Len(t, logger, 1)
+	assert.Equal(t, `invalid outcome "partial" reported as "unknown"`, <-logger)
+}
+
+func TestSpanSetTypeSubtypeAction(t *testing.T) {
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		span, _ := apm.StartSpan(ctx, "name", "type")
+		span.SetTypeSubtypeAction("db", "mysql", "query")
+		span.End()
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, "db", spans[0].Type)
+	assert.Equal(t, "mysql", spans[0].Subtype)
+	assert.Equal(t, "query", spans[0].Action)
+}
+
+func TestSpanSetStackFramesMinDuration(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.SetSpanFramesMinDuration(time.Hour)
+
+	tx := tracer.StartTransaction("name", "type")
+	span := tx.StartSpan("override", "type", nil)
+	span.SetStackFramesMinDuration(0)
+	span.End()
+	tx.StartSpan("default", "type", nil).End()
+	tx.End()
+	tracer.Flush(nil)
+
+	spans := tracer.Payloads().Spans
+	require.Len(t, spans, 2)
+	assert.NotEmpty(t, spans[0].Stacktrace)
+	assert.Empty(t, spans[1].Stacktrace)
+}
+
+func TestTransactionStartSpans(t *testing.T) {
+	tx, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		tx := apm.TransactionFromContext(ctx)
+		parent := tx.StartSpan("parent", "type", nil)
+		children := tx.StartSpans([]apm.SpanSpec{
+			{Name: "child1", Type: "db.mysql.query", Parent: parent},
+			{Name: "child2", Type: "db.mysql.query", Parent: parent},
+			{Name: "sibling", Type: "type"},
+		})
+		require.Len(t, children, 3)
+
+		var wg sync.WaitGroup
+		for _, span := range children {
+			wg.Add(1)
+			go func(span *apm.Span) {
+				defer wg.Done()
+				span.End()
+			}(span)
+		}
+		wg.Wait()
+		parent.End()
+	})
+	require.Len(t, spans, 4)
+
+	byName := make(map[string]model.Span)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	parent := byName["parent"]
+	assert.Equal(t, parent.ID, byName["child1"].ParentID)
+	assert.Equal(t, parent.ID, byName["child2"].ParentID)
+	assert.Equal(t, tx.ID, byName["sibling"].ParentID)
+	assert.Equal(t, "mysql", byName["child1"].Subtype)
+	assert.Equal(t, byName["child1"].Timestamp, byName["child2"].Timestamp)
+	assert.Equal(t, byName["child1"].Timestamp, byName["sibling"].Timestamp)
+	assert.NotEqual(t, byName["child1"].ID, byName["child2"].ID)
+}
+
 func TestTracerStartSpanIDSpecified(t *testing.T) {
 	spanID := apm.SpanID{0, 1, 2, 3, 4, 5, 6, 7}
 	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
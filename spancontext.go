@@ -18,6 +18,7 @@
 package apm
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -27,6 +28,10 @@ import (
 	"go.elastic.co/apm/model"
 )
 
+// maxSpanCustomSize is the maximum total size, in bytes, of the
+// JSON-encoded custom context recorded for a span.
+const maxSpanCustomSize = 10000
+
 // SpanContext provides methods for setting span context.
 type SpanContext struct {
 	model                model.SpanContext
@@ -35,6 +40,9 @@ type SpanContext struct {
 	databaseRowsAffected int64
 	database             model.DatabaseSpanContext
 	http                 model.HTTPSpanContext
+	service              model.ServiceSpanContext
+	serviceTarget        model.ServiceTargetSpanContext
+	customSize           int
 }
 
 // DatabaseSpanContext holds database span context.
@@ -64,12 +72,25 @@ type DestinationServiceSpanContext struct {
 	Resource string
 }
 
+// ServiceTargetSpanContext identifies the service targeted by an exit
+// span, e.g. a database or remote HTTP service.
+type ServiceTargetSpanContext struct {
+	// Type holds the type of the target service, e.g. "mysql" or "http".
+	Type string
+
+	// Name holds an optional name for the target service instance,
+	// e.g. a database name, or a host and port for an HTTP service.
+	Name string
+}
+
 func (c *SpanContext) build() *model.SpanContext {
 	switch {
 	case len(c.model.Tags) != 0:
 	case c.model.Database != nil:
 	case c.model.HTTP != nil:
 	case c.model.Destination != nil:
+	case c.model.Service != nil:
+	case len(c.model.Custom) != 0:
 	default:
 		return nil
 	}
@@ -79,7 +100,8 @@ func (c *SpanContext) build() *model.SpanContext {
 func (c *SpanContext) reset() {
 	*c = SpanContext{
 		model: model.SpanContext{
-			Tags: c.model.Tags[:0],
+			Tags:   c.model.Tags[:0],
+			Custom: c.model.Custom[:0],
 		},
 	}
 }
@@ -110,6 +132,39 @@ func (c *SpanContext) SetLabel(key string, value interface{}) {
 	})
 }
 
+// SetCustom sets custom context, such as verbose diagnostic data, which
+// is recorded with the span but not indexed. Unlike labels, the value
+// may be structured: any JSON-encodable value may be used, including
+// nested maps and slices.
+//
+// Invalid characters ('.', '*', and '"') in the key, and in the keys of
+// nested maps of type map[string]interface{} or map[string]string, will
+// be replaced with underscores. The value is encoded when SetCustom is
+// called, so later modifications to it will not be recorded.
+//
+// The total size of a span's JSON-encoded custom context is limited to
+// 10000 bytes. Values which cannot be encoded as JSON, or which would
+// exceed the size limit, are discarded.
+func (c *SpanContext) SetCustom(key string, value interface{}) {
+	data, err := json.Marshal(makeCustomValue(value))
+	if err != nil {
+		return
+	}
+	key = cleanLabelKey(key)
+	size := len(key) + len(data)
+	if c.customSize+size > maxSpanCustomSize {
+		return
+	}
+	c.customSize += size
+	// Note that we do not attempt to de-duplicate the keys.
+	// This is OK, since json.Unmarshal will always take the
+	// final instance.
+	c.model.Custom = append(c.model.Custom, model.IfaceMapItem{
+		Key:   key,
+		Value: json.RawMessage(data),
+	})
+}
+
 // SetDatabase sets the span context for database-related operations.
 func (c *SpanContext) SetDatabase(db DatabaseSpanContext) {
 	c.database = model.DatabaseSpanContext{
@@ -191,3 +246,36 @@ func (c *SpanContext) SetDestinationService(service DestinationServiceSpanContex
 	c.destination.Service = &c.destinationService
 	c.model.Destination = &c.destination
 }
+
+// SetServiceTarget sets the target service info in the context.
+//
+// If the service target is not set explicitly, but the destination service
+// is set, then the service target will be derived when the span is reported:
+// its type will be the span subtype, or the span type if there is no subtype,
+// and its name will be the database instance for database spans, or the
+// destination service resource for HTTP spans.
+func (c *SpanContext) SetServiceTarget(target ServiceTargetSpanContext) {
+	c.serviceTarget.Type = truncateString(target.Type)
+	c.serviceTarget.Name = truncateString(target.Name)
+	c.service.Target = &c.serviceTarget
+	c.model.Service = &c.service
+}
+
+// setDefaultServiceTarget sets the service target, if it has not been
+// set explicitly, derived from the span type and destination service.
+func (c *SpanContext) setDefaultServiceTarget(spanType, spanSubtype string) {
+	if c.model.Service != nil || c.model.Destination == nil || c.model.Destination.Service == nil {
+		return
+	}
+	target := ServiceTargetSpanContext{Type: spanSubtype}
+	if target.Type == "" {
+		target.Type = spanType
+	}
+	switch {
+	case c.model.Database != nil:
+		target.Name = c.database.Instance
+	case c.model.HTTP != nil:
+		target.Name = c.destinationService.Resource
+	}
+	c.SetServiceTarget(target)
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -50,6 +51,49 @@ func TestSpanContextSetLabel(t *testing.T) {
 	}, spans[0].Context.Tags)
 }
 
+func TestSpanContextSetCustom(t *testing.T) {
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		span, _ := apm.StartSpan(ctx, "name", "type")
+		decision := map[string]interface{}{
+			"hit":     false,
+			"reason":  "expired",
+			"ttl.ms":  1500,
+			"sources": []interface{}{"l1", map[string]string{"a.b": "c"}},
+		}
+		span.Context.SetCustom("cache.decision", decision)
+		span.Context.SetCustom("attempts", 2)
+		span.Context.SetCustom("invalid", func() {}) // not JSON-encodable
+		decision["hit"] = true                       // not recorded
+		span.End()
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "attempts", Value: float64(2)},
+		{Key: "cache_decision", Value: map[string]interface{}{
+			"hit":     false,
+			"reason":  "expired",
+			"ttl_ms":  float64(1500),
+			"sources": []interface{}{"l1", map[string]interface{}{"a_b": "c"}},
+		}},
+	}, spans[0].Context.Custom)
+	assert.Nil(t, spans[0].Context.Tags)
+}
+
+func TestSpanContextSetCustomSizeLimit(t *testing.T) {
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		span, _ := apm.StartSpan(ctx, "name", "type")
+		span.Context.SetCustom("a", strings.Repeat("x", 6000))
+		span.Context.SetCustom("b", strings.Repeat("x", 6000)) // exceeds limit
+		span.Context.SetCustom("c", "small")
+		span.End()
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "a", Value: strings.Repeat("x", 6000)},
+		{Key: "c", Value: "small"},
+	}, spans[0].Context.Custom)
+}
+
 func TestSpanContextSetHTTPRequest(t *testing.T) {
 	type testcase struct {
 		url string
@@ -122,3 +166,63 @@ func TestSpanContextSetHTTPRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestSpanContextSetServiceTarget(t *testing.T) {
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		span, _ := apm.StartSpan(ctx, "name", "db.redis")
+		span.Context.SetServiceTarget(apm.ServiceTargetSpanContext{Type: "redis", Name: "cache"})
+		span.End()
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, &model.SpanContext{
+		Service: &model.ServiceSpanContext{
+			Target: &model.ServiceTargetSpanContext{Type: "redis", Name: "cache"},
+		},
+	}, spans[0].Context)
+}
+
+func TestSpanContextDefaultServiceTarget(t *testing.T) {
+	url, err := url.Parse("http://testing.invalid:8080/foo")
+	require.NoError(t, err)
+
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		span, _ := apm.StartSpan(ctx, "name", "external.http")
+		span.Context.SetHTTPRequest(&http.Request{URL: url})
+		span.End()
+
+		span, _ = apm.StartSpan(ctx, "name", "db.postgresql.query")
+		span.Context.SetDestinationService(apm.DestinationServiceSpanContext{Name: "postgresql", Resource: "postgresql"})
+		span.Context.SetDatabase(apm.DatabaseSpanContext{Instance: "customers"})
+		span.End()
+
+		span, _ = apm.StartSpan(ctx, "name", "custom")
+		span.Context.SetDestinationService(apm.DestinationServiceSpanContext{Name: "custom", Resource: "custom"})
+		span.End()
+
+		// An explicitly set service target is not overridden.
+		span, _ = apm.StartSpan(ctx, "name", "db.postgresql.query")
+		span.Context.SetDestinationService(apm.DestinationServiceSpanContext{Name: "postgresql", Resource: "postgresql"})
+		span.Context.SetServiceTarget(apm.ServiceTargetSpanContext{Type: "postgresql", Name: "override"})
+		span.End()
+
+		// The service target is not derived without a destination service.
+		span, _ = apm.StartSpan(ctx, "name", "db.postgresql.query")
+		span.Context.SetDatabase(apm.DatabaseSpanContext{Instance: "customers"})
+		span.End()
+	})
+	require.Len(t, spans, 5)
+
+	targets := make([]*model.ServiceTargetSpanContext, len(spans))
+	for i, span := range spans {
+		if span.Context.Service != nil {
+			targets[i] = span.Context.Service.Target
+		}
+	}
+	assert.Equal(t, []*model.ServiceTargetSpanContext{
+		{Type: "http", Name: "testing.invalid:8080"},
+		{Type: "postgresql", Name: "customers"},
+		{Type: "custom"},
+		{Type: "postgresql", Name: "override"},
+		nil,
+	}, targets)
+}
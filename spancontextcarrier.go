@@ -0,0 +1,137 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SpanContextCarrierTraceparentKey is the SpanContextCarrier key
+	// holding the W3C Trace-Context traceparent value.
+	SpanContextCarrierTraceparentKey = "traceparent"
+
+	// SpanContextCarrierTracestateKey is the SpanContextCarrier key
+	// holding the W3C Trace-Context tracestate value.
+	SpanContextCarrierTracestateKey = "tracestate"
+)
+
+// SpanContextCarrier is a map-like carrier for propagating trace context
+// within a process, e.g. alongside an item placed on an in-process work
+// queue. It is the in-process analog of HTTP trace context propagation:
+// the producer injects the trace context of its current span or
+// transaction, and the consumer extracts it to use as the parent of the
+// transaction or span it starts.
+//
+// Values are stored in the W3C Trace-Context format, so a carrier may
+// also be serialized and passed across process boundaries.
+type SpanContextCarrier map[string]string
+
+// InjectSpanContext returns a new SpanContextCarrier holding the trace
+// context of the span or transaction in ctx, or nil if ctx contains no
+// transaction.
+//
+// If ctx contains a non-dropped span, then its trace context is injected;
+// otherwise the trace context of the transaction is injected.
+func InjectSpanContext(ctx context.Context) SpanContextCarrier {
+	tx := TransactionFromContext(ctx)
+	if tx == nil {
+		return nil
+	}
+	traceContext := tx.TraceContext()
+	if span := SpanFromContext(ctx); span != nil && !span.Dropped() {
+		traceContext = span.TraceContext()
+	}
+	c := make(SpanContextCarrier, 2)
+	c.Inject(traceContext)
+	return c
+}
+
+// Inject sets the entries of c to propagate the given trace context,
+// replacing any existing trace context entries.
+func (c SpanContextCarrier) Inject(traceContext TraceContext) {
+	c[SpanContextCarrierTraceparentKey] = fmt.Sprintf(
+		"%02x-%032x-%016x-%02x", 0,
+		traceContext.Trace[:], traceContext.Span[:], traceContext.Options,
+	)
+	if tracestate := traceContext.State.String(); tracestate != "" {
+		c[SpanContextCarrierTracestateKey] = tracestate
+	} else {
+		delete(c, SpanContextCarrierTracestateKey)
+	}
+}
+
+// Extract returns the trace context held in c, and a boolean indicating
+// whether c holds a valid trace context. The returned trace context may
+// be used as TransactionOptions.TraceContext or SpanOptions.Parent.
+//
+// Invalid tracestate entries are discarded, without invalidating the
+// trace context.
+func (c SpanContextCarrier) Extract() (TraceContext, bool) {
+	traceContext, ok := parseCarrierTraceparent(c[SpanContextCarrierTraceparentKey])
+	if !ok {
+		return TraceContext{}, false
+	}
+	if tracestate := c[SpanContextCarrierTracestateKey]; tracestate != "" {
+		state := parseCarrierTracestate(tracestate)
+		if state.Validate() == nil {
+			traceContext.State = state
+		}
+	}
+	return traceContext, true
+}
+
+// parseCarrierTraceparent parses a version 00 traceparent value.
+func parseCarrierTraceparent(v string) (TraceContext, bool) {
+	var out TraceContext
+	// version "-" trace-id "-" span-id "-" trace-options
+	const length = 2 + 1 + 32 + 1 + 16 + 1 + 2
+	if len(v) != length || !strings.HasPrefix(v, "00-") || v[35] != '-' || v[52] != '-' {
+		return out, false
+	}
+	if _, err := hex.Decode(out.Trace[:], []byte(v[3:35])); err != nil || out.Trace.Validate() != nil {
+		return out, false
+	}
+	if _, err := hex.Decode(out.Span[:], []byte(v[36:52])); err != nil || out.Span.Validate() != nil {
+		return out, false
+	}
+	var options [1]byte
+	if _, err := hex.Decode(options[:], []byte(v[53:])); err != nil {
+		return out, false
+	}
+	out.Options = TraceOptions(options[0])
+	return out, true
+}
+
+// parseCarrierTracestate parses a comma-separated list of
+// tracestate key/value pairs, skipping malformed entries.
+func parseCarrierTracestate(v string) TraceState {
+	var entries []TraceStateEntry
+	for _, kv := range strings.Split(v, ",") {
+		kv = strings.TrimSpace(kv)
+		equal := strings.IndexRune(kv, '=')
+		if equal == -1 {
+			continue
+		}
+		entries = append(entries, TraceStateEntry{Key: kv[:equal], Value: kv[equal+1:]})
+	}
+	return NewTraceState(entries...)
+}
@@ -0,0 +1,144 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestSpanContextCarrierQueueHandoff(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	type workItem struct {
+		value   string
+		carrier apm.SpanContextCarrier
+	}
+	queue := make(chan workItem)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for item := range queue {
+			traceContext, ok := item.carrier.Extract()
+			assert.True(t, ok)
+			tx := tracer.StartTransactionOptions("consume", "messaging", apm.TransactionOptions{
+				TraceContext: traceContext,
+			})
+			ctx := apm.ContextWithTransaction(context.Background(), tx)
+			span, _ := apm.StartSpan(ctx, "process "+item.value, "app")
+			span.End()
+			tx.End()
+		}
+	}()
+
+	tx := tracer.StartTransaction("produce", "request")
+	ctx := apm.ContextWithTransaction(context.Background(), tx)
+	span, ctx := apm.StartSpan(ctx, "enqueue", "messaging")
+	queue <- workItem{value: "foo", carrier: apm.InjectSpanContext(ctx)}
+	span.End()
+	tx.End()
+	close(queue)
+	<-done
+
+	tracer.Flush(nil)
+	payloads := recorder.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	require.Len(t, payloads.Spans, 2)
+
+	var producerTx, consumerTx = payloads.Transactions[0], payloads.Transactions[1]
+	if producerTx.Name != "produce" {
+		producerTx, consumerTx = consumerTx, producerTx
+	}
+	producerSpan, consumerSpan := payloads.Spans[0], payloads.Spans[1]
+	if producerSpan.Name != "enqueue" {
+		producerSpan, consumerSpan = consumerSpan, producerSpan
+	}
+
+	assert.Equal(t, producerTx.TraceID, consumerTx.TraceID)
+	assert.Equal(t, producerSpan.ID, consumerTx.ParentID)
+	assert.Equal(t, consumerTx.TraceID, consumerSpan.TraceID)
+	assert.Equal(t, consumerTx.ID, consumerSpan.ParentID)
+}
+
+func TestSpanContextCarrierTransactionOnly(t *testing.T) {
+	tracer := apmtest.NewDiscardTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.End()
+	carrier := apm.InjectSpanContext(apm.ContextWithTransaction(context.Background(), tx))
+	traceContext, ok := carrier.Extract()
+	require.True(t, ok)
+	assert.Equal(t, tx.TraceContext().Trace, traceContext.Trace)
+	assert.Equal(t, tx.TraceContext().Span, traceContext.Span)
+	assert.Equal(t, tx.TraceContext().Options, traceContext.Options)
+	assert.Equal(t, tx.TraceContext().State.String(), traceContext.State.String())
+}
+
+func TestSpanContextCarrierEmpty(t *testing.T) {
+	assert.Nil(t, apm.InjectSpanContext(context.Background()))
+
+	var carrier apm.SpanContextCarrier
+	_, ok := carrier.Extract()
+	assert.False(t, ok)
+}
+
+func TestSpanContextCarrierInvalid(t *testing.T) {
+	for _, traceparent := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"00-0af7651916cd43dd8448eb211c80319x-b7ad6b7169203331-01",
+	} {
+		carrier := apm.SpanContextCarrier{apm.SpanContextCarrierTraceparentKey: traceparent}
+		_, ok := carrier.Extract()
+		assert.False(t, ok, traceparent)
+	}
+}
+
+func TestSpanContextCarrierTracestate(t *testing.T) {
+	carrier := apm.SpanContextCarrier{
+		apm.SpanContextCarrierTraceparentKey: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		apm.SpanContextCarrierTracestateKey:  "vendor=value, es=s:1",
+	}
+	traceContext, ok := carrier.Extract()
+	require.True(t, ok)
+	assert.True(t, traceContext.Options.Recorded())
+	assert.Equal(t, "vendor=value,es=s:1", traceContext.State.String())
+
+	// Invalid tracestate is discarded, but the trace context is retained.
+	carrier[apm.SpanContextCarrierTracestateKey] = "!nvalid=value"
+	traceContext, ok = carrier.Extract()
+	require.True(t, ok)
+	assert.Equal(t, "", traceContext.State.String())
+
+	// Re-injecting a trace context without state removes the stale entry.
+	carrier.Inject(traceContext)
+	assert.NotContains(t, carrier, apm.SpanContextCarrierTracestateKey)
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", carrier[apm.SpanContextCarrierTraceparentKey])
+}
@@ -0,0 +1,161 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"fmt"
+	"reflect"
+)
+
+const (
+	// MaxStructLabels is the maximum number of labels recorded
+	// by a single call to SetLabelsFromStruct.
+	MaxStructLabels = 32
+
+	// structLabelTag is the struct tag key used for naming
+	// labels recorded by SetLabelsFromStruct.
+	structLabelTag = "apm"
+
+	// maxStructLabelsDepth is the maximum depth of nested
+	// structs traversed by SetLabelsFromStruct.
+	maxStructLabelsDepth = 8
+)
+
+var rtypeStringer = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// SetLabelsFromStruct sets labels in the context from the fields of
+// v, which must be a struct or a pointer to a struct; see the Context
+// method of the same name for details.
+func (c *SpanContext) SetLabelsFromStruct(v interface{}) {
+	structLabels(v, c.SetLabel)
+}
+
+// SetLabelsFromStruct sets labels in the context from the fields of
+// v, which must be a struct or a pointer to a struct. If v is nil or
+// is not a struct, SetLabelsFromStruct does nothing.
+//
+// Only exported fields with an "apm" struct tag are recorded, using
+// the tag value as the label key, e.g.
+//
+//	type CacheOp struct {
+//		Key   string `apm:"cache_key"`
+//		Hit   bool   `apm:"cache_hit"`
+//		value []byte // unexported, skipped
+//		Size  int    // untagged, skipped
+//	}
+//
+// Fields holding structs, or pointers to structs, are traversed if
+// they are tagged, with the keys of their labels prefixed by the tag
+// value and an underscore. Untagged embedded structs are traversed
+// with no prefix. Structs implementing fmt.Stringer are recorded as
+// strings rather than traversed. A tag value of "-" causes the field
+// to be skipped.
+//
+// Label values are converted and truncated as described for SetLabel,
+// and at most MaxStructLabels labels are recorded.
+func (c *Context) SetLabelsFromStruct(v interface{}) {
+	structLabels(v, c.SetLabel)
+}
+
+// structLabels calls setLabel for each of the labels described by
+// the struct v, as described for Context.SetLabelsFromStruct.
+func structLabels(v interface{}, setLabel func(key string, value interface{})) {
+	rv := reflect.ValueOf(v)
+	n := 0
+	visitStructLabels(rv, "", 0, func(key string, value interface{}) bool {
+		if n == MaxStructLabels {
+			return false
+		}
+		setLabel(key, value)
+		n++
+		return true
+	})
+}
+
+// visitStructLabels calls f for each label described by the struct
+// rv, prefixing label keys with the given prefix. If f returns false,
+// visitStructLabels returns false and no further labels are visited.
+func visitStructLabels(rv reflect.Value, prefix string, depth int, f func(string, interface{}) bool) bool {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return true
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || depth > maxStructLabelsDepth {
+		return true
+	}
+	rtype := rv.Type()
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		tag, tagged := field.Tag.Lookup(structLabelTag)
+		if tag == "-" {
+			continue
+		}
+		if field.PkgPath != "" && !field.Anonymous {
+			// Unexported field. The exported fields of
+			// unexported embedded structs are visited.
+			continue
+		}
+		if !tagged || field.PkgPath != "" {
+			if field.Anonymous && !isStructLabelLeaf(field.Type) {
+				if !visitStructLabels(rv.Field(i), prefix, depth+1, f) {
+					return false
+				}
+			}
+			continue
+		}
+		key := prefix + tag
+		fieldValue := rv.Field(i)
+		if !isStructLabelLeaf(field.Type) {
+			if !visitStructLabels(fieldValue, key+"_", depth+1, f) {
+				return false
+			}
+			continue
+		}
+		switch fieldValue.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if fieldValue.IsNil() {
+				continue
+			}
+			if fieldValue.Kind() == reflect.Ptr && !field.Type.Implements(rtypeStringer) {
+				// Record the value pointed to, rather than the pointer.
+				fieldValue = fieldValue.Elem()
+			}
+		}
+		if !f(key, fieldValue.Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// isStructLabelLeaf reports whether values of type t should be recorded
+// as label values, as opposed to being traversed for nested labels.
+func isStructLabelLeaf(t reflect.Type) bool {
+	if t.Implements(rtypeStringer) {
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if t.Implements(rtypeStringer) {
+			return true
+		}
+	}
+	return t.Kind() != reflect.Struct
+}
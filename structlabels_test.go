@@ -0,0 +1,147 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/apmtest"
+	"go.elastic.co/apm/model"
+)
+
+type cacheOp struct {
+	cacheOpMeta
+
+	Key      string        `apm:"cache.key"`
+	Hit      bool          `apm:"cache_hit"`
+	Size     int           `apm:"cache_size"`
+	TTL      *int          `apm:"cache_ttl"`
+	Expiry   *int          `apm:"cache_expiry"`
+	Took     time.Duration `apm:"took"`
+	Server   server        `apm:"server"`
+	Replica  *server       `apm:"replica"`
+	Fallback *server       `apm:"fallback"`
+	Ignored  string        `apm:"-"`
+	Untagged string
+	value    string `apm:"value"`
+}
+
+type cacheOpMeta struct {
+	Op string `apm:"op"`
+}
+
+type server struct {
+	Host string `apm:"host"`
+	Port int    `apm:"port"`
+}
+
+func TestSpanContextSetLabelsFromStruct(t *testing.T) {
+	ttl := 60
+	op := &cacheOp{
+		cacheOpMeta: cacheOpMeta{Op: "get"},
+		Key:         "user:123",
+		Hit:         true,
+		Size:        1024,
+		TTL:         &ttl,
+		Took:        time.Millisecond,
+		Server:      server{Host: "cache1", Port: 6379},
+		Replica:     &server{Host: "cache2", Port: 6380},
+		Ignored:     "ignored",
+		Untagged:    "untagged",
+		value:       "unexported",
+	}
+	_, spans, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		span, _ := apm.StartSpan(ctx, "name", "type")
+		span.Context.SetLabelsFromStruct(op)
+		span.End()
+	})
+	require.Len(t, spans, 1)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "cache_hit", Value: true},
+		{Key: "cache_key", Value: "user:123"},
+		{Key: "cache_size", Value: float64(1024)},
+		{Key: "cache_ttl", Value: float64(60)},
+		{Key: "op", Value: "get"},
+		{Key: "replica_host", Value: "cache2"},
+		{Key: "replica_port", Value: float64(6380)},
+		{Key: "server_host", Value: "cache1"},
+		{Key: "server_port", Value: float64(6379)},
+		{Key: "took", Value: float64(time.Millisecond)},
+	}, spans[0].Context.Tags)
+}
+
+func TestContextSetLabelsFromStruct(t *testing.T) {
+	tx, _, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		tx := apm.TransactionFromContext(ctx)
+		tx.Context.SetLabelsFromStruct(struct {
+			Name    string       `apm:"name"`
+			Address fmt.Stringer `apm:"address"`
+			Host    *hostname    `apm:"host"`
+		}{
+			Name:    strings.Repeat("x", 2000),
+			Address: hostname("example.com"),
+			Host:    &hostPtr,
+		})
+		// Non-struct values are ignored.
+		tx.Context.SetLabelsFromStruct(nil)
+		tx.Context.SetLabelsFromStruct((*cacheOp)(nil))
+		tx.Context.SetLabelsFromStruct("string")
+	})
+	assert.Equal(t, model.IfaceMap{
+		{Key: "address", Value: "host:example.com"},
+		{Key: "host", Value: "host:ptr.example.com"},
+		{Key: "name", Value: strings.Repeat("x", 1024)},
+	}, tx.Context.Tags)
+}
+
+func TestSetLabelsFromStructLimit(t *testing.T) {
+	type inner struct {
+		A, B, C, D, E, F, G, H int `apm:"x"`
+	}
+	type outer struct {
+		I1 inner `apm:"i1"`
+		I2 inner `apm:"i2"`
+		I3 inner `apm:"i3"`
+		I4 inner `apm:"i4"`
+		I5 inner `apm:"i5"`
+	}
+	tx, _, _ := apmtest.WithTransaction(func(ctx context.Context) {
+		apm.TransactionFromContext(ctx).Context.SetLabelsFromStruct(outer{})
+	})
+	// Labels with duplicate keys are de-duplicated when decoded, so
+	// only the distinct keys of the first MaxStructLabels labels remain.
+	assert.Len(t, tx.Context.Tags, 4)
+	assert.Equal(t, "i4_x", tx.Context.Tags[3].Key)
+	assert.Equal(t, 32, apm.MaxStructLabels)
+}
+
+type hostname string
+
+func (h hostname) String() string {
+	return "host:" + string(h)
+}
+
+var hostPtr = hostname("ptr.example.com")
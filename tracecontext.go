@@ -21,7 +21,10 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
+	"strings"
 	"unicode"
 
 	"github.com/pkg/errors"
@@ -55,6 +58,10 @@ var (
 
 const (
 	traceOptionsRecordedFlag = 0x01
+
+	// elasticTracestateVendorKey is the vendor key for the Elastic
+	// tracestate entry, which holds the trace's sample rate.
+	elasticTracestateVendorKey = "es"
 )
 
 // TraceContext holds trace context for an incoming or outgoing request.
@@ -152,14 +159,26 @@ func (o TraceOptions) WithRecorded(recorded bool) TraceOptions {
 // TraceState holds vendor-specific state for a trace.
 type TraceState struct {
 	head *TraceStateEntry
+
+	// haveSampleRate and sampleRate hold the sample rate
+	// recorded in the Elastic ("es") entry, if any.
+	haveSampleRate bool
+	sampleRate     float64
 }
 
 // NewTraceState returns a TraceState based on entries.
+//
+// If entries contains an Elastic ("es") entry with a valid sample
+// rate, e.g. "es=s:0.5", then transactions continuing the trace
+// will record that sample rate.
 func NewTraceState(entries ...TraceStateEntry) TraceState {
 	out := TraceState{}
 	var last *TraceStateEntry
 	for _, e := range entries {
 		e := e // copy
+		if e.Key == elasticTracestateVendorKey {
+			out.sampleRate, out.haveSampleRate = parseElasticTracestateValue(e.Value)
+		}
 		if last == nil {
 			out.head = &e
 		} else {
@@ -211,6 +230,41 @@ func (s TraceState) Validate() error {
 	return nil
 }
 
+// parseElasticTracestateValue parses the value of an Elastic tracestate
+// entry, a semicolon-separated list of key:value pairs, returning the
+// sample rate held in the "s" attribute, and a boolean indicating whether
+// a valid sample rate was found.
+func parseElasticTracestateValue(v string) (float64, bool) {
+	for _, kv := range strings.Split(v, ";") {
+		colon := strings.IndexRune(kv, ':')
+		if colon == -1 || kv[:colon] != "s" {
+			continue
+		}
+		rate, err := strconv.ParseFloat(kv[colon+1:], 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return 0, false
+		}
+		return rate, true
+	}
+	return 0, false
+}
+
+// formatElasticTracestateValue returns the value of an Elastic
+// tracestate entry recording the given sample rate.
+func formatElasticTracestateValue(sampleRate float64) string {
+	return "s:" + strconv.FormatFloat(sampleRate, 'g', -1, 64)
+}
+
+// roundSampleRate rounds r to 4 decimal places, the precision with
+// which sample rates are propagated and recorded. Non-zero rates are
+// rounded to at least 0.0001, so they are not mistaken for zero.
+func roundSampleRate(r float64) float64 {
+	if r > 0 && r < 0.0001 {
+		return 0.0001
+	}
+	return math.Round(r*10000) / 10000
+}
+
 // TraceStateEntry holds a trace state entry: a key/value pair
 // representing state for a vendor.
 type TraceStateEntry struct {
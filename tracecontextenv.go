@@ -0,0 +1,81 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+const (
+	// TraceparentEnv is the environment variable through which the
+	// W3C Trace-Context traceparent is propagated to child processes.
+	TraceparentEnv = "TRACEPARENT"
+
+	// TracestateEnv is the environment variable through which the
+	// W3C Trace-Context tracestate is propagated to child processes.
+	TracestateEnv = "TRACESTATE"
+)
+
+// InjectTraceContextEnv returns a copy of env, a list of environment
+// variables in the form "key=value" as used by os/exec.Cmd.Env, with the
+// TraceparentEnv and TracestateEnv variables set to propagate the trace
+// context of the span or transaction in ctx to a child process. Any
+// existing trace context variables in env are replaced.
+//
+// If ctx contains no transaction, env is returned unmodified, except that
+// any existing trace context variables are removed, so that a child process
+// does not continue an unrelated trace.
+//
+// Note that a nil os/exec.Cmd.Env causes the child process to inherit the
+// parent's environment; to extend it, pass os.Environ() as env.
+func InjectTraceContextEnv(ctx context.Context, env []string) []string {
+	out := make([]string, 0, len(env)+2)
+	for _, kv := range env {
+		if strings.HasPrefix(kv, TraceparentEnv+"=") || strings.HasPrefix(kv, TracestateEnv+"=") {
+			continue
+		}
+		out = append(out, kv)
+	}
+	carrier := InjectSpanContext(ctx)
+	if carrier == nil {
+		return out
+	}
+	out = append(out, TraceparentEnv+"="+carrier[SpanContextCarrierTraceparentKey])
+	if tracestate, ok := carrier[SpanContextCarrierTracestateKey]; ok {
+		out = append(out, TracestateEnv+"="+tracestate)
+	}
+	return out
+}
+
+// ExtractTraceContextEnv returns the trace context propagated to the
+// current process through the TraceparentEnv and TracestateEnv environment
+// variables, e.g. by a parent process using InjectTraceContextEnv, and a
+// boolean indicating whether a valid trace context was found.
+//
+// The returned trace context may be used as TransactionOptions.TraceContext
+// to continue the parent process's trace. Invalid tracestate values are
+// discarded, without invalidating the trace context.
+func ExtractTraceContextEnv() (TraceContext, bool) {
+	carrier := SpanContextCarrier{
+		SpanContextCarrierTraceparentKey: os.Getenv(TraceparentEnv),
+		SpanContextCarrierTracestateKey:  os.Getenv(TracestateEnv),
+	}
+	return carrier.Extract()
+}
@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/apmtest"
+)
+
+func TestInjectTraceContextEnv(t *testing.T) {
+	tracer := apmtest.NewDiscardTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransactionOptions("name", "type", apm.TransactionOptions{
+		TraceContext: apm.TraceContext{
+			Trace:   apm.TraceID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+			Span:    apm.SpanID{0, 1, 2, 3, 4, 5, 6, 7},
+			Options: apm.TraceOptions(0).WithRecorded(true),
+			State:   apm.NewTraceState(apm.TraceStateEntry{Key: "vendor", Value: "value"}),
+		},
+	})
+	defer tx.End()
+	span, ctx := apm.StartSpan(apm.ContextWithTransaction(context.Background(), tx), "name", "type")
+	defer span.End()
+
+	in := []string{"FOO=bar", "TRACEPARENT=stale", "TRACESTATE=stale"}
+	env := apm.InjectTraceContextEnv(ctx, in)
+	assert.Equal(t, []string{
+		"FOO=bar",
+		"TRACEPARENT=00-000102030405060708090a0b0c0d0e0f-" + span.TraceContext().Span.String() + "-01",
+		"TRACESTATE=vendor=value",
+	}, env)
+	assert.Equal(t, []string{"FOO=bar", "TRACEPARENT=stale", "TRACESTATE=stale"}, in) // unmodified
+}
+
+func TestInjectTraceContextEnvNoTransaction(t *testing.T) {
+	env := apm.InjectTraceContextEnv(context.Background(), []string{"FOO=bar", "TRACEPARENT=stale"})
+	assert.Equal(t, []string{"FOO=bar"}, env)
+}
+
+func TestExtractTraceContextEnv(t *testing.T) {
+	tracer := apmtest.NewDiscardTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransactionOptions("name", "type", apm.TransactionOptions{
+		TraceContext: apm.TraceContext{
+			Trace: apm.TraceID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+			Span:  apm.SpanID{0, 1, 2, 3, 4, 5, 6, 7},
+			State: apm.NewTraceState(apm.TraceStateEntry{Key: "vendor", Value: "value"}),
+		},
+	})
+	defer tx.End()
+	env := apm.InjectTraceContextEnv(apm.ContextWithTransaction(context.Background(), tx), nil)
+	require.Len(t, env, 2)
+	defer patchEnv(apm.TraceparentEnv, env[0][len(apm.TraceparentEnv)+1:])()
+	defer patchEnv(apm.TracestateEnv, env[1][len(apm.TracestateEnv)+1:])()
+
+	traceContext, ok := apm.ExtractTraceContextEnv()
+	require.True(t, ok)
+	assert.Equal(t, tx.TraceContext().Trace, traceContext.Trace)
+	assert.Equal(t, tx.TraceContext().Span, traceContext.Span)
+	assert.Equal(t, tx.TraceContext().Options, traceContext.Options)
+	assert.Equal(t, tx.TraceContext().State.String(), traceContext.State.String())
+}
+
+func TestExtractTraceContextEnvInvalid(t *testing.T) {
+	defer patchEnv(apm.TraceparentEnv, "")()
+	_, ok := apm.ExtractTraceContextEnv()
+	assert.False(t, ok)
+
+	defer patchEnv(apm.TraceparentEnv, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331")()
+	_, ok = apm.ExtractTraceContextEnv()
+	assert.False(t, ok)
+
+	// Invalid tracestate is discarded, but the trace context is retained.
+	defer patchEnv(apm.TraceparentEnv, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")()
+	defer patchEnv(apm.TracestateEnv, "!nvalid=value")()
+	traceContext, ok := apm.ExtractTraceContextEnv()
+	require.True(t, ok)
+	assert.Equal(t, "", traceContext.State.String())
+}
+
+func patchEnv(key, value string) func() {
+	old, had := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if had {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
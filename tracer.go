@@ -23,6 +23,7 @@ import (
 	"context"
 	"io"
 	"log"
+	"math"
 	"math/rand"
 	"sync"
 	"sync/atomic"
@@ -112,6 +113,8 @@ type TracerOptions struct {
 	configWatcher         apmconfig.Watcher
 	breakdownMetrics      bool
 	propagateLegacyHeader bool
+	spanCountLabels       bool
+	normalizeTxNames      bool
 	profileSender         profileSender
 	cpuProfileInterval    time.Duration
 	cpuProfileDuration    time.Duration
@@ -213,6 +216,16 @@ func (opts *TracerOptions) initDefaults(continueOnError bool) error {
 		propagateLegacyHeader = true
 	}
 
+	spanCountLabels, err := initialSpanCountLabels()
+	if failed(err) {
+		spanCountLabels = false
+	}
+
+	normalizeTxNames, err := initialNormalizeTransactionNames()
+	if failed(err) {
+		normalizeTxNames = false
+	}
+
 	cpuProfileInterval, cpuProfileDuration, err := initialCPUProfileIntervalDuration()
 	if failed(err) {
 		cpuProfileInterval = 0
@@ -254,6 +267,8 @@ func (opts *TracerOptions) initDefaults(continueOnError bool) error {
 	opts.active = active
 	opts.recording = recording
 	opts.propagateLegacyHeader = propagateLegacyHeader
+	opts.spanCountLabels = spanCountLabels
+	opts.normalizeTxNames = normalizeTxNames
 	if opts.Transport == nil {
 		opts.Transport = transport.Default
 	}
@@ -313,6 +328,8 @@ type Tracer struct {
 	system  *model.System
 
 	active            int32
+	activeTxs         activeTransactions
+	txTimeout         atomic.Value // transactionTimeoutConfig
 	bufferSize        int
 	metricsBufferSize int
 	closing           chan struct{}
@@ -359,6 +376,23 @@ func NewTracerOptions(opts TracerOptions) (*Tracer, error) {
 	return newTracer(opts), nil
 }
 
+// NewNoopTracer returns a new Tracer which never records or sends any
+// events, and which does not start any background goroutines.
+//
+// The returned Tracer implements the full API, so instrumentation may
+// be called unconditionally. Transactions and spans created by the
+// tracer are never sampled, and errors are never reported. The cost
+// of instrumenting with a no-op tracer is limited to allocating the
+// Transaction or Span objects returned to the caller; their data is
+// pooled and reused.
+//
+// NewNoopTracer is intended for libraries which want to offer optional
+// instrumentation, and need a non-nil Tracer to fall back to when the
+// application does not configure one.
+func NewNoopTracer() *Tracer {
+	return newTracer(TracerOptions{Transport: transport.Discard})
+}
+
 func newTracer(opts TracerOptions) *Tracer {
 	t := &Tracer{
 		Transport:         opts.Transport,
@@ -393,7 +427,10 @@ func newTracer(opts TracerOptions) *Tracer {
 		cfg.captureBody = opts.captureBody
 	})
 	t.setLocalInstrumentationConfig(envCaptureHeaders, func(cfg *instrumentationConfigValues) {
-		cfg.captureHeaders = opts.captureHeaders
+		cfg.captureHeaders = captureHeadersConfig{mode: CaptureHeadersOff}
+		if opts.captureHeaders {
+			cfg.captureHeaders.mode = CaptureHeadersAll
+		}
 	})
 	t.setLocalInstrumentationConfig(envMaxSpans, func(cfg *instrumentationConfigValues) {
 		cfg.maxSpans = opts.maxSpans
@@ -410,6 +447,15 @@ func newTracer(opts TracerOptions) *Tracer {
 	t.setLocalInstrumentationConfig(envUseElasticTraceparentHeader, func(cfg *instrumentationConfigValues) {
 		cfg.propagateLegacyHeader = opts.propagateLegacyHeader
 	})
+	t.setLocalInstrumentationConfig(envSpanCountLabels, func(cfg *instrumentationConfigValues) {
+		cfg.spanCountLabels = opts.spanCountLabels
+	})
+	t.setLocalInstrumentationConfig(envNormalizeTransactionNames, func(cfg *instrumentationConfigValues) {
+		cfg.normalizeTxNames = opts.normalizeTxNames
+	})
+	t.setLocalInstrumentationConfig(envLogLevel, func(cfg *instrumentationConfigValues) {
+		cfg.logLevel = ""
+	})
 
 	if !opts.active {
 		t.active = 0
@@ -441,6 +487,16 @@ func newTracer(opts TracerOptions) *Tracer {
 	return t
 }
 
+// maxEventSize returns the maximum size of an encoded event, as defined
+// by the tracer's transport, or zero if the transport does not limit the
+// size of events.
+func (t *Tracer) maxEventSize() int {
+	if sizer, ok := t.Transport.(interface{ MaxEventSize() int }); ok {
+		return sizer.MaxEventSize()
+	}
+	return 0
+}
+
 // tracerConfig holds the tracer's runtime configuration, which may be modified
 // by sending a tracerConfigCommand to the tracer's configCommands channel.
 type tracerConfig struct {
@@ -514,6 +570,15 @@ func (t *Tracer) SetRequestDuration(d time.Duration) {
 
 // SetMetricsInterval sets the metrics interval -- the amount of time in
 // between metrics samples being gathered.
+//
+// SetMetricsInterval may be called at any time to change the interval.
+// The next gathering will be rescheduled relative to the previous one,
+// occurring immediately if the new interval has already elapsed. If
+// metrics are being gathered when SetMetricsInterval is called, the new
+// interval will take effect once they have been gathered.
+//
+// If d is zero or negative, periodic metrics gathering will be disabled.
+// Metrics may still be sent by calling SendMetrics.
 func (t *Tracer) SetMetricsInterval(d time.Duration) {
 	t.sendConfigCommand(func(cfg *tracerConfig) {
 		cfg.metricsInterval = d
@@ -538,6 +603,10 @@ func (t *Tracer) SetContextSetter(setter stacktrace.ContextSetter) {
 // The tracer is initialized with a default logger configured with the
 // environment variables ELASTIC_APM_LOG_FILE and ELASTIC_APM_LOG_LEVEL.
 // Calling SetLogger will replace the default logger.
+//
+// If logger has a method "SetLevel(level string) error", it will be
+// called to apply log level changes from central configuration. An
+// empty level means the logger should restore its initial level.
 func (t *Tracer) SetLogger(logger Logger) {
 	t.sendConfigCommand(func(cfg *tracerConfig) {
 		cfg.logger = makeWarningLogger(logger)
@@ -673,9 +742,39 @@ func (t *Tracer) SetStackTraceLimit(limit int) {
 }
 
 // SetCaptureHeaders enables or disables capturing of HTTP headers.
+//
+// SetCaptureHeaders(true) is equivalent to SetCaptureHeadersMode(CaptureHeadersAll),
+// and SetCaptureHeaders(false) is equivalent to SetCaptureHeadersMode(CaptureHeadersOff).
 func (t *Tracer) SetCaptureHeaders(capture bool) {
-	t.setLocalInstrumentationConfig(envMaxSpans, func(cfg *instrumentationConfigValues) {
-		cfg.captureHeaders = capture
+	mode := CaptureHeadersOff
+	if capture {
+		mode = CaptureHeadersAll
+	}
+	t.SetCaptureHeadersMode(mode)
+}
+
+// SetSpanCountLabels enables or disables recording, for each sampled
+// transaction, the number of spans started within it for each span type.
+// The counts are recorded as transaction labels named "<type>_calls",
+// e.g. "db_calls" and "external_calls", and include spans dropped due to
+// the transaction's span limit.
+func (t *Tracer) SetSpanCountLabels(enabled bool) {
+	t.setLocalInstrumentationConfig(envSpanCountLabels, func(cfg *instrumentationConfigValues) {
+		cfg.spanCountLabels = enabled
+	})
+}
+
+// SetNormalizeTransactionNames enables or disables normalization of
+// transaction names when transactions are ended. When enabled, runs of
+// whitespace are replaced with a single space, and a leading HTTP method
+// is uppercased, such that "get  /users" becomes "GET /users". The rest
+// of the name, such as the path, is left as-is.
+//
+// Normalization is disabled by default, to avoid changing the grouping
+// of existing transactions.
+func (t *Tracer) SetNormalizeTransactionNames(enabled bool) {
+	t.setLocalInstrumentationConfig(envNormalizeTransactionNames, func(cfg *instrumentationConfigValues) {
+		cfg.normalizeTxNames = enabled
 	})
 }
 
@@ -686,6 +785,28 @@ func (t *Tracer) SetCaptureBody(mode CaptureBodyMode) {
 	})
 }
 
+// SetMaxActiveTransactions sets the maximum number of transactions
+// that may be active (started, but not yet ended or discarded) at
+// any one time. This is a safety valve protecting against memory
+// exhaustion due to leaked transactions, e.g. because of a bug that
+// starts transactions without ending them.
+//
+// When the limit is reached, StartTransaction returns a non-recording
+// transaction, which will not be reported, and the TransactionsRejected
+// statistic is incremented. A warning is logged the first time the limit
+// is reached.
+//
+// Passing in zero or a negative value will remove the limit, which is
+// the default.
+func (t *Tracer) SetMaxActiveTransactions(n int) {
+	if n < 0 {
+		n = 0
+	} else if n > math.MaxInt32 {
+		n = math.MaxInt32
+	}
+	atomic.StoreInt32(&t.activeTxs.max, int32(n))
+}
+
 // SendMetrics forces the tracer to gather and send metrics immediately,
 // blocking until the metrics have been sent or the abort channel is
 // signalled.
@@ -708,6 +829,7 @@ func (t *Tracer) Stats() TracerStats {
 	t.statsMu.Lock()
 	stats := t.stats
 	t.statsMu.Unlock()
+	stats.TransactionsActive = uint64(atomic.LoadInt32(&t.activeTxs.count))
 	return stats
 }
 
@@ -797,6 +919,7 @@ func (t *Tracer) loop() {
 		metricsBuffer: metricsBuffer,
 		cfg:           &cfg,
 		stats:         &stats,
+		maxEventSize:  t.maxEventSize,
 	}
 
 	handleTracerConfigCommand := func(cmd tracerConfigCommand) {
@@ -905,6 +1028,10 @@ func (t *Tracer) loop() {
 				modelWriter.writeError(event.err)
 				// Flush the buffer to transmit the error immediately.
 				flushRequest = true
+			case metricsetEvent:
+				modelWriter.writeMetricset(event.metricset)
+				// Flush the buffer to transmit the metricset immediately.
+				flushRequest = true
 			}
 		case <-requestTimer.C:
 			requestTimerActive = false
@@ -955,6 +1082,8 @@ func (t *Tracer) loop() {
 					modelWriter.writeSpan(event.span.Span, event.span.SpanData)
 				case errorEvent:
 					modelWriter.writeError(event.err)
+				case metricsetEvent:
+					modelWriter.writeMetricset(event.metricset)
 				}
 			}
 			if !requestActive && buffer.Len() == 0 && metricsBuffer.Len() == 0 {
@@ -1159,9 +1288,9 @@ func (t *Tracer) encodeRequestMetadata(json *fastjson.Writer) {
 	t.process.MarshalFastJSON(json)
 	json.RawString(`,"service":`)
 	service.MarshalFastJSON(json)
-	if len(globalLabels) > 0 {
+	if len(metadataLabels) > 0 {
 		json.RawString(`,"labels":`)
-		globalLabels.MarshalFastJSON(json)
+		metadataLabels.MarshalFastJSON(json)
 	}
 	json.RawByte('}')
 }
@@ -1197,6 +1326,7 @@ const (
 	transactionEvent tracerEventType = iota
 	spanEvent
 	errorEvent
+	metricsetEvent
 )
 
 type tracerEvent struct {
@@ -1215,6 +1345,9 @@ type tracerEvent struct {
 		*TransactionData
 	}
 
+	// metricset is set only if eventType == metricsetEvent.
+	metricset *model.Metrics
+
 	// span is set only if eventType == spanEvent.
 	span struct {
 		*Span
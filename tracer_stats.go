@@ -26,6 +26,15 @@ type TracerStats struct {
 	TransactionsDropped uint64
 	SpansSent           uint64
 	SpansDropped        uint64
+
+	// TransactionsActive holds the number of transactions that have
+	// been started, but not yet ended or discarded.
+	TransactionsActive uint64
+
+	// TransactionsRejected holds the number of transactions that were
+	// not recorded because the limit set by SetMaxActiveTransactions
+	// had been reached.
+	TransactionsRejected uint64
 }
 
 // TracerStatsErrors holds error statistics for a Tracer.
@@ -49,4 +58,5 @@ func (s *TracerStats) accumulate(rhs TracerStats) {
 	s.SpansDropped += rhs.SpansDropped
 	s.TransactionsSent += rhs.TransactionsSent
 	s.TransactionsDropped += rhs.TransactionsDropped
+	s.TransactionsRejected += rhs.TransactionsRejected
 }
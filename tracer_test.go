@@ -57,6 +57,206 @@ func TestTracerStats(t *testing.T) {
 	}, tracer.Stats())
 }
 
+func TestTracerMaxActiveTransactions(t *testing.T) {
+	tracer := apmtest.NewDiscardTracer()
+	defer tracer.Close()
+	logger := warningsLogger(make(chan string, 10))
+	tracer.SetLogger(logger)
+	tracer.SetMaxActiveTransactions(2)
+
+	tx1 := tracer.StartTransaction("name", "type")
+	tx2 := tracer.StartTransaction("name", "type")
+	tx3 := tracer.StartTransaction("name", "type")
+	tx4 := tracer.StartTransaction("name", "type")
+	assert.True(t, tx1.Sampled())
+	assert.True(t, tx2.Sampled())
+	assert.False(t, tx3.Sampled())
+	assert.False(t, tx4.Sampled())
+
+	stats := tracer.Stats()
+	assert.Equal(t, uint64(2), stats.TransactionsActive)
+	assert.Equal(t, uint64(2), stats.TransactionsRejected)
+
+	// Ending a rejected transaction does not make room for more.
+	tx3.End()
+	assert.False(t, tracer.StartTransaction("name", "type").Sampled())
+
+	tx1.End()
+	tx2.Discard()
+	assert.Equal(t, uint64(0), tracer.Stats().TransactionsActive)
+	tx5 := tracer.StartTransaction("name", "type")
+	assert.True(t, tx5.Sampled())
+	tx5.End()
+
+	// Removing the limit allows an unlimited number of active transactions.
+	tracer.SetMaxActiveTransactions(0)
+	var txs []*apm.Transaction
+	for i := 0; i < 10; i++ {
+		txs = append(txs, tracer.StartTransaction("name", "type"))
+	}
+	assert.Equal(t, uint64(10), tracer.Stats().TransactionsActive)
+	for _, tx := range txs {
+		assert.True(t, tx.Sampled())
+		tx.End()
+	}
+	tracer.Flush(nil)
+
+	stats = tracer.Stats()
+	assert.Equal(t, uint64(0), stats.TransactionsActive)
+	assert.Equal(t, uint64(3), stats.TransactionsRejected)
+	assert.Equal(t, uint64(12), stats.TransactionsSent)
+
+	// The warning is logged only once.
+	select {
+	case msg := <-logger:
+		assert.Equal(t, "the limit of 2 active transactions has been reached, no new transactions will be recorded until active transactions end", msg)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for warning")
+	}
+	tracer.SendMetrics(nil)
+	assert.Len(t, logger, 0)
+}
+
+func TestTracerTransactionTimeout(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetTransactionTimeout(10 * time.Millisecond)
+
+	tx := tracer.StartTransaction("name", "type")
+	var errs []model.Error
+	for len(errs) == 0 {
+		time.Sleep(10 * time.Millisecond)
+		tracer.Flush(nil)
+		errs = recorder.Payloads().Errors
+	}
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := recorder.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	require.Len(t, payloads.Errors, 1)
+	err := payloads.Errors[0]
+	assert.Equal(t, `transaction "name" exceeded timeout of 10ms`, err.Log.Message)
+	assert.Equal(t, "warning", err.Log.Level)
+	assert.Equal(t, payloads.Transactions[0].ID, err.ParentID)
+	assert.Equal(t, payloads.Transactions[0].ID, err.TransactionID)
+	assert.Equal(t, payloads.Transactions[0].TraceID, err.TraceID)
+	assert.Nil(t, err.Context)
+
+	// Transactions ending within the timeout are not reported.
+	recorder.ResetPayloads()
+	tracer.StartTransaction("name", "type").End()
+	time.Sleep(20 * time.Millisecond)
+	tracer.Flush(nil)
+	assert.Empty(t, recorder.Payloads().Errors)
+}
+
+func TestTracerTransactionTimeoutStackDump(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetTransactionTimeout(10*time.Millisecond, apm.WithTimeoutStackDump())
+
+	tx := tracer.StartTransaction("name", "type")
+	defer tx.End()
+	var errs []model.Error
+	for len(errs) == 0 {
+		time.Sleep(10 * time.Millisecond)
+		tracer.Flush(nil)
+		errs = recorder.Payloads().Errors
+	}
+	require.NotNil(t, errs[0].Context)
+	require.Len(t, errs[0].Context.Custom, 1)
+	assert.Equal(t, "goroutines", errs[0].Context.Custom[0].Key)
+	dump, ok := errs[0].Context.Custom[0].Value.(string)
+	require.True(t, ok)
+	assert.Contains(t, dump, "TestTracerTransactionTimeoutStackDump")
+	assert.True(t, len(dump) <= apm.MaxTimeoutStackDumpSize)
+}
+
+type warningsLogger chan string
+
+func (warningsLogger) Debugf(format string, args ...interface{}) {}
+func (warningsLogger) Errorf(format string, args ...interface{}) {}
+func (l warningsLogger) Warningf(format string, args ...interface{}) {
+	l <- fmt.Sprintf(format, args...)
+}
+
+func TestNoopTracer(t *testing.T) {
+	tracer := apm.NewNoopTracer()
+	defer tracer.Close()
+	assert.False(t, tracer.Active())
+	assert.False(t, tracer.Recording())
+
+	tx := tracer.StartTransaction("name", "type")
+	assert.False(t, tx.Sampled())
+	span := tx.StartSpan("name", "type", nil)
+	assert.True(t, span.Dropped())
+	span.End()
+	tx.End()
+
+	// Only the returned Transaction and Span objects are allocated;
+	// everything else is pooled. The race detector makes additional
+	// allocations, so the counts are only checked without it.
+	if !raceEnabled {
+		allocs := testing.AllocsPerRun(100, func() {
+			tx := tracer.StartTransaction("name", "type")
+			span := tx.StartSpan("name", "type", nil)
+			span.End()
+			tx.End()
+		})
+		assert.Equal(t, float64(2), allocs)
+
+		allocs = testing.AllocsPerRun(100, func() {
+			span, _ := apm.StartSpan(context.Background(), "name", "type")
+			span.End()
+		})
+		assert.Equal(t, float64(1), allocs)
+	}
+
+	stats := tracer.Stats()
+	assert.Zero(t, stats.TransactionsSent)
+	assert.Zero(t, stats.SpansSent)
+}
+
+func BenchmarkNoopTracer(b *testing.B) {
+	tracer := apm.NewNoopTracer()
+	defer tracer.Close()
+
+	b.Run("transaction", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tx := tracer.StartTransaction("name", "type")
+			tx.End()
+		}
+	})
+	b.Run("span", func(b *testing.B) {
+		tx := tracer.StartTransaction("name", "type")
+		defer tx.End()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			span := tx.StartSpan("name", "type", nil)
+			span.End()
+		}
+	})
+	b.Run("span_no_transaction", func(b *testing.B) {
+		ctx := context.Background()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			span, _ := apm.StartSpan(ctx, "name", "type")
+			span.End()
+		}
+	})
+	b.Run("error", func(b *testing.B) {
+		err := errors.New("boom")
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			e := tracer.NewError(err)
+			e.Send()
+		}
+	})
+}
+
 func TestTracerClosedSendNonblocking(t *testing.T) {
 	tracer, err := apm.NewTracer("tracer_testing", "")
 	assert.NoError(t, err)
@@ -488,6 +688,90 @@ func TestTracerCaptureHeaders(t *testing.T) {
 	}
 }
 
+func TestTracerCaptureHeadersMode(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+
+	req, err := http.NewRequest("GET", "http://testing.invalid", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Request-Id", "abc123")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "xyz"})
+	respHeaders := make(http.Header)
+	respHeaders.Set("Content-Type", "application/json")
+	respHeaders.Set("X-Powered-By", "Go")
+
+	type config struct {
+		mode      apm.CaptureHeadersMode
+		allowList []string
+	}
+	configs := []config{
+		{mode: apm.CaptureHeadersOff},
+		{mode: apm.CaptureHeadersAll},
+		{mode: apm.CaptureHeadersAllowList, allowList: []string{"content-type", "X-Request-*"}},
+		{mode: apm.CaptureHeadersAllowList, allowList: []string{"Cookie", "Authorization"}},
+	}
+	for _, cfg := range configs {
+		tracer.SetCaptureHeadersMode(cfg.mode, cfg.allowList...)
+		tx := tracer.StartTransaction("name", "type")
+		tx.Context.SetHTTPRequest(req)
+		tx.Context.SetHTTPResponseHeaders(respHeaders)
+		tx.Context.SetHTTPStatusCode(202)
+		tx.End()
+	}
+
+	tracer.Flush(nil)
+	payloads := recorder.Payloads()
+	require.Len(t, payloads.Transactions, len(configs))
+
+	headerKeys := func(headers model.Headers) []string {
+		var keys []string
+		for _, h := range headers {
+			keys = append(keys, h.Key)
+		}
+		return keys
+	}
+	cookieNames := func(cookies model.Cookies) []string {
+		var names []string
+		for _, c := range cookies {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	// CaptureHeadersOff: no headers, but cookies are still recorded
+	// for backwards compatibility.
+	tx := payloads.Transactions[0]
+	assert.Nil(t, tx.Context.Request.Headers)
+	assert.Nil(t, tx.Context.Response.Headers)
+	assert.Equal(t, []string{"session"}, cookieNames(tx.Context.Request.Cookies))
+
+	// CaptureHeadersAll: all headers, with sensitive values sanitized.
+	tx = payloads.Transactions[1]
+	assert.ElementsMatch(t, []string{"Authorization", "Content-Type", "X-Request-Id"}, headerKeys(tx.Context.Request.Headers))
+	assert.ElementsMatch(t, []string{"Content-Type", "X-Powered-By"}, headerKeys(tx.Context.Response.Headers))
+	assert.Equal(t, []string{"session"}, cookieNames(tx.Context.Request.Cookies))
+	for _, h := range tx.Context.Request.Headers {
+		if h.Key == "Authorization" {
+			assert.Equal(t, []string{"[REDACTED]"}, h.Values)
+		}
+	}
+
+	// CaptureHeadersAllowList: only matching headers, case-insensitively.
+	tx = payloads.Transactions[2]
+	assert.ElementsMatch(t, []string{"Content-Type", "X-Request-Id"}, headerKeys(tx.Context.Request.Headers))
+	assert.ElementsMatch(t, []string{"Content-Type"}, headerKeys(tx.Context.Response.Headers))
+	assert.Nil(t, tx.Context.Request.Cookies)
+
+	// Allowed headers are still subject to sanitization, and cookies
+	// are captured only when the Cookie header is allowed.
+	tx = payloads.Transactions[3]
+	assert.Equal(t, model.Headers{{Key: "Authorization", Values: []string{"[REDACTED]"}}}, tx.Context.Request.Headers)
+	assert.Nil(t, tx.Context.Response.Headers)
+	assert.Equal(t, []string{"session"}, cookieNames(tx.Context.Request.Cookies))
+}
+
 type blockedTransport struct {
 	transport.Transport
 	unblocked chan struct{}
@@ -21,7 +21,10 @@ import (
 	cryptorand "crypto/rand"
 	"encoding/binary"
 	"math/rand"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -60,12 +63,19 @@ func (t *Tracer) StartTransactionOptions(name, transactionType string, opts Tran
 	if !tx.recording {
 		return tx
 	}
+	if !t.activeTxs.acquire(t) {
+		tx.recording = false
+		return tx
+	}
+	tx.active = true
 
 	tx.maxSpans = instrumentationConfig.maxSpans
 	tx.spanFramesMinDuration = instrumentationConfig.spanFramesMinDuration
 	tx.stackTraceLimit = instrumentationConfig.stackTraceLimit
 	tx.Context.captureHeaders = instrumentationConfig.captureHeaders
 	tx.propagateLegacyHeader = instrumentationConfig.propagateLegacyHeader
+	tx.spanCountLabels = instrumentationConfig.spanCountLabels
+	tx.normalizeName = instrumentationConfig.normalizeTxNames
 	tx.breakdownMetricsEnabled = t.breakdownMetrics.enabled
 
 	var root bool
@@ -97,11 +107,27 @@ func (t *Tracer) StartTransactionOptions(name, transactionType string, opts Tran
 	}
 
 	if root {
-		sampler := instrumentationConfig.sampler
-		if sampler == nil || sampler.Sample(tx.traceContext) {
+		var result SampleResult
+		switch sampler := instrumentationConfig.sampler.(type) {
+		case nil:
+			result = SampleResult{Sampled: true, SampleRate: 1}
+			tx.hasSampleRate = true
+		case ExtendedSampler:
+			result = sampler.SampleExtended(SampleParams{TraceContext: tx.traceContext})
+			tx.hasSampleRate = true
+		default:
+			result.Sampled = sampler.Sample(tx.traceContext)
+		}
+		if result.Sampled {
 			o := tx.traceContext.Options.WithRecorded(true)
 			tx.traceContext.Options = o
+		} else {
+			// Non-sampled transactions are recorded and propagated
+			// with a sample rate of zero, as they are not used for
+			// extrapolation.
+			result.SampleRate = 0
 		}
+		tx.sampleRate = roundSampleRate(result.SampleRate)
 	} else {
 		// TODO(axw) make this behaviour configurable. In some cases
 		// it may not be a good idea to honour the recorded flag, as
@@ -109,6 +135,29 @@ func (t *Tracer) StartTransactionOptions(name, transactionType string, opts Tran
 		// Even ignoring bad actors, a service that has many feeder
 		// applications may end up being sampled at a very high rate.
 		tx.traceContext.Options = opts.TraceContext.Options
+
+		// Record the sample rate propagated by the root transaction.
+		if state := tx.traceContext.State; state.haveSampleRate {
+			tx.hasSampleRate = true
+			tx.sampleRate = state.sampleRate
+		}
+	}
+	if opts.ForceSampled {
+		if !tx.traceContext.Options.Recorded() {
+			// The transaction was not sampled according to
+			// the sample rate, so the rate does not apply.
+			tx.hasSampleRate = false
+		}
+		tx.traceContext.Options = tx.traceContext.Options.WithRecorded(true)
+	}
+	if root && tx.hasSampleRate {
+		// Propagate the sample rate to downstream services,
+		// so they record the rate with which the trace was
+		// sampled.
+		tx.traceContext.State = NewTraceState(TraceStateEntry{
+			Key:   elasticTracestateVendorKey,
+			Value: formatElasticTracestateValue(tx.sampleRate),
+		})
 	}
 
 	tx.Name = name
@@ -117,6 +166,8 @@ func (t *Tracer) StartTransactionOptions(name, transactionType string, opts Tran
 	if tx.timestamp.IsZero() {
 		tx.timestamp = time.Now()
 	}
+	t.startTimeoutTimer(tx)
+	tx.startHeartbeatTimer(opts.HeartbeatInterval)
 	return tx
 }
 
@@ -124,6 +175,11 @@ func (t *Tracer) StartTransactionOptions(name, transactionType string, opts Tran
 type TransactionOptions struct {
 	// TraceContext holds the TraceContext for a new transaction. If this is
 	// zero, a new trace will be started.
+	//
+	// If TraceContext holds a valid trace ID, the transaction will inherit
+	// the sampling decision from TraceContext.Options, rather than consulting
+	// the tracer's sampler. This ensures that a transaction whose parent was
+	// not sampled is also not sampled, so traces do not contain gaps.
 	TraceContext TraceContext
 
 	// TransactionID holds the ID to assign to the transaction. If this is
@@ -133,6 +189,22 @@ type TransactionOptions struct {
 	// Start is the start time of the transaction. If this has the
 	// zero value, time.Now() will be used instead.
 	Start time.Time
+
+	// ForceSampled, if true, forces the transaction to be sampled,
+	// regardless of the tracer's sampler or the sampling decision
+	// inherited from TraceContext. The transaction will still not be
+	// sampled if the tracer is not recording, or if the maximum number
+	// of active transactions has been reached.
+	//
+	// This is intended for on-demand tracing of individual operations,
+	// e.g. for debugging, and should not be used routinely.
+	ForceSampled bool
+
+	// HeartbeatInterval, if positive, is the interval at which heartbeats
+	// will be reported for the transaction until it is ended, as if by
+	// calling Transaction.Heartbeat. This is intended for long-running
+	// tasks, such as database migrations.
+	HeartbeatInterval time.Duration
 }
 
 // Transaction describes an event occurring in the monitored service.
@@ -213,6 +285,46 @@ func (tx *Transaction) EnsureParent() SpanID {
 	return tx.parentSpan
 }
 
+const (
+	// MaxFeatureFlags is the maximum number of feature flags
+	// recorded per transaction by Transaction.AddFeatureFlag.
+	MaxFeatureFlags = 32
+
+	featureFlagLabelPrefix = "flag_"
+)
+
+// AddFeatureFlag records the value of a feature flag evaluated during
+// the transaction, as a label with the key prefixed by "flag_".
+//
+// Each distinct flag value adds to the cardinality of labels stored by
+// the APM Server, so flags should have a small set of possible values
+// (e.g. boolean or variant names), and not user-specific values. At
+// most MaxFeatureFlags flags are recorded per transaction; AddFeatureFlag
+// returns false if the flag was not recorded because the limit has been
+// reached, or because tx is not sampled or has been ended. Recording a
+// flag again replaces its previously recorded value.
+func (tx *Transaction) AddFeatureFlag(key string, value interface{}) bool {
+	if !tx.Sampled() {
+		return false
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.ended() {
+		return false
+	}
+	if tx.Context.replaceLabel(featureFlagLabelPrefix+key, value) {
+		// The flag was already recorded; its value is replaced,
+		// and it does not count towards the limit again.
+		return true
+	}
+	if tx.featureFlags >= MaxFeatureFlags {
+		return false
+	}
+	tx.featureFlags++
+	tx.Context.SetLabel(featureFlagLabelPrefix+key, value)
+	return true
+}
+
 // Discard discards a previously started transaction.
 //
 // Calling Discard will set tx's TransactionData field to nil, so callers must
@@ -223,6 +335,15 @@ func (tx *Transaction) Discard() {
 	if tx.ended() {
 		return
 	}
+	if tx.active {
+		tx.tracer.activeTxs.release()
+	}
+	if tx.timeoutTimer != nil {
+		tx.timeoutTimer.Stop()
+	}
+	if tx.heartbeatTimer != nil {
+		tx.heartbeatTimer.Stop()
+	}
 	tx.reset(tx.tracer)
 }
 
@@ -239,10 +360,25 @@ func (tx *Transaction) End() {
 	if tx.ended() {
 		return
 	}
+	if tx.active {
+		tx.tracer.activeTxs.release()
+	}
+	if tx.timeoutTimer != nil {
+		tx.timeoutTimer.Stop()
+	}
+	if tx.heartbeatTimer != nil {
+		tx.heartbeatTimer.Stop()
+	}
 	if tx.recording {
 		if tx.Duration < 0 {
 			tx.Duration = time.Since(tx.timestamp)
 		}
+		if tx.spanCountLabels && tx.Sampled() {
+			tx.setSpanCountLabels()
+		}
+		if tx.normalizeName {
+			tx.Name = normalizeTransactionName(tx.Name)
+		}
 		tx.enqueue()
 	} else {
 		tx.reset(tx.tracer)
@@ -250,6 +386,44 @@ func (tx *Transaction) End() {
 	tx.TransactionData = nil
 }
 
+// setSpanCountLabels records the number of spans started within the
+// transaction for each span type as transaction labels.
+//
+// This must be called with tx.mu held.
+func (tx *Transaction) setSpanCountLabels() {
+	spanTypes := make([]string, 0, len(tx.spanCounts))
+	for spanType := range tx.spanCounts {
+		spanTypes = append(spanTypes, spanType)
+	}
+	sort.Strings(spanTypes)
+	for _, spanType := range spanTypes {
+		tx.Context.SetLabel(spanType+"_calls", tx.spanCounts[spanType])
+	}
+}
+
+// normalizeTransactionName returns name with runs of whitespace
+// replaced by a single space, and a leading HTTP method uppercased.
+func normalizeTransactionName(name string) string {
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return ""
+	}
+	if len(fields) > 1 {
+		if method := strings.ToUpper(fields[0]); isHTTPMethod(method) {
+			fields[0] = method
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func isHTTPMethod(method string) bool {
+	switch method {
+	case "CONNECT", "DELETE", "GET", "HEAD", "OPTIONS", "PATCH", "POST", "PUT", "TRACE":
+		return true
+	}
+	return false
+}
+
 func (tx *Transaction) enqueue() {
 	event := tracerEvent{eventType: transactionEvent}
 	event.tx.Transaction = tx
@@ -300,17 +474,33 @@ type TransactionData struct {
 	// Result holds the transaction result.
 	Result string
 
+	// Outcome holds the transaction outcome: "success", "failure",
+	// or "unknown". Unlike Result, which is free-form, Outcome
+	// describes whether or not the transaction succeeded from the
+	// perspective of the service. If Outcome is empty, it will not
+	// be reported; any other value will be reported as "unknown".
+	Outcome string
+
 	recording               bool
+	active                  bool // counted in Tracer.activeTxs
+	timeoutTimer            *time.Timer
+	heartbeatTimer          *time.Timer
 	maxSpans                int
 	spanFramesMinDuration   time.Duration
 	stackTraceLimit         int
 	breakdownMetricsEnabled bool
 	propagateLegacyHeader   bool
+	spanCountLabels         bool
+	normalizeName           bool
+	hasSampleRate           bool
+	sampleRate              float64 // if hasSampleRate is set
 	timestamp               time.Time
+	featureFlags            int
 
 	mu            sync.Mutex
 	spansCreated  int
 	spansDropped  int
+	spanCounts    map[string]int // by span type, if spanCountLabels is set
 	childrenTimer childrenTimer
 	spanTimings   spanTimingsMap
 	rand          *rand.Rand // for ID generation
@@ -332,3 +522,43 @@ func (td *TransactionData) reset(tracer *Tracer) {
 	td.spanTimings.reset()
 	tracer.transactionDataPool.Put(td)
 }
+
+// activeTransactions tracks the number of active transactions,
+// for enforcing the limit set by Tracer.SetMaxActiveTransactions.
+type activeTransactions struct {
+	max    int32 // accessed atomically
+	count  int32 // accessed atomically
+	warned int32 // accessed atomically
+}
+
+// acquire increments the number of active transactions, returning
+// false without doing so if the limit has been reached.
+func (a *activeTransactions) acquire(t *Tracer) bool {
+	for {
+		count := atomic.LoadInt32(&a.count)
+		if max := atomic.LoadInt32(&a.max); max > 0 && count >= max {
+			t.statsMu.Lock()
+			t.stats.TransactionsRejected++
+			t.statsMu.Unlock()
+			if atomic.CompareAndSwapInt32(&a.warned, 0, 1) {
+				go t.sendConfigCommand(func(cfg *tracerConfig) {
+					if cfg.logger != nil {
+						cfg.logger.Warningf(
+							"the limit of %d active transactions has been reached, no new transactions will be recorded until active transactions end",
+							max,
+						)
+					}
+				})
+			}
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&a.count, count, count+1) {
+			return true
+		}
+	}
+}
+
+// release decrements the number of active transactions.
+func (a *activeTransactions) release() {
+	atomic.AddInt32(&a.count, -1)
+}
@@ -19,7 +19,10 @@ package apm_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -60,6 +63,40 @@ func testStartTransactionTraceContextOptions(t *testing.T, recorded bool) {
 	tx.Discard()
 }
 
+func TestStartTransactionSampledParent(t *testing.T) {
+	parent := apm.TraceContext{
+		Trace: apm.TraceID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+		Span:  apm.SpanID{0, 1, 2, 3, 4, 5, 6, 7},
+	}
+	sampledParent := parent
+	sampledParent.Options = sampledParent.Options.WithRecorded(true)
+
+	for _, localSampled := range []bool{false, true} {
+		tracer, _ := transporttest.NewRecorderTracer()
+		tracer.SetSampler(samplerFunc(func(apm.TraceContext) bool { return localSampled }))
+
+		// A sampled parent forces the transaction to be sampled,
+		// and an unsampled parent forces it to be unsampled; the
+		// local sampler is only consulted in the absence of a parent.
+		for _, test := range []struct {
+			traceContext apm.TraceContext
+			sampled      bool
+		}{
+			{traceContext: sampledParent, sampled: true},
+			{traceContext: parent, sampled: false},
+			{traceContext: apm.TraceContext{}, sampled: localSampled},
+		} {
+			tx := tracer.StartTransactionOptions("name", "type", apm.TransactionOptions{
+				TraceContext: test.traceContext,
+			})
+			assert.Equal(t, test.sampled, tx.Sampled())
+			assert.Equal(t, test.sampled, tx.TraceContext().Options.Recorded())
+			tx.Discard()
+		}
+		tracer.Close()
+	}
+}
+
 func TestStartTransactionInvalidTraceContext(t *testing.T) {
 	startTransactionInvalidTraceContext(t, apm.TraceContext{
 		// Trace is all zeroes, which is invalid.
@@ -175,6 +212,283 @@ func TestTransactionNotRecording(t *testing.T) {
 	require.Empty(t, payloads.Transactions)
 }
 
+func TestTransactionOutcome(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	tx.Result = "HTTP 2xx"
+	tx.Outcome = "failure"
+	tx.End()
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	assert.Equal(t, "failure", payloads.Transactions[0].Outcome)
+	assert.Equal(t, "", payloads.Transactions[1].Outcome)
+}
+
+func TestTransactionOutcomeInvalid(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	logger := warningsLogger(make(chan string, 10))
+	tracer.SetLogger(logger)
+
+	for i := 0; i < 2; i++ {
+		tx := tracer.StartTransaction("name", "type")
+		tx.Outcome = "partial"
+		tx.End()
+	}
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	assert.Equal(t, "unknown", payloads.Transactions[0].Outcome)
+	assert.Equal(t, "unknown", payloads.Transactions[1].Outcome)
+
+	// The warning is logged only once.
+	require.Len(t, logger, 1)
+	assert.Equal(t, `invalid outcome "partial" reported as "unknown"`, <-logger)
+}
+
+func TestTransactionSpanCountLabels(t *testing.T) {
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	tracer.SetMaxSpans(3)
+	tracer.SetSpanCountLabels(true)
+
+	tx := tracer.StartTransaction("name", "type")
+	for _, spanType := range []string{"db.mysql.query", "cache.redis", "db.mysql.query", "external.http", "db"} {
+		tx.StartSpan("name", spanType, nil).End()
+	}
+	tx.End()
+
+	tracer.SetSpanCountLabels(false)
+	tx = tracer.StartTransaction("name", "type")
+	tx.StartSpan("name", "db", nil).End()
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := recorder.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "cache_calls", Value: float64(1)},
+		{Key: "db_calls", Value: float64(3)},
+		{Key: "external_calls", Value: float64(1)},
+	}, payloads.Transactions[0].Context.Tags)
+	assert.Equal(t, 2, payloads.Transactions[0].SpanCount.Dropped)
+	assert.Nil(t, payloads.Transactions[1].Context)
+}
+
+func TestTransactionNormalizeName(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	names := []string{
+		"get /Users",
+		"GET /Users",
+		"  Get\t /Users/{id}  ",
+		"post  /users  ",
+		"gettext  /users",
+		"process   job",
+		"get",
+		"   ",
+	}
+	for _, name := range names {
+		tracer.StartTransaction(name, "type").End()
+	}
+	tracer.SetNormalizeTransactionNames(true)
+	for _, name := range names {
+		tracer.StartTransaction(name, "type").End()
+	}
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, len(names)*2)
+	var got []string
+	for _, tx := range payloads.Transactions {
+		got = append(got, tx.Name)
+	}
+	// Normalization is disabled by default.
+	assert.Equal(t, names, got[:len(names)])
+	assert.Equal(t, []string{
+		"GET /Users",
+		"GET /Users",
+		"GET /Users/{id}",
+		"POST /users",
+		"gettext /users",
+		"process job",
+		"get",
+		"",
+	}, got[len(names):])
+}
+
+func TestTransactionMaxEventSize(t *testing.T) {
+	var transport maxEventSizeTransport
+	transport.maxEventSize = 1024
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{Transport: &transport})
+	require.NoError(t, err)
+	defer tracer.Close()
+	tracer.SetCaptureBody(apm.CaptureBodyAll)
+
+	largeValue := strings.Repeat("x", 1024)
+
+	// The captured body alone exceeds the limit.
+	tx := tracer.StartTransaction("large_body", "type")
+	req, _ := http.NewRequest("POST", "http://server.testing/", strings.NewReader(strings.Repeat(largeValue, 2)))
+	bodyCapturer := tracer.CaptureHTTPRequestBody(req)
+	ioutil.ReadAll(req.Body)
+	tx.Context.SetHTTPRequest(req)
+	tx.Context.SetHTTPRequestBody(bodyCapturer)
+	tx.Context.SetLabel("small", "value")
+	tx.End()
+
+	// Labels exceed the limit.
+	tx = tracer.StartTransaction("large_labels", "type")
+	for i := 0; i < 20; i++ {
+		tx.Context.SetLabel(fmt.Sprintf("label%d", i), largeValue)
+	}
+	span := tx.StartSpan("large_statement", "db", nil)
+	span.Context.SetDatabase(apm.DatabaseSpanContext{Statement: strings.Repeat(largeValue, 2)})
+	span.End()
+	tx.End()
+
+	// Only the largest label exceeds the limit.
+	tx = tracer.StartTransaction("large_label", "type")
+	tx.Context.SetLabel("large", largeValue)
+	tx.Context.SetLabel("small", "value")
+	tx.End()
+
+	// Many labels exceed the limit; only the largest are dropped.
+	tx = tracer.StartTransaction("many_labels", "type")
+	for i := 0; i < 10; i++ {
+		tx.Context.SetLabel(fmt.Sprintf("label%d", i), strings.Repeat("x", 100+i))
+	}
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := transport.Payloads()
+	require.Len(t, payloads.Transactions, 4)
+	require.Len(t, payloads.Spans, 1)
+
+	// The body is truncated to fit within the limit,
+	// rather than being dropped entirely.
+	largeBody := payloads.Transactions[0]
+	require.NotNil(t, largeBody.Context.Request)
+	require.NotNil(t, largeBody.Context.Request.Body)
+	assert.NotEmpty(t, largeBody.Context.Request.Body.Raw)
+	assert.True(t, len(largeBody.Context.Request.Body.Raw) < 1024)
+	assert.True(t, strings.HasPrefix(largeValue, largeBody.Context.Request.Body.Raw))
+	assert.Equal(t, model.IfaceMap{
+		{Key: "event_truncated", Value: true},
+		{Key: "small", Value: "value"},
+	}, largeBody.Context.Tags)
+
+	largeLabels := payloads.Transactions[1]
+	assert.Equal(t, model.IfaceMap{{Key: "event_truncated", Value: true}}, largeLabels.Context.Tags)
+
+	largeLabel := payloads.Transactions[2]
+	assert.Equal(t, model.IfaceMap{
+		{Key: "event_truncated", Value: true},
+		{Key: "small", Value: "value"},
+	}, largeLabel.Context.Tags)
+
+	manyLabels := payloads.Transactions[3]
+	require.NotEmpty(t, manyLabels.Context.Tags)
+	assert.Equal(t, model.IfaceMapItem{Key: "event_truncated", Value: true}, manyLabels.Context.Tags[0])
+	remaining := manyLabels.Context.Tags[1:]
+	assert.NotEmpty(t, remaining)
+	assert.True(t, len(remaining) < 10)
+	for i, item := range remaining {
+		// The smallest labels are kept.
+		assert.Equal(t, fmt.Sprintf("label%d", i), item.Key)
+	}
+
+	largeStatement := payloads.Spans[0]
+	assert.NotEmpty(t, largeStatement.Context.Database.Statement)
+	assert.True(t, strings.HasPrefix(largeValue, largeStatement.Context.Database.Statement))
+	assert.Equal(t, model.IfaceMap{{Key: "event_truncated", Value: true}}, largeStatement.Context.Tags)
+
+	stats := tracer.Stats()
+	assert.Zero(t, stats.TransactionsDropped)
+	assert.Zero(t, stats.SpansDropped)
+}
+
+type maxEventSizeTransport struct {
+	transporttest.RecorderTransport
+	maxEventSize int
+}
+
+func (t *maxEventSizeTransport) MaxEventSize() int {
+	return t.maxEventSize
+}
+
+func TestTransactionAddFeatureFlag(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	assert.True(t, tx.AddFeatureFlag("new-checkout", true))
+	assert.True(t, tx.AddFeatureFlag("search.variant", "b"))
+	for i := 2; i < apm.MaxFeatureFlags; i++ {
+		assert.True(t, tx.AddFeatureFlag(fmt.Sprintf("flag%d", i), i))
+	}
+	assert.False(t, tx.AddFeatureFlag("one-too-many", true))
+	tx.End()
+	assert.False(t, tx.AddFeatureFlag("ended", true))
+
+	// The flag count must be reset when transactions are reused.
+	tx = tracer.StartTransaction("name", "type")
+	assert.True(t, tx.AddFeatureFlag("new-checkout", false))
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 2)
+	labels := make(map[string]interface{})
+	for _, label := range payloads.Transactions[0].Context.Tags {
+		labels[label.Key] = label.Value
+	}
+	assert.Len(t, labels, apm.MaxFeatureFlags)
+	assert.Equal(t, true, labels["flag_new-checkout"])
+	assert.Equal(t, "b", labels["flag_search_variant"])
+	assert.NotContains(t, labels, "flag_one-too-many")
+	assert.Equal(t, model.IfaceMap{{Key: "flag_new-checkout", Value: false}}, payloads.Transactions[1].Context.Tags)
+}
+
+func TestTransactionAddFeatureFlagRepeated(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+
+	tx := tracer.StartTransaction("name", "type")
+	for i := 0; i < apm.MaxFeatureFlags*2; i++ {
+		// Recording the same flag repeatedly replaces its value,
+		// and does not count towards the limit.
+		assert.True(t, tx.AddFeatureFlag("new-checkout", i))
+	}
+	assert.True(t, tx.AddFeatureFlag("search.variant", "b"))
+	tx.End()
+	tracer.Flush(nil)
+
+	payloads := tracer.Payloads()
+	require.Len(t, payloads.Transactions, 1)
+	assert.Equal(t, model.IfaceMap{
+		{Key: "flag_new-checkout", Value: float64(apm.MaxFeatureFlags*2 - 1)},
+		{Key: "flag_search_variant", Value: "b"},
+	}, payloads.Transactions[0].Context.Tags)
+}
+
+func TestTransactionAddFeatureFlagNotSampled(t *testing.T) {
+	tracer := apmtest.NewRecordingTracer()
+	defer tracer.Close()
+	tracer.SetSampler(samplerFunc(func(apm.TraceContext) bool { return false }))
+
+	tx := tracer.StartTransaction("name", "type")
+	assert.False(t, tx.AddFeatureFlag("new-checkout", true))
+	tx.End()
+}
+
 func BenchmarkTransaction(b *testing.B) {
 	tracer, err := apm.NewTracer("service", "")
 	require.NoError(b, err)
@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apm
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// MaxTimeoutStackDumpSize is the maximum size in bytes of the goroutine
+// stack dump captured for transactions exceeding the transaction timeout,
+// when enabled with WithTimeoutStackDump. Larger stack dumps are truncated.
+const MaxTimeoutStackDumpSize = 64 * 1024
+
+// TimeoutOption is an option for Tracer.SetTransactionTimeout.
+type TimeoutOption func(*transactionTimeoutConfig)
+
+// WithTimeoutStackDump returns a TimeoutOption which enables capturing a
+// dump of all goroutine stacks when a transaction exceeds the timeout, for
+// diagnosing what the transaction was stuck on. The stack dump is recorded
+// in the reported error's custom context, under the key "goroutines", and
+// is truncated to MaxTimeoutStackDumpSize bytes.
+//
+// Capturing the stacks of all goroutines stops the world, so this should
+// be used with care in services with many goroutines.
+func WithTimeoutStackDump() TimeoutOption {
+	return func(cfg *transactionTimeoutConfig) {
+		cfg.stackDump = true
+	}
+}
+
+type transactionTimeoutConfig struct {
+	timeout   time.Duration
+	stackDump bool
+}
+
+// SetTransactionTimeout sets the maximum expected duration of transactions.
+// If a transaction has not ended within the timeout of its start, an error
+// will be reported, linked to the transaction, describing the timeout.
+// If timeout is zero or negative, which is the default, transactions will
+// not be timed.
+//
+// The transaction is not ended when the timeout is exceeded, as it may
+// still be in use by the code being traced; it will be reported as usual
+// when it is eventually ended.
+//
+// The timeout applies to transactions started after SetTransactionTimeout
+// returns.
+func (t *Tracer) SetTransactionTimeout(timeout time.Duration, opts ...TimeoutOption) {
+	cfg := transactionTimeoutConfig{timeout: timeout}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	t.txTimeout.Store(cfg)
+}
+
+// startTimeoutTimer starts a timer for reporting tx as having exceeded
+// the configured transaction timeout, if any.
+func (t *Tracer) startTimeoutTimer(tx *Transaction) {
+	cfg, _ := t.txTimeout.Load().(transactionTimeoutConfig)
+	if cfg.timeout <= 0 {
+		return
+	}
+	// Capture the transaction details now, as the transaction
+	// data may be modified concurrently when the timer fires.
+	traceContext := tx.traceContext
+	name, transactionType := tx.Name, tx.Type
+	tx.timeoutTimer = time.AfterFunc(cfg.timeout, func() {
+		tx.mu.RLock()
+		defer tx.mu.RUnlock()
+		if tx.ended() {
+			return
+		}
+		t.reportTransactionTimeout(traceContext, name, transactionType, cfg)
+	})
+}
+
+func (t *Tracer) reportTransactionTimeout(
+	traceContext TraceContext,
+	name, transactionType string,
+	cfg transactionTimeoutConfig,
+) {
+	e := t.NewErrorLog(ErrorLogRecord{
+		Message: fmt.Sprintf("transaction %q exceeded timeout of %s", name, cfg.timeout),
+		Level:   ErrorLevelWarning,
+	})
+	e.setSpanData(traceContext, traceContext.Span, transactionType, nil)
+	if cfg.stackDump && e.recording {
+		e.Context.SetCustom("goroutines", goroutineStackDump(MaxTimeoutStackDumpSize))
+	}
+	e.Send()
+}
+
+// goroutineStackDump returns the stacks of all goroutines,
+// truncated to at most maxSize bytes.
+func goroutineStackDump(maxSize int) string {
+	buf := make([]byte, maxSize)
+	n := runtime.Stack(buf, true)
+	return string(buf[:n])
+}
@@ -59,6 +59,12 @@ const (
 	envServerTimeout    = "ELASTIC_APM_SERVER_TIMEOUT"
 	envServerCert       = "ELASTIC_APM_SERVER_CERT"
 	envVerifyServerCert = "ELASTIC_APM_VERIFY_SERVER_CERT"
+	envServerHeaders    = "ELASTIC_APM_SERVER_HEADERS"
+	envMaxEventSize     = "ELASTIC_APM_MAX_EVENT_SIZE"
+
+	// DefaultMaxEventSize is the default maximum size of an individual
+	// encoded event, matching the APM Server's default limit.
+	DefaultMaxEventSize = 300 * configutil.KByte
 )
 
 var (
@@ -68,17 +74,33 @@ var (
 
 	defaultServerURL, _  = url.Parse("http://localhost:8200")
 	defaultServerTimeout = 30 * time.Second
+
+	// reservedHeaders holds the canonical names of headers which are
+	// managed by HTTPTransport, and cannot be set with SetExtraHeaders.
+	reservedHeaders = map[string]bool{
+		"Authorization":     true,
+		"Content-Encoding":  true,
+		"Content-Type":      true,
+		"Transfer-Encoding": true,
+		"User-Agent":        true,
+	}
 )
 
 // HTTPTransport is an implementation of Transport, sending payloads via
 // a net/http client.
 type HTTPTransport struct {
+	// maxEventSize is accessed atomically, as it is read by the
+	// tracer for each event. It is the first field so that it is
+	// 64-bit aligned on 32-bit architectures.
+	maxEventSize int64
+
 	// Client exposes the http.Client used by the HTTPTransport for
 	// sending requests to the APM Server.
 	Client         *http.Client
 	intakeHeaders  http.Header
 	configHeaders  http.Header
 	profileHeaders http.Header
+	extraHeaders   http.Header
 	shuffleRand    *rand.Rand
 
 	urlIndex    int32
@@ -112,6 +134,14 @@ type HTTPTransport struct {
 //   when using HTTPS. By default, the transport will verify server
 //   certificates.
 //
+// - ELASTIC_APM_SERVER_HEADERS: a comma-separated list of key=value
+//   pairs, describing additional headers to send with each request
+//   to the APM Server. See SetExtraHeaders.
+//
+// - ELASTIC_APM_MAX_EVENT_SIZE: the maximum size of an individual event
+//   sent to the APM Server, e.g. "300KB". See SetMaxEventSize. If not
+//   specified, defaults to DefaultMaxEventSize.
+//
 func NewHTTPTransport() (*HTTPTransport, error) {
 	verifyServerCert, err := configutil.ParseBoolEnv(envVerifyServerCert, true)
 	if err != nil {
@@ -131,6 +161,16 @@ func NewHTTPTransport() (*HTTPTransport, error) {
 		return nil, err
 	}
 
+	extraHeaders, err := initServerHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	maxEventSize, err := configutil.ParseSizeEnv(envMaxEventSize, DefaultMaxEventSize)
+	if err != nil {
+		return nil, err
+	}
+
 	tlsConfig := &tls.Config{InsecureSkipVerify: !verifyServerCert}
 	serverCertPath := os.Getenv(envServerCert)
 	if serverCertPath != "" {
@@ -174,7 +214,9 @@ func NewHTTPTransport() (*HTTPTransport, error) {
 		configHeaders:  commonHeaders,
 		intakeHeaders:  intakeHeaders,
 		profileHeaders: profileHeaders,
+		maxEventSize:   int64(maxEventSize),
 	}
+	t.SetExtraHeaders(extraHeaders)
 	if apiKey := os.Getenv(envAPIKey); apiKey != "" {
 		t.SetAPIKey(apiKey)
 	} else if secretToken := os.Getenv(envSecretToken); secretToken != "" {
@@ -245,6 +287,58 @@ func (t *HTTPTransport) SetAPIKey(apiKey string) {
 	}
 }
 
+// SetExtraHeaders sets additional headers that will be sent with each
+// request to the APM Server, such as headers required by a proxy in front
+// of the APM Server. Headers set by a previous call to SetExtraHeaders
+// are removed.
+//
+// Headers managed by the transport, i.e. Authorization, Content-Encoding,
+// Content-Type, Transfer-Encoding, and User-Agent, are ignored. Use the
+// SetSecretToken, SetAPIKey, and SetUserAgent methods to set the
+// Authorization and User-Agent headers.
+//
+// This overrides the headers specified via the ELASTIC_APM_SERVER_HEADERS
+// environment variable, if it is set.
+func (t *HTTPTransport) SetExtraHeaders(headers http.Header) {
+	for key := range t.extraHeaders {
+		t.deleteCommonHeader(key)
+	}
+	t.extraHeaders = make(http.Header, len(headers))
+	for key, values := range headers {
+		key = http.CanonicalHeaderKey(key)
+		if reservedHeaders[key] || len(values) == 0 {
+			continue
+		}
+		values = append([]string(nil), values...)
+		t.extraHeaders[key] = values
+		t.configHeaders[key] = values
+		t.intakeHeaders[key] = values
+		t.profileHeaders[key] = values
+	}
+}
+
+// SetMaxEventSize sets the maximum size, in bytes, of an individual event
+// sent to the APM Server. The tracer truncates the largest fields of events
+// that exceed the limit, such as captured request bodies and labels, and
+// drops events that still exceed the limit, rather than sending events the
+// APM Server would reject. If size is zero or less, event sizes are not
+// limited.
+//
+// The limit should be no greater than the APM Server's max_event_size.
+//
+// This overrides the size specified via the ELASTIC_APM_MAX_EVENT_SIZE
+// environment variable, if it is set.
+func (t *HTTPTransport) SetMaxEventSize(size int) {
+	atomic.StoreInt64(&t.maxEventSize, int64(size))
+}
+
+// MaxEventSize returns the maximum size, in bytes, of an individual event
+// sent to the APM Server, as set by SetMaxEventSize. If MaxEventSize returns
+// zero or less, event sizes are not limited.
+func (t *HTTPTransport) MaxEventSize() int {
+	return int(atomic.LoadInt64(&t.maxEventSize))
+}
+
 func (t *HTTPTransport) setCommonHeader(key, value string) {
 	t.configHeaders.Set(key, value)
 	t.intakeHeaders.Set(key, value)
@@ -556,6 +650,19 @@ func initServerURLs() ([]*url.URL, error) {
 	return urls, nil
 }
 
+func initServerHeaders() (http.Header, error) {
+	headers := make(http.Header)
+	for _, kv := range configutil.ParseListEnv(envServerHeaders, ",", nil) {
+		i := strings.IndexRune(kv, '=')
+		if i <= 0 {
+			return nil, errors.Errorf("invalid header %q in %s, expected key=value", kv, envServerHeaders)
+		}
+		k, v := strings.TrimSpace(kv[:i]), strings.TrimSpace(kv[i+1:])
+		headers.Add(k, v)
+	}
+	return headers, nil
+}
+
 func requestWithContext(ctx context.Context, req *http.Request) *http.Request {
 	url := req.URL
 	req.URL = nil
@@ -167,6 +167,80 @@ func TestHTTPTransportNoAuthorization(t *testing.T) {
 	assertAuthorization(t, h.requests[0])
 }
 
+func TestHTTPTransportExtraHeaders(t *testing.T) {
+	var h recordingHandler
+	transport, server := newHTTPTransport(t, &h)
+	defer server.Close()
+
+	transport.SetSecretToken("hunter2")
+	transport.SetExtraHeaders(http.Header{
+		"x-tenant":         {"tenant1"},
+		"X-Gateway-Auth":   {"a", "b"},
+		"Content-Type":     {"text/plain"},
+		"Content-Encoding": {"identity"},
+		"Authorization":    {"Basic abc"},
+	})
+	transport.SendStream(context.Background(), strings.NewReader(""))
+
+	transport.SetExtraHeaders(http.Header{"X-Tenant": {"tenant2"}})
+	transport.SendStream(context.Background(), strings.NewReader(""))
+
+	require.Len(t, h.requests, 2)
+	assert.Equal(t, []string{"tenant1"}, h.requests[0].Header["X-Tenant"])
+	assert.Equal(t, []string{"a", "b"}, h.requests[0].Header["X-Gateway-Auth"])
+	assert.Equal(t, "application/x-ndjson", h.requests[0].Header.Get("Content-Type"))
+	assert.Equal(t, "deflate", h.requests[0].Header.Get("Content-Encoding"))
+	assertAuthorization(t, h.requests[0], "Bearer hunter2")
+
+	assert.Equal(t, []string{"tenant2"}, h.requests[1].Header["X-Tenant"])
+	assert.NotContains(t, h.requests[1].Header, "X-Gateway-Auth")
+	assertAuthorization(t, h.requests[1], "Bearer hunter2")
+}
+
+func TestHTTPTransportEnvExtraHeaders(t *testing.T) {
+	var h recordingHandler
+	server := httptest.NewServer(&h)
+	defer server.Close()
+	defer patchEnv("ELASTIC_APM_SERVER_URLS", server.URL)()
+	defer patchEnv("ELASTIC_APM_SERVER_HEADERS", "X-Tenant=tenant1, X-Gateway-Auth = abc=")()
+
+	transport, err := transport.NewHTTPTransport()
+	require.NoError(t, err)
+	transport.SendStream(context.Background(), strings.NewReader(""))
+
+	require.Len(t, h.requests, 1)
+	assert.Equal(t, "tenant1", h.requests[0].Header.Get("X-Tenant"))
+	assert.Equal(t, "abc=", h.requests[0].Header.Get("X-Gateway-Auth"))
+}
+
+func TestHTTPTransportEnvExtraHeadersInvalid(t *testing.T) {
+	defer patchEnv("ELASTIC_APM_SERVER_HEADERS", "X-Tenant")()
+	_, err := transport.NewHTTPTransport()
+	assert.EqualError(t, err, `invalid header "X-Tenant" in ELASTIC_APM_SERVER_HEADERS, expected key=value`)
+}
+
+func TestHTTPTransportMaxEventSize(t *testing.T) {
+	transport, err := transport.NewHTTPTransport()
+	require.NoError(t, err)
+	assert.Equal(t, 300*1024, transport.MaxEventSize())
+
+	transport.SetMaxEventSize(1024)
+	assert.Equal(t, 1024, transport.MaxEventSize())
+}
+
+func TestHTTPTransportEnvMaxEventSize(t *testing.T) {
+	defer patchEnv("ELASTIC_APM_MAX_EVENT_SIZE", "1MB")()
+	transport, err := transport.NewHTTPTransport()
+	require.NoError(t, err)
+	assert.Equal(t, 1024*1024, transport.MaxEventSize())
+}
+
+func TestHTTPTransportEnvMaxEventSizeInvalid(t *testing.T) {
+	defer patchEnv("ELASTIC_APM_MAX_EVENT_SIZE", "lots")()
+	_, err := transport.NewHTTPTransport()
+	assert.EqualError(t, err, "failed to parse ELASTIC_APM_MAX_EVENT_SIZE: invalid size lots")
+}
+
 func TestHTTPTransportTLS(t *testing.T) {
 	var h recordingHandler
 	server := httptest.NewUnstartedServer(&h)
@@ -0,0 +1,225 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// multiTransportBufferSize is the maximum number of chunks of
+	// the stream, each of up to multiTransportChunkSize bytes,
+	// buffered for each transport by MultiTransport.SendStream.
+	multiTransportBufferSize = 64
+	multiTransportChunkSize  = 32 * 1024
+
+	// multiTransportLagTimeout is the maximum amount of time
+	// MultiTransport.SendStream waits for space in a transport's
+	// buffer before dropping it from the stream.
+	multiTransportLagTimeout = 2 * time.Second
+)
+
+// ErrTransportLagging is returned, within a *MultiError, by
+// MultiTransport.SendStream for a transport that was dropped from
+// the stream because it fell too far behind the others.
+var ErrTransportLagging = errors.New("transport fell behind, dropped from stream")
+
+// MultiTransport is a Transport which sends each stream of events
+// to multiple underlying transports.
+type MultiTransport struct {
+	transports []Transport
+}
+
+// NewMultiTransport returns a new MultiTransport which fans out
+// each stream of events to all of the given transports, e.g. for
+// sending events to both an existing and a new APM Server while
+// migrating between them.
+//
+// Every event is encoded once, but sent once per transport, so the
+// bandwidth used for sending events is multiplied by the number of
+// transports. Streams are sent to the transports concurrently; a
+// transport that fails stops receiving the remainder of the stream,
+// without affecting the others. Each transport has a bounded buffer
+// of the stream, so that a transport which is temporarily slower than
+// the others does not slow them down. If a transport's buffer remains
+// full for more than two seconds, the context passed to its SendStream
+// method is canceled and it stops receiving the remainder of the stream,
+// so that a hung transport does not block the others.
+//
+// Only sending events is fanned out: central config and profiling
+// are not supported by MultiTransport.
+func NewMultiTransport(transports ...Transport) *MultiTransport {
+	return &MultiTransport{transports: transports}
+}
+
+// SendStream sends the stream to all of the underlying transports,
+// returning once all of them have returned. If any of them fail, or
+// are dropped for falling behind, a *MultiError is returned containing
+// their errors.
+func (m *MultiTransport) SendStream(ctx context.Context, r io.Reader) error {
+	if len(m.transports) == 1 {
+		return m.transports[0].SendStream(ctx, r)
+	}
+
+	dests := make([]*multiDestination, len(m.transports))
+	for i, t := range m.transports {
+		d := &multiDestination{
+			chunks: make(chan []byte, multiTransportBufferSize),
+			done:   make(chan struct{}),
+		}
+		var dctx context.Context
+		dctx, d.cancel = context.WithCancel(ctx)
+		d.reader.chunks = d.chunks
+		dests[i] = d
+		go func(t Transport) {
+			defer close(d.done)
+			defer d.cancel()
+			d.sendErr = t.SendStream(dctx, &d.reader)
+		}(t)
+	}
+
+	buf := make([]byte, multiTransportChunkSize)
+	active := len(dests)
+	for active > 0 {
+		n, err := r.Read(buf)
+		if n > 0 {
+			// The chunk is shared by all transports, and not modified.
+			chunk := append([]byte(nil), buf[:n]...)
+			for _, d := range dests {
+				if d.closed {
+					continue
+				}
+				select {
+				case d.chunks <- chunk:
+					continue
+				default:
+				}
+				// The transport's buffer is full; wait for
+				// space, or drop the transport if it lags.
+				lagTimer := time.NewTimer(multiTransportLagTimeout)
+				select {
+				case d.chunks <- chunk:
+				case <-d.done:
+					// The transport returned without
+					// consuming the entire stream.
+					d.close(nil)
+					active--
+				case <-lagTimer.C:
+					d.lagging = true
+					d.close(ErrTransportLagging)
+					d.cancel()
+					active--
+				}
+				lagTimer.Stop()
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			for _, d := range dests {
+				if !d.closed {
+					d.close(err)
+				}
+			}
+			break
+		}
+	}
+
+	var merr MultiError
+	for _, d := range dests {
+		<-d.done
+		switch {
+		case d.lagging:
+			merr.Errors = append(merr.Errors, ErrTransportLagging)
+		case d.sendErr != nil:
+			merr.Errors = append(merr.Errors, d.sendErr)
+		}
+	}
+	if len(merr.Errors) != 0 {
+		return &merr
+	}
+	return nil
+}
+
+// multiDestination holds the state of a transport receiving
+// a stream from MultiTransport.SendStream.
+type multiDestination struct {
+	chunks  chan []byte
+	reader  chunkReader
+	done    chan struct{}
+	cancel  context.CancelFunc
+	sendErr error // set before done is closed
+
+	// closed and lagging are accessed only by SendStream.
+	closed  bool
+	lagging bool
+}
+
+// close closes d.chunks, causing d's reader to return err once
+// the buffered chunks have been read, or io.EOF if err is nil.
+func (d *multiDestination) close(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	// err is set before closing the channel, and read by
+	// the reader only after observing the channel closed.
+	d.reader.err = err
+	close(d.chunks)
+	d.closed = true
+}
+
+// chunkReader is an io.Reader which reads from a channel of chunks,
+// returning err once the channel is closed.
+type chunkReader struct {
+	chunks <-chan []byte
+	chunk  []byte
+	err    error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		chunk, ok := <-r.chunks
+		if !ok {
+			return 0, r.err
+		}
+		r.chunk = chunk
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// MultiError is returned by MultiTransport.SendStream when one or
+// more of the underlying transports fail to send the stream.
+type MultiError struct {
+	// Errors holds the errors returned by the failed transports.
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
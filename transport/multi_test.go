@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/transport"
+	"go.elastic.co/apm/transport/transporttest"
+)
+
+func TestMultiTransport(t *testing.T) {
+	var r1, r2 transporttest.RecorderTransport
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{
+		ServiceName: "transporttest",
+		Transport:   transport.NewMultiTransport(&r1, &r2),
+	})
+	require.NoError(t, err)
+	defer tracer.Close()
+
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	for _, r := range []*transporttest.RecorderTransport{&r1, &r2} {
+		payloads := r.Payloads()
+		require.Len(t, payloads.Transactions, 1)
+		assert.Equal(t, "name", payloads.Transactions[0].Name)
+	}
+}
+
+func TestMultiTransportError(t *testing.T) {
+	var recorder transporttest.RecorderTransport
+	failing := failingTransport{err: errors.New("boom")}
+	multi := transport.NewMultiTransport(failing, &recorder, failing)
+
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{
+		ServiceName: "transporttest",
+		Transport:   multi,
+	})
+	require.NoError(t, err)
+	defer tracer.Close()
+
+	tracer.StartTransaction("name", "type").End()
+	tracer.Flush(nil)
+
+	// The failing transports do not prevent the
+	// recorder from receiving the events.
+	assert.Len(t, recorder.Payloads().Transactions, 1)
+	assert.Equal(t, uint64(1), tracer.Stats().Errors.SendStream)
+
+	multi = transport.NewMultiTransport(failing, transporttest.Discard, failing)
+	err = multi.SendStream(context.Background(), eofReader{})
+	require.IsType(t, &transport.MultiError{}, err)
+	assert.Len(t, err.(*transport.MultiError).Errors, 2)
+	assert.EqualError(t, err, "boom; boom")
+}
+
+func TestMultiTransportBlocked(t *testing.T) {
+	var counting countingTransport
+	multi := transport.NewMultiTransport(blockingTransport{}, &counting)
+
+	// The stream is larger than the buffer for each transport,
+	// so the blocked transport is dropped rather than blocking
+	// the other transport.
+	stream := bytes.Repeat([]byte("x"), 10<<20)
+	done := make(chan error, 1)
+	go func() {
+		done <- multi.SendStream(context.Background(), bytes.NewReader(stream))
+	}()
+
+	select {
+	case err := <-done:
+		require.IsType(t, &transport.MultiError{}, err)
+		assert.Equal(t, []error{transport.ErrTransportLagging}, err.(*transport.MultiError).Errors)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for SendStream to return")
+	}
+	assert.Equal(t, int64(len(stream)), counting.n)
+}
+
+// blockingTransport blocks without reading the stream until
+// the context is canceled.
+type blockingTransport struct{}
+
+func (blockingTransport) SendStream(ctx context.Context, r io.Reader) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// countingTransport records the number of bytes in the stream.
+type countingTransport struct {
+	n int64
+}
+
+func (t *countingTransport) SendStream(ctx context.Context, r io.Reader) error {
+	n, err := io.Copy(ioutil.Discard, r)
+	t.n += n
+	return err
+}
+
+// failingTransport returns err without reading the stream.
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) SendStream(context.Context, io.Reader) error {
+	return t.err
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
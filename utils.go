@@ -42,6 +42,11 @@ var (
 	goRuntime      = model.Runtime{Name: runtime.Compiler, Version: runtime.Version()}
 	localSystem    model.System
 
+	// metadataLabels holds the labels to include in metadata: the
+	// global labels defined by ELASTIC_APM_GLOBAL_LABELS, followed
+	// by labels describing the program's build settings.
+	metadataLabels model.StringMap
+
 	serviceNameInvalidRegexp = regexp.MustCompile("[^" + serviceNameValidClass + "]")
 	labelKeyReplacer         = strings.NewReplacer(`.`, `_`, `*`, `_`, `"`, `_`)
 
@@ -69,6 +74,23 @@ const (
 func init() {
 	currentProcess = getCurrentProcess()
 	localSystem = getLocalSystem()
+	metadataLabels = mergeLabels(globalLabels, getBuildLabels())
+}
+
+// mergeLabels returns the labels of a followed by those of b, omitting
+// any in b with the same key as a label in a.
+func mergeLabels(a, b model.StringMap) model.StringMap {
+	out := append(model.StringMap(nil), a...)
+outer:
+	for _, item := range b {
+		for _, existing := range a {
+			if existing.Key == item.Key {
+				continue outer
+			}
+		}
+		out = append(out, item)
+	}
+	return out
 }
 
 func getCurrentProcess() model.Process {
@@ -189,6 +211,35 @@ func makeLabelValue(v interface{}) interface{} {
 	return truncateString(fmt.Sprint(v))
 }
 
+// makeCustomValue returns v as a value suitable for including in
+// custom context. Nested maps of type map[string]interface{} or
+// map[string]string, possibly within slices of type []interface{},
+// are copied with their keys cleaned using cleanLabelKey; all other
+// values are returned as-is.
+func makeCustomValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, v := range v {
+			m[cleanLabelKey(k)] = makeCustomValue(v)
+		}
+		return m
+	case map[string]string:
+		m := make(map[string]string, len(v))
+		for k, v := range v {
+			m[cleanLabelKey(k)] = v
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, v := range v {
+			s[i] = makeCustomValue(v)
+		}
+		return s
+	}
+	return v
+}
+
 func validateServiceName(name string) error {
 	idx := serviceNameInvalidRegexp.FindStringIndex(name)
 	if idx == nil {
@@ -29,6 +29,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 	"unicode/utf8"
 
 	"github.com/pkg/errors"
@@ -78,6 +79,16 @@ func TestValidateTransactionResult(t *testing.T) {
 	})
 }
 
+func TestValidateTransactionOutcome(t *testing.T) {
+	for _, outcome := range []string{"success", "failure", "unknown", "bogus"} {
+		validatePayloads(t, func(tracer *apm.Tracer) {
+			tx := tracer.StartTransaction("name", "type")
+			tx.Outcome = outcome
+			tx.End()
+		})
+	}
+}
+
 func TestValidateSpanName(t *testing.T) {
 	validateTransaction(t, func(tx *apm.Transaction) {
 		tx.StartSpan(strings.Repeat("x", 1025), "type", nil).End()
@@ -111,6 +122,39 @@ func TestValidateDestinationSpanContext(t *testing.T) {
 	})
 }
 
+func TestValidateServiceTargetSpanContext(t *testing.T) {
+	validateSpan(t, func(s *apm.Span) {
+		s.Context.SetServiceTarget(apm.ServiceTargetSpanContext{
+			Type: strings.Repeat("x", 1025),
+			Name: strings.Repeat("x", 1025),
+		})
+	})
+}
+
+func TestValidateSpanContextCustom(t *testing.T) {
+	validateSpan(t, func(s *apm.Span) {
+		s.Context.SetCustom("x.y", map[string]interface{}{
+			"y.z": map[string]string{"*": `"`},
+		})
+	})
+}
+
+func TestValidateTransactionSampleRate(t *testing.T) {
+	validatePayloads(t, func(tracer *apm.Tracer) {
+		tracer.SetSampler(apm.NewRatioSampler(1.0 / 3))
+		for i := 0; i < 10; i++ {
+			tracer.StartTransaction("name", "type").End()
+		}
+	})
+}
+
+func TestValidateTransactionHeartbeat(t *testing.T) {
+	validateTransaction(t, func(tx *apm.Transaction) {
+		tx.Name = strings.Repeat("x", 1025)
+		tx.Heartbeat()
+	})
+}
+
 func TestValidateContextUser(t *testing.T) {
 	validateTransaction(t, func(tx *apm.Transaction) {
 		tx.Context.SetUsername(strings.Repeat("x", 1025))
@@ -119,6 +163,12 @@ func TestValidateContextUser(t *testing.T) {
 	})
 }
 
+func TestValidateContextUserSession(t *testing.T) {
+	validateTransaction(t, func(tx *apm.Transaction) {
+		tx.Context.SetUserSession(strings.Repeat("x", 1025))
+	})
+}
+
 func TestValidateContextUserBasicAuth(t *testing.T) {
 	validateTransaction(t, func(tx *apm.Transaction) {
 		req, err := http.NewRequest("GET", "/", nil)
@@ -165,6 +215,20 @@ func TestValidateContextCustom(t *testing.T) {
 			tx.Context.SetCustom("x.y", "z")
 		})
 	})
+	t.Run("nested", func(t *testing.T) {
+		validateTransaction(t, func(tx *apm.Transaction) {
+			tx.Context.SetCustom("x", map[string]interface{}{
+				"y.z": map[string]string{"*": `"`},
+			})
+		})
+	})
+}
+
+func TestValidateContextMessage(t *testing.T) {
+	validateTransaction(t, func(tx *apm.Transaction) {
+		tx.Context.SetMessageQueueName(strings.Repeat("x", 1025))
+		tx.Context.SetMessageAge(time.Minute)
+	})
 }
 
 func TestValidateRequestMethod(t *testing.T) {
@@ -327,6 +391,20 @@ func TestValidateMetrics(t *testing.T) {
 	})
 }
 
+func TestValidateMetricsHistogram(t *testing.T) {
+	histogram := apm.NewHistogram("histogram", []apm.MetricLabel{
+		{Name: "name", Value: "value"},
+	}, []float64{1, 10, 100})
+	histogram.Observe(5)
+	histogram.Observe(500)
+
+	validatePayloads(t, func(tracer *apm.Tracer) {
+		unregister := tracer.RegisterMetricsGatherer(histogram)
+		defer unregister()
+		tracer.SendMetrics(nil)
+	})
+}
+
 func validateSpan(t *testing.T, f func(s *apm.Span)) {
 	validateTransaction(t, func(tx *apm.Transaction) {
 		s := tx.StartSpan("name", "type", nil)